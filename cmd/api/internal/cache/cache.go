@@ -2,6 +2,7 @@ package cache
 
 import (
 	"fmt"
+	"log"
 	"sort"
 	"sync"
 	"time"
@@ -16,15 +17,36 @@ type ModelCacheItem struct {
 	ProviderDisplayName string
 	ProviderBaseURL     string
 	ProviderAPIPrefix   string
+	ProviderType        string // 接口协议类型
+	ProviderAPIVersion  string // Azure OpenAI 的 api-version
 	Username           string
 	ProviderKey        string
+	Fallbacks          []models.ModelFallbackWithProvider // 备用目标（按优先级排序）
+	Availability       []models.AvailabilityWindow        // 可用时间段，为空表示全天可用
+}
+
+// CacheKey 返回模型对外暴露的名称（厂商前缀-模型别名）
+func (m *ModelCacheItem) CacheKey() string {
+	return generateCacheKey(m.ProviderAPIPrefix, m.Model.DisplayName)
+}
+
+// AvailableAt 判断模型在 t 时刻是否处于可用时间段内
+func (m *ModelCacheItem) AvailableAt(t time.Time) bool {
+	return models.AvailableAt(m.Availability, t)
+}
+
+// NextAvailable 返回模型下次可用的时间
+func (m *ModelCacheItem) NextAvailable(t time.Time) time.Time {
+	return models.NextAvailable(m.Availability, t)
 }
 
 // APIKeyCacheItem API密钥缓存项
 type APIKeyCacheItem struct {
+	ID       uint64
 	UserID   uint64
 	Prompt   string
 	Prompts  map[string]string // 工具名 -> 提示词
+	limiter  *apiKeyLimiter    // 请求频率和并发限制
 }
 
 // MemoryCache 内存缓存
@@ -34,6 +56,10 @@ type MemoryCache struct {
 	modelsByKey     map[string]*ModelCacheItem                     // provider_prefix-model_id -> ModelCacheItem
 	modelsByUser    map[uint64]map[uint64]*ModelCacheItem          // user_id -> model_id -> ModelCacheItem
 	apiKeys         map[string]*APIKeyCacheItem                    // api_key -> APIKeyCacheItem
+	providerKeys    map[uint64][]*ProviderKeyCacheItem             // provider_id -> 启用的厂商密钥
+	providerPolicies map[uint64]models.ProviderPolicy             // provider_id -> 超时和重试配置
+	providerBreakers map[uint64]*circuitBreaker                   // provider_id -> 厂商熔断器
+	quotas          map[uint64]*models.Quota                       // quota_id -> 用量配额
 	lastUpdate      time.Time
 }
 
@@ -47,6 +73,10 @@ func InitCache() {
 		modelsByKey: make(map[string]*ModelCacheItem),
 		modelsByUser: make(map[uint64]map[uint64]*ModelCacheItem),
 		apiKeys:     make(map[string]*APIKeyCacheItem),
+		providerKeys: make(map[uint64][]*ProviderKeyCacheItem),
+		providerPolicies: make(map[uint64]models.ProviderPolicy),
+		providerBreakers: make(map[uint64]*circuitBreaker),
+		quotas:      make(map[uint64]*models.Quota),
 	}
 }
 
@@ -69,14 +99,23 @@ func generateCacheKey(providerPrefix, displayName string) string {
 
 // newModelCacheItem 创建新的 ModelCacheItem
 func newModelCacheItem(detail models.ModelWithDetails) *ModelCacheItem {
+	// 写入时已校验格式，解析失败时按全天可用处理
+	availability, err := models.ParseAvailability(detail.Availability)
+	if err != nil {
+		log.Printf("[WARN] 模型 %d 的可用时间段无效: %v", detail.ID, err)
+	}
 	return &ModelCacheItem{
 		Model:               detail.Model,
 		ProviderName:        detail.ProviderName,
 		ProviderDisplayName: detail.ProviderDisplayName,
 		ProviderBaseURL:     detail.ProviderBaseURL,
 		ProviderAPIPrefix:   detail.ProviderAPIPrefix,
+		ProviderType:        detail.ProviderType,
+		ProviderAPIVersion:  detail.ProviderAPIVersion,
 		Username:            detail.Username,
 		ProviderKey:         detail.ProviderKey,
+		Fallbacks:           detail.Fallbacks,
+		Availability:        availability,
 	}
 }
 
@@ -272,9 +311,11 @@ func (c *MemoryCache) LoadAPIKeys(apiKeysWithUsers []models.APIKeyWithUser) {
 	c.apiKeys = make(map[string]*APIKeyCacheItem, len(apiKeysWithUsers))
 	for _, item := range apiKeysWithUsers {
 		c.apiKeys[item.APIKey] = &APIKeyCacheItem{
+			ID:      item.ID,
 			UserID:  item.UserID,
 			Prompt:  item.Prompt,
 			Prompts: make(map[string]string), // 预分配以避免后续动态扩展
+			limiter: newAPIKeyLimiter(item.APIKeyLimits),
 		}
 	}
 }
@@ -297,17 +338,36 @@ func (c *MemoryCache) LoadAPIKeyPrompts(apiKeyIDToKey map[uint64]string, prompts
 }
 
 // AddAPIKey 添加API密钥到缓存
-func (c *MemoryCache) AddAPIKey(apiKey string, userID uint64, prompt string) {
+func (c *MemoryCache) AddAPIKey(apiKeyID uint64, apiKey string, userID uint64, prompt string, limits models.APIKeyLimits) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	c.apiKeys[apiKey] = &APIKeyCacheItem{
+		ID:      apiKeyID,
 		UserID:  userID,
 		Prompt:  prompt,
 		Prompts: make(map[string]string),
+		limiter: newAPIKeyLimiter(limits),
 	}
 }
 
+// UpdateAPIKey 更新缓存中API密钥的提示词和限额
+// 在原有限流器上修改限额，已消耗的额度、进行中的流式请求数和工具提示词保持不变；密钥不在缓存中时添加
+func (c *MemoryCache) UpdateAPIKey(apiKeyID uint64, apiKey string, userID uint64, prompt string, limits models.APIKeyLimits) {
+	c.mu.Lock()
+	item, ok := c.apiKeys[apiKey]
+	if ok {
+		item.Prompt = prompt
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		c.AddAPIKey(apiKeyID, apiKey, userID, prompt, limits)
+		return
+	}
+	item.limiter.setLimits(limits)
+}
+
 // DeleteAPIKey 从缓存中删除API密钥
 func (c *MemoryCache) DeleteAPIKey(apiKey string) {
 	c.mu.Lock()
@@ -327,6 +387,17 @@ func (c *MemoryCache) GetUserIDByAPIKey(apiKey string) (uint64, bool) {
 	return 0, false
 }
 
+// GetAPIKeyID 根据API密钥获取密钥记录ID
+func (c *MemoryCache) GetAPIKeyID(apiKey string) (uint64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if item, ok := c.apiKeys[apiKey]; ok {
+		return item.ID, true
+	}
+	return 0, false
+}
+
 // GetAPIKeyPrompt 根据API密钥获取提示词
 func (c *MemoryCache) GetAPIKeyPrompt(apiKey string) (string, bool) {
 	c.mu.RLock()
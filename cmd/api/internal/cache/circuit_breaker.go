@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// 熔断器配置
+const (
+	CircuitFailureThreshold = 5                // 连续失败多少次后熔断
+	CircuitOpenDuration     = 30 * time.Second // 熔断后多久开始探测，也是试探请求未上报结果时重新放行的间隔
+)
+
+// circuitBreaker 熔断器，零值为正常状态
+type circuitBreaker struct {
+	state       string
+	failures    int // 连续失败次数
+	openedAt    time.Time
+	trialAt     time.Time // 探测中放行试探请求的时间，零值表示没有进行中的试探请求
+	lastError   string
+	lastFailure time.Time
+	lastSuccess time.Time
+}
+
+// available 是否处于正常状态，熔断和探测中均为 false
+func (b *circuitBreaker) available() bool {
+	return b.state == "" || b.state == models.CircuitClosed
+}
+
+// allows 是否允许请求通过：正常时允许；熔断时间已到且没有进行中的试探请求时允许一个试探请求
+func (b *circuitBreaker) allows(now time.Time) bool {
+	switch b.state {
+	case "", models.CircuitClosed:
+		return true
+	case models.CircuitOpen:
+		return now.Sub(b.openedAt) >= CircuitOpenDuration
+	default:
+		return b.trialAt.IsZero() || now.Sub(b.trialAt) >= CircuitOpenDuration
+	}
+}
+
+// acquire 允许请求通过时返回 true；熔断时间已到时转为探测中，并将本次请求作为试探请求
+func (b *circuitBreaker) acquire(now time.Time) bool {
+	if !b.allows(now) {
+		return false
+	}
+	if !b.available() {
+		b.state = models.CircuitHalfOpen
+		b.trialAt = now
+	}
+	return true
+}
+
+// reopen 重新熔断
+func (b *circuitBreaker) reopen(now time.Time) {
+	b.state = models.CircuitOpen
+	b.openedAt = now
+	b.trialAt = time.Time{}
+}
+
+// success 请求成功，恢复正常并清零连续失败次数
+func (b *circuitBreaker) success(now time.Time) {
+	b.state = models.CircuitClosed
+	b.failures = 0
+	b.trialAt = time.Time{}
+	b.lastSuccess = now
+}
+
+// failure 请求失败，连续失败达到阈值或探测中的试探请求失败时熔断，返回是否由本次失败触发熔断
+func (b *circuitBreaker) failure(reason string, now time.Time) bool {
+	b.failures++
+	b.lastError = reason
+	b.lastFailure = now
+	if b.state == models.CircuitHalfOpen || (b.available() && b.failures >= CircuitFailureThreshold) {
+		b.reopen(now)
+		return true
+	}
+	return false
+}
+
+// probeDue 熔断时间已到时转为探测中，返回是否需要探测
+func (b *circuitBreaker) probeDue(now time.Time) bool {
+	if b.state != models.CircuitOpen || now.Sub(b.openedAt) < CircuitOpenDuration {
+		return false
+	}
+	b.state = models.CircuitHalfOpen
+	return true
+}
+
+// probeResult 记录探测结果，失败时重新熔断
+func (b *circuitBreaker) probeResult(ok bool, reason string, now time.Time) {
+	if ok {
+		b.success(now)
+		return
+	}
+	b.reopen(now)
+	b.lastError = reason
+	b.lastFailure = now
+}
+
+// status 返回对外展示的状态
+func (b *circuitBreaker) status() models.CircuitStatus {
+	status := models.CircuitStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if status.State == "" {
+		status.State = models.CircuitClosed
+	}
+	if b.state == models.CircuitOpen || b.state == models.CircuitHalfOpen {
+		openedAt := b.openedAt
+		nextProbe := b.openedAt.Add(CircuitOpenDuration)
+		status.OpenedAt = &openedAt
+		status.NextProbeAt = &nextProbe
+	}
+	if !b.lastFailure.IsZero() {
+		lastFailure := b.lastFailure
+		status.LastFailureAt = &lastFailure
+	}
+	if !b.lastSuccess.IsZero() {
+		lastSuccess := b.lastSuccess
+		status.LastSuccessAt = &lastSuccess
+	}
+	return status
+}
+
+// ProbeTarget 需要探测的厂商或厂商密钥，KeyID 为 0 表示探测厂商本身
+type ProbeTarget struct {
+	ProviderID uint64
+	KeyID      uint64
+	APIKey     string // 探测密钥时使用的密钥
+}
+
+// providerBreaker 返回厂商的熔断器，不存在时创建（调用方需持有写锁）
+func (c *MemoryCache) providerBreaker(providerID uint64) *circuitBreaker {
+	breaker, ok := c.providerBreakers[providerID]
+	if !ok {
+		breaker = &circuitBreaker{}
+		c.providerBreakers[providerID] = breaker
+	}
+	return breaker
+}
+
+// findProviderKey 查找厂商密钥池中的密钥（调用方需持有锁）
+func (c *MemoryCache) findProviderKey(providerID, keyID uint64) *ProviderKeyCacheItem {
+	for _, item := range c.providerKeys[providerID] {
+		if item.ID == keyID {
+			return item
+		}
+	}
+	return nil
+}
+
+// ProviderAvailable 厂商是否允许请求通过：未熔断，或熔断时间已到、可以放行一个试探请求
+func (c *MemoryCache) ProviderAvailable(providerID uint64) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	breaker, ok := c.providerBreakers[providerID]
+	return !ok || breaker.allows(time.Now())
+}
+
+// AcquireProvider 请求厂商前调用，返回是否允许请求通过
+// 熔断时间已到时厂商转为探测中，本次请求作为试探请求：成功后恢复，失败则重新熔断；
+// 同一时间只放行一个试探请求，试探请求未上报结果时 CircuitOpenDuration 后重新放行
+func (c *MemoryCache) AcquireProvider(providerID uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	breaker, ok := c.providerBreakers[providerID]
+	return !ok || breaker.acquire(time.Now())
+}
+
+// ReportProviderSuccess 记录一次成功的厂商请求，keyID 为 0 表示使用厂商默认密钥
+func (c *MemoryCache) ReportProviderSuccess(providerID, keyID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	c.providerBreaker(providerID).success(now)
+	if item := c.findProviderKey(providerID, keyID); item != nil {
+		item.breaker.success(now)
+	}
+}
+
+// ReportProviderFailure 记录一次失败的厂商请求
+// 失败总是计入所用密钥的熔断器；providerFault 为 true 时（网络错误、502/503/504）同时计入厂商的熔断器
+// 返回厂商或密钥是否由本次失败触发熔断
+func (c *MemoryCache) ReportProviderFailure(providerID, keyID uint64, reason string, providerFault bool) (providerOpened, keyOpened bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if providerFault {
+		providerOpened = c.providerBreaker(providerID).failure(reason, now)
+	}
+	if item := c.findProviderKey(providerID, keyID); item != nil {
+		keyOpened = item.breaker.failure(reason, now)
+	}
+	return providerOpened, keyOpened
+}
+
+// DueProbes 返回熔断时间已到、需要探测的厂商和密钥，并将它们标记为探测中
+func (c *MemoryCache) DueProbes() []ProbeTarget {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+
+	var targets []ProbeTarget
+	for providerID, breaker := range c.providerBreakers {
+		if breaker.probeDue(now) {
+			targets = append(targets, ProbeTarget{ProviderID: providerID})
+		}
+	}
+	for providerID, pool := range c.providerKeys {
+		for _, item := range pool {
+			if item.breaker.probeDue(now) {
+				targets = append(targets, ProbeTarget{ProviderID: providerID, KeyID: item.ID, APIKey: item.APIKey})
+			}
+		}
+	}
+	return targets
+}
+
+// ReportProbeResult 记录探测结果，成功时恢复正常，失败时重新熔断
+func (c *MemoryCache) ReportProbeResult(target ProbeTarget, ok bool, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if target.KeyID == 0 {
+		c.providerBreaker(target.ProviderID).probeResult(ok, reason, now)
+		return
+	}
+	if item := c.findProviderKey(target.ProviderID, target.KeyID); item != nil {
+		item.breaker.probeResult(ok, reason, now)
+	}
+}
+
+// DeleteProviderBreaker 删除厂商的熔断状态
+func (c *MemoryCache) DeleteProviderBreaker(providerID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.providerBreakers, providerID)
+}
+
+// GetProviderHealth 返回厂商及其启用密钥的熔断状态
+func (c *MemoryCache) GetProviderHealth(providerID uint64) models.ProviderHealth {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	health := models.ProviderHealth{ProviderID: providerID, Keys: []models.ProviderKeyHealth{}}
+	if breaker, ok := c.providerBreakers[providerID]; ok {
+		health.CircuitStatus = breaker.status()
+	} else {
+		health.CircuitStatus = (&circuitBreaker{}).status()
+	}
+	for _, item := range c.providerKeys[providerID] {
+		health.Keys = append(health.Keys, models.ProviderKeyHealth{KeyID: item.ID, CircuitStatus: item.breaker.status()})
+	}
+	return health
+}
@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+func TestCircuitBreakerTrialRequest(t *testing.T) {
+	start := time.Unix(0, 0)
+	b := &circuitBreaker{}
+	for i := 0; i < CircuitFailureThreshold; i++ {
+		b.failure("厂商返回 503", start)
+	}
+	if b.state != models.CircuitOpen {
+		t.Fatalf("state = %q, want open", b.state)
+	}
+	if b.acquire(start.Add(time.Second)) {
+		t.Fatal("熔断时间内放行了请求")
+	}
+
+	// 熔断时间已到：放行一个试探请求，其他请求等待试探结果
+	due := start.Add(CircuitOpenDuration)
+	if !b.acquire(due) {
+		t.Fatal("熔断时间已到未放行试探请求")
+	}
+	if b.state != models.CircuitHalfOpen {
+		t.Fatalf("state = %q, want half_open", b.state)
+	}
+	if b.acquire(due.Add(time.Second)) {
+		t.Fatal("同时放行了多个试探请求")
+	}
+
+	// 试探请求失败时重新熔断
+	if !b.failure("厂商返回 503", due.Add(time.Second)) || b.state != models.CircuitOpen {
+		t.Fatalf("试探失败后 state = %q, want open", b.state)
+	}
+
+	// 试探请求未上报结果时，超时后重新放行
+	due = due.Add(time.Second + CircuitOpenDuration)
+	if !b.acquire(due) {
+		t.Fatal("未放行试探请求")
+	}
+	if !b.acquire(due.Add(CircuitOpenDuration)) {
+		t.Fatal("试探请求超时后未重新放行")
+	}
+
+	// 试探请求成功时恢复
+	b.success(due.Add(CircuitOpenDuration))
+	if b.state != models.CircuitClosed || b.failures != 0 || !b.acquire(due.Add(CircuitOpenDuration)) {
+		t.Errorf("试探成功后 state = %q, failures = %d", b.state, b.failures)
+	}
+}
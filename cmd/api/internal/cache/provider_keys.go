@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// ProviderKeyCacheItem 厂商密钥缓存项（含负载均衡运行时状态）
+type ProviderKeyCacheItem struct {
+	ID            uint64
+	ProviderID    uint64
+	APIKey        string
+	Weight        int
+	Cooldown      time.Duration  // 被厂商拒绝后暂停使用的时长
+	currentWeight int            // 平滑加权轮询的当前权重
+	cooldownUntil time.Time      // 冷却结束时间，零值表示可用
+	breaker       circuitBreaker // 连续失败后熔断，由健康探测恢复
+}
+
+// newProviderKeyCacheItem 创建厂商密钥缓存项
+func newProviderKeyCacheItem(key *models.ProviderKey) *ProviderKeyCacheItem {
+	weight := key.Weight
+	if weight < 1 {
+		weight = 1
+	}
+	return &ProviderKeyCacheItem{
+		ID:         key.ID,
+		ProviderID: key.ProviderID,
+		APIKey:     key.APIKey,
+		Weight:     weight,
+		Cooldown:   time.Duration(key.CooldownSeconds) * time.Second,
+	}
+}
+
+// usable 密钥是否可用（未冷却且未熔断）
+func (item *ProviderKeyCacheItem) usable(now time.Time) bool {
+	return !now.Before(item.cooldownUntil) && item.breaker.available()
+}
+
+// buildProviderKeyPool 构建厂商的密钥池，只保留启用的密钥
+// 密钥ID和密钥值都未改变时保留原有的轮询权重、冷却和熔断状态
+func buildProviderKeyPool(keys []*models.ProviderKey, existing []*ProviderKeyCacheItem) []*ProviderKeyCacheItem {
+	previous := make(map[uint64]*ProviderKeyCacheItem, len(existing))
+	for _, item := range existing {
+		previous[item.ID] = item
+	}
+
+	pool := make([]*ProviderKeyCacheItem, 0, len(keys))
+	for _, key := range keys {
+		if !key.IsActive {
+			continue
+		}
+		item := newProviderKeyCacheItem(key)
+		if old, ok := previous[key.ID]; ok && old.APIKey == key.APIKey {
+			item.currentWeight = old.currentWeight
+			item.cooldownUntil = old.cooldownUntil
+			item.breaker = old.breaker
+		}
+		pool = append(pool, item)
+	}
+	return pool
+}
+
+// LoadProviderKeys 加载所有厂商密钥到缓存
+func (c *MemoryCache) LoadProviderKeys(keys []*models.ProviderKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	byProvider := make(map[uint64][]*models.ProviderKey)
+	for _, key := range keys {
+		byProvider[key.ProviderID] = append(byProvider[key.ProviderID], key)
+	}
+
+	providerKeys := make(map[uint64][]*ProviderKeyCacheItem, len(byProvider))
+	for providerID, providerKeyList := range byProvider {
+		if pool := buildProviderKeyPool(providerKeyList, c.providerKeys[providerID]); len(pool) > 0 {
+			providerKeys[providerID] = pool
+		}
+	}
+	c.providerKeys = providerKeys
+}
+
+// SetProviderKeys 替换单个厂商的密钥池
+func (c *MemoryCache) SetProviderKeys(providerID uint64, keys []*models.ProviderKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	pool := buildProviderKeyPool(keys, c.providerKeys[providerID])
+	if len(pool) == 0 {
+		delete(c.providerKeys, providerID)
+		return
+	}
+	c.providerKeys[providerID] = pool
+}
+
+// NextProviderKey 按平滑加权轮询选择厂商的下一个可用密钥
+// 厂商未配置密钥或所有密钥都在冷却或熔断中时返回 false
+func (c *MemoryCache) NextProviderKey(providerID uint64) (uint64, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var selected *ProviderKeyCacheItem
+	totalWeight := 0
+	for _, item := range c.providerKeys[providerID] {
+		if !item.usable(now) {
+			continue
+		}
+		item.currentWeight += item.Weight
+		totalWeight += item.Weight
+		if selected == nil || item.currentWeight > selected.currentWeight {
+			selected = item
+		}
+	}
+	if selected == nil {
+		return 0, "", false
+	}
+
+	selected.currentWeight -= totalWeight
+	return selected.ID, selected.APIKey, true
+}
+
+// CooldownProviderKey 暂停使用厂商密钥
+// duration 小于密钥配置的冷却时长时使用配置值
+func (c *MemoryCache) CooldownProviderKey(providerID, keyID uint64, duration time.Duration) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, item := range c.providerKeys[providerID] {
+		if item.ID != keyID {
+			continue
+		}
+		if duration < item.Cooldown {
+			duration = item.Cooldown
+		}
+		item.cooldownUntil = time.Now().Add(duration)
+		item.currentWeight = 0
+		return item.cooldownUntil
+	}
+	return time.Time{}
+}
+
+// GetProviderKeyCooldowns 获取厂商中正在冷却的密钥（密钥ID -> 冷却结束时间）
+func (c *MemoryCache) GetProviderKeyCooldowns(providerID uint64) map[uint64]time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	result := make(map[uint64]time.Time)
+	for _, item := range c.providerKeys[providerID] {
+		if now.Before(item.cooldownUntil) {
+			result[item.ID] = item.cooldownUntil
+		}
+	}
+	return result
+}
+
+// GetAvailableProviderKeyCount 获取厂商当前可用（未冷却且未熔断）的密钥数量
+func (c *MemoryCache) GetAvailableProviderKeyCount(providerID uint64) int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	count := 0
+	for _, item := range c.providerKeys[providerID] {
+		if item.usable(now) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"github.com/model-system/api/internal/models"
+)
+
+// LoadProviderPolicies 加载所有厂商的超时和重试配置到缓存
+func (c *MemoryCache) LoadProviderPolicies(providers []*models.Provider) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.providerPolicies = make(map[uint64]models.ProviderPolicy, len(providers))
+	for _, provider := range providers {
+		c.providerPolicies[provider.ID] = provider.ProviderPolicy.Parsed()
+	}
+}
+
+// SetProviderPolicy 更新单个厂商的超时和重试配置
+func (c *MemoryCache) SetProviderPolicy(providerID uint64, policy models.ProviderPolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providerPolicies[providerID] = policy.Parsed()
+}
+
+// DeleteProviderPolicy 删除厂商的超时和重试配置
+func (c *MemoryCache) DeleteProviderPolicy(providerID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.providerPolicies, providerID)
+}
+
+// GetProviderPolicy 获取厂商的超时和重试配置，未加载时返回零值（全部使用默认值）
+func (c *MemoryCache) GetProviderPolicy(providerID uint64) models.ProviderPolicy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.providerPolicies[providerID]
+}
@@ -0,0 +1,170 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// sortQuotasByID 按 ID 升序排序配额
+func sortQuotasByID(quotas []models.Quota) {
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].ID < quotas[j].ID
+	})
+}
+
+// LoadQuotas 加载所有用量配额到缓存
+func (c *MemoryCache) LoadQuotas(quotas []*models.Quota) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.quotas = make(map[uint64]*models.Quota, len(quotas))
+	for _, quota := range quotas {
+		item := *quota
+		c.quotas[quota.ID] = &item
+	}
+}
+
+// SetQuota 添加或更新缓存中的用量配额
+func (c *MemoryCache) SetQuota(quota *models.Quota) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	item := *quota
+	c.quotas[quota.ID] = &item
+}
+
+// DeleteQuota 从缓存中删除用量配额
+func (c *MemoryCache) DeleteQuota(quotaID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.quotas, quotaID)
+}
+
+// quotaApplies 判断配额是否作用于该用户的该API密钥
+func quotaApplies(quota *models.Quota, userID, apiKeyID uint64) bool {
+	if quota.UserID != userID {
+		return false
+	}
+	return quota.APIKeyID == 0 || quota.APIKeyID == apiKeyID
+}
+
+// GetQuotas 获取作用于该用户的该API密钥的配额（已按当前时间滚动周期）
+// apiKeyID 为 0 时只返回用户级配额
+func (c *MemoryCache) GetQuotas(userID, apiKeyID uint64) []models.Quota {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	var result []models.Quota
+	for _, quota := range c.quotas {
+		if !quotaApplies(quota, userID, apiKeyID) {
+			continue
+		}
+		item := *quota
+		item.Refresh(now)
+		result = append(result, item)
+	}
+	sortQuotasByID(result)
+	return result
+}
+
+// QuotaReservation 请求进行中预占的配额用量（quota_id -> 预占用量），请求结束后由 AddQuotaUsage 释放
+type QuotaReservation map[uint64]float64
+
+// ReserveQuotas 检查并预占作用于该用户的该API密钥的配额
+// amounts 为各限额类型的本次预估用量，任一配额扣除进行中请求的预占后剩余不足时不预占，返回该配额
+func (c *MemoryCache) ReserveQuotas(userID, apiKeyID uint64, amounts map[string]float64) (QuotaReservation, *models.Quota) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var applied []*models.Quota
+	for _, quota := range c.quotas {
+		if quotaApplies(quota, userID, apiKeyID) {
+			applied = append(applied, quota)
+		}
+	}
+	sort.Slice(applied, func(i, j int) bool {
+		return applied[i].ID < applied[j].ID
+	})
+
+	for _, quota := range applied {
+		quota.Refresh(now)
+		available := quota.Remaining - quota.Reserved
+		if available <= 0 || amounts[quota.LimitType] > available {
+			item := *quota
+			return nil, &item
+		}
+	}
+
+	reservation := make(QuotaReservation, len(applied))
+	for _, quota := range applied {
+		amount := amounts[quota.LimitType]
+		quota.Reserved += amount
+		reservation[quota.ID] = amount
+	}
+	return reservation, nil
+}
+
+// AddQuotaUsage 释放请求的预占并累加作用于该用户的该API密钥的配额用量
+// amounts 为各限额类型的本次用量，返回更新后的配额供持久化
+func (c *MemoryCache) AddQuotaUsage(userID, apiKeyID uint64, amounts map[string]float64, reservation QuotaReservation) []models.Quota {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	var updated []models.Quota
+	for _, quota := range c.quotas {
+		if !quotaApplies(quota, userID, apiKeyID) {
+			continue
+		}
+		// 释放本次请求的预占
+		if reserved, ok := reservation[quota.ID]; ok {
+			quota.Reserved = math.Max(0, quota.Reserved-reserved)
+		}
+		amount, ok := amounts[quota.LimitType]
+		if !ok || amount <= 0 {
+			continue
+		}
+		quota.Refresh(now)
+		quota.UsedValue += amount
+		quota.Refresh(now)
+		updated = append(updated, *quota)
+	}
+	return updated
+}
+
+// GetUserQuotas 获取用户的所有配额（含各API密钥的配额，已按当前时间滚动周期）
+func (c *MemoryCache) GetUserQuotas(userID uint64) []models.Quota {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now := time.Now()
+	var result []models.Quota
+	for _, quota := range c.quotas {
+		if quota.UserID != userID {
+			continue
+		}
+		item := *quota
+		item.Refresh(now)
+		result = append(result, item)
+	}
+	sortQuotasByID(result)
+	return result
+}
+
+// DeleteAPIKeyQuotas 从缓存中删除API密钥的所有配额
+func (c *MemoryCache) DeleteAPIKeyQuotas(apiKeyID uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for id, quota := range c.quotas {
+		if quota.APIKeyID == apiKeyID {
+			delete(c.quotas, id)
+		}
+	}
+}
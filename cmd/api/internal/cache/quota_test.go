@@ -0,0 +1,54 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+func TestReserveQuotas(t *testing.T) {
+	c := &MemoryCache{quotas: make(map[uint64]*models.Quota)}
+	start := models.QuotaPeriodStart(models.QuotaPeriodDaily, time.Now())
+	c.SetQuota(&models.Quota{ID: 1, UserID: 1, Period: models.QuotaPeriodDaily, LimitType: models.QuotaLimitTokens, LimitValue: 1000, UsedValue: 400, PeriodStart: start})
+	c.SetQuota(&models.Quota{ID: 2, UserID: 1, APIKeyID: 9, Period: models.QuotaPeriodDaily, LimitType: models.QuotaLimitCost, LimitValue: 1, PeriodStart: start})
+	tokens := func(n float64) map[string]float64 {
+		return map[string]float64{models.QuotaLimitTokens: n}
+	}
+
+	// 进行中请求的预占计入剩余用量
+	first, exceeded := c.ReserveQuotas(1, 1, tokens(500))
+	if exceeded != nil {
+		t.Fatalf("第一个请求被拒绝: %+v", exceeded)
+	}
+	if _, exceeded := c.ReserveQuotas(1, 1, tokens(200)); exceeded == nil || exceeded.ID != 1 {
+		t.Fatalf("超出剩余用量的并发请求未被拒绝: %+v", exceeded)
+	}
+	second, exceeded := c.ReserveQuotas(1, 1, tokens(100))
+	if exceeded != nil {
+		t.Fatalf("剩余用量内的并发请求被拒绝: %+v", exceeded)
+	}
+	if _, exceeded := c.ReserveQuotas(1, 1, tokens(0)); exceeded == nil {
+		t.Fatal("预占用完后未拒绝新请求")
+	}
+
+	// 结算时释放预占，按实际用量累计
+	c.AddQuotaUsage(1, 1, tokens(300), first)
+	c.AddQuotaUsage(1, 1, tokens(0), second)
+	quota := c.GetQuotas(1, 1)[0]
+	if quota.UsedValue != 700 || quota.Reserved != 0 || quota.Remaining != 300 {
+		t.Errorf("结算后 used = %v, reserved = %v, remaining = %v", quota.UsedValue, quota.Reserved, quota.Remaining)
+	}
+
+	// 只作用于其他密钥的配额不参与预占
+	reservation, exceeded := c.ReserveQuotas(1, 1, map[string]float64{models.QuotaLimitTokens: 100, models.QuotaLimitCost: 5})
+	if exceeded != nil {
+		t.Fatalf("请求被其他密钥的配额拒绝: %+v", exceeded)
+	}
+	if _, ok := reservation[2]; ok {
+		t.Error("预占了其他密钥的配额")
+	}
+	if _, exceeded := c.ReserveQuotas(1, 9, map[string]float64{models.QuotaLimitCost: 5}); exceeded == nil || exceeded.ID != 2 {
+		t.Errorf("超出费用配额的请求未被拒绝: %+v", exceeded)
+	}
+}
@@ -0,0 +1,244 @@
+package cache
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// tokenBucket 令牌桶，容量为每分钟限额，按秒匀速补充
+// 可用量允许为负数（先用后扣的 token 超额），补充回正数前拒绝新请求
+type tokenBucket struct {
+	capacity  float64
+	available float64
+	updated   time.Time
+}
+
+// newTokenBucket 创建令牌桶，perMinute 不大于 0 时返回 nil（不限制）
+func newTokenBucket(perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &tokenBucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		updated:   now,
+	}
+}
+
+// refill 按经过的时间补充令牌
+func (b *tokenBucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	b.available = math.Min(b.capacity, b.available+elapsed*b.capacity/60)
+	b.updated = now
+}
+
+// waitFor 返回可用量补充到 need 所需的时间
+func (b *tokenBucket) waitFor(need float64) time.Duration {
+	if b.available >= need {
+		return 0
+	}
+	seconds := (need - b.available) * 60 / b.capacity
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+// remaining 返回当前可用量（不小于 0）
+func (b *tokenBucket) remaining() int {
+	if b.available <= 0 {
+		return 0
+	}
+	return int(b.available)
+}
+
+// apiKeyLimiter 单个API密钥的限流状态
+type apiKeyLimiter struct {
+	mu       sync.Mutex
+	limits   models.APIKeyLimits
+	requests *tokenBucket
+	tokens   *tokenBucket
+	streams  int // 进行中的流式请求数
+}
+
+// newAPIKeyLimiter 创建API密钥限流器
+func newAPIKeyLimiter(limits models.APIKeyLimits) *apiKeyLimiter {
+	now := time.Now()
+	return &apiKeyLimiter{
+		limits:   limits,
+		requests: newTokenBucket(limits.RPMLimit, now),
+		tokens:   newTokenBucket(limits.TPMLimit, now),
+	}
+}
+
+// resizeBucket 按新的每分钟限额调整令牌桶，保留已消耗的额度
+// 新限额不大于 0 时返回 nil（不限制），原来不限制时创建满额的桶
+func resizeBucket(b *tokenBucket, perMinute int, now time.Time) *tokenBucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	if b == nil {
+		return newTokenBucket(perMinute, now)
+	}
+	b.refill(now)
+	b.capacity = float64(perMinute)
+	b.available = math.Min(b.available, b.capacity)
+	return b
+}
+
+// setLimits 修改限额，已消耗的额度和进行中的流式请求数保持不变
+func (l *apiKeyLimiter) setLimits(limits models.APIKeyLimits) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.limits = limits
+	l.requests = resizeBucket(l.requests, limits.RPMLimit, now)
+	l.tokens = resizeBucket(l.tokens, limits.TPMLimit, now)
+}
+
+// RateLimitStatus 当前限额状态，用于返回 x-ratelimit-* 响应头
+// Limit 为 0 表示该维度不限制
+type RateLimitStatus struct {
+	LimitRequests     int
+	RemainingRequests int
+	ResetRequests     time.Duration // 请求数恢复到满额所需时间
+	LimitTokens       int
+	RemainingTokens   int
+	ResetTokens       time.Duration // token 数恢复到满额所需时间
+}
+
+// RateLimitError 超出限额时的错误信息
+type RateLimitError struct {
+	Kind       string // requests、tokens、request_tokens 或 streams
+	Limit      int
+	Requested  int // 单次请求的预估 token 数（request_tokens）
+	RetryAfter time.Duration
+	Status     RateLimitStatus
+}
+
+// Error 返回与 OpenAI 一致的限流提示
+func (e *RateLimitError) Error() string {
+	// 超过 1 秒时向上取整到秒
+	wait := e.RetryAfter.Round(time.Millisecond)
+	if wait > time.Second {
+		wait = time.Duration(math.Ceil(wait.Seconds())) * time.Second
+	}
+	switch e.Kind {
+	case "requests":
+		return fmt.Sprintf("Rate limit reached for requests per minute (RPM): Limit %d. Please try again in %s.", e.Limit, wait)
+	case "tokens":
+		return fmt.Sprintf("Rate limit reached for tokens per minute (TPM): Limit %d. Please try again in %s.", e.Limit, wait)
+	case "request_tokens":
+		return fmt.Sprintf("Request too large for tokens per minute (TPM): Limit %d, Requested %d. Please reduce the length of the messages.", e.Limit, e.Requested)
+	default:
+		return fmt.Sprintf("Too many concurrent streaming requests: Limit %d. Please try again after an existing stream finishes.", e.Limit)
+	}
+}
+
+// status 生成当前限额状态（调用方需持有锁）
+func (l *apiKeyLimiter) status() RateLimitStatus {
+	var status RateLimitStatus
+	if l.requests != nil {
+		status.LimitRequests = l.limits.RPMLimit
+		status.RemainingRequests = l.requests.remaining()
+		status.ResetRequests = l.requests.waitFor(l.requests.capacity)
+	}
+	if l.tokens != nil {
+		status.LimitTokens = l.limits.TPMLimit
+		status.RemainingTokens = l.tokens.remaining()
+		status.ResetTokens = l.tokens.waitFor(l.tokens.capacity)
+	}
+	return status
+}
+
+// APIKeyLimit 单次请求占用的限额，请求结束后需调用 Release
+type APIKeyLimit struct {
+	limiter *apiKeyLimiter
+	stream  bool
+	once    sync.Once
+	Status  RateLimitStatus
+}
+
+// ConsumeTokens 扣除本次请求实际消耗的 token 数
+func (l *APIKeyLimit) ConsumeTokens(tokens int) {
+	if l == nil || l.limiter == nil || tokens <= 0 {
+		return
+	}
+
+	l.limiter.mu.Lock()
+	defer l.limiter.mu.Unlock()
+
+	if l.limiter.tokens != nil {
+		l.limiter.tokens.refill(time.Now())
+		l.limiter.tokens.available -= float64(tokens)
+	}
+}
+
+// Release 释放本次请求占用的并发名额，可重复调用
+func (l *APIKeyLimit) Release() {
+	if l == nil || l.limiter == nil || !l.stream {
+		return
+	}
+
+	l.once.Do(func() {
+		l.limiter.mu.Lock()
+		defer l.limiter.mu.Unlock()
+
+		l.limiter.streams--
+	})
+}
+
+// AcquireAPIKeyLimit 检查并占用API密钥的请求限额
+// estimatedTokens 为请求的预估输入 token 数，剩余的每分钟token数不足时拒绝，避免单个请求大幅透支；
+// 超出每分钟请求数、每分钟token数或流式并发数时返回 *RateLimitError
+func (c *MemoryCache) AcquireAPIKeyLimit(apiKey string, stream bool, estimatedTokens int) (*APIKeyLimit, error) {
+	c.mu.RLock()
+	item, ok := c.apiKeys[apiKey]
+	c.mu.RUnlock()
+	if !ok || item.limiter == nil {
+		return &APIKeyLimit{}, nil
+	}
+
+	l := item.limiter
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.requests != nil {
+		l.requests.refill(now)
+	}
+	if l.tokens != nil {
+		l.tokens.refill(now)
+	}
+
+	if stream && l.limits.MaxConcurrentStreams > 0 && l.streams >= l.limits.MaxConcurrentStreams {
+		return nil, &RateLimitError{Kind: "streams", Limit: l.limits.MaxConcurrentStreams, RetryAfter: time.Second, Status: l.status()}
+	}
+	if l.requests != nil && l.requests.available < 1 {
+		return nil, &RateLimitError{Kind: "requests", Limit: l.limits.RPMLimit, RetryAfter: l.requests.waitFor(1), Status: l.status()}
+	}
+	if l.tokens != nil {
+		// 超过每分钟限额的请求永远无法满足，直接拒绝
+		if float64(estimatedTokens) > l.tokens.capacity {
+			return nil, &RateLimitError{Kind: "request_tokens", Limit: l.limits.TPMLimit, Requested: estimatedTokens, Status: l.status()}
+		}
+		need := math.Max(1, float64(estimatedTokens))
+		if l.tokens.available < need {
+			return nil, &RateLimitError{Kind: "tokens", Limit: l.limits.TPMLimit, RetryAfter: l.tokens.waitFor(need), Status: l.status()}
+		}
+	}
+
+	if l.requests != nil {
+		l.requests.available--
+	}
+	if stream {
+		l.streams++
+	}
+
+	return &APIKeyLimit{limiter: l, stream: stream, Status: l.status()}, nil
+}
@@ -0,0 +1,160 @@
+package cache
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+func TestTokenBucket(t *testing.T) {
+	start := time.Unix(0, 0)
+	tests := []struct {
+		name      string
+		perMinute int
+		spend     float64
+		elapsed   time.Duration
+		want      float64
+		wantWait  time.Duration // 补充到满额所需时间
+	}{
+		{"满额", 60, 0, 0, 60, 0},
+		{"按秒补充", 60, 30, 10 * time.Second, 40, 20 * time.Second},
+		{"补充不超过容量", 60, 10, time.Minute, 60, 0},
+		{"透支后补充", 60, 90, 15 * time.Second, -15, 75 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.perMinute, start)
+			b.available -= tt.spend
+			b.refill(start.Add(tt.elapsed))
+			if b.available != tt.want {
+				t.Errorf("available = %v, want %v", b.available, tt.want)
+			}
+			if got := b.waitFor(b.capacity); got != tt.wantWait {
+				t.Errorf("waitFor = %v, want %v", got, tt.wantWait)
+			}
+		})
+	}
+
+	if b := newTokenBucket(0, start); b != nil {
+		t.Errorf("newTokenBucket(0) = %v, want nil", b)
+	}
+}
+
+func TestResizeBucket(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name      string
+		perMinute int // 原限额，0 表示不限制
+		spend     float64
+		newLimit  int
+		want      float64 // 调整后的可用量，-1 表示不限制
+	}{
+		{"提高限额保留已消耗", 100, 40, 200, 60},
+		{"降低限额不超过新容量", 100, 10, 50, 50},
+		{"透支保持透支", 100, 150, 200, -50},
+		{"改为不限制", 100, 10, 0, -1},
+		{"原来不限制", 0, 0, 30, 30},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTokenBucket(tt.perMinute, now)
+			if b != nil {
+				b.available -= tt.spend
+			}
+			b = resizeBucket(b, tt.newLimit, now)
+			if tt.want == -1 {
+				if b != nil {
+					t.Fatalf("bucket = %+v, want nil", b)
+				}
+				return
+			}
+			if b == nil {
+				t.Fatal("bucket = nil")
+			}
+			if b.available != tt.want || b.capacity != float64(tt.newLimit) {
+				t.Errorf("bucket = %v/%v, want %v/%d", b.available, b.capacity, tt.want, tt.newLimit)
+			}
+		})
+	}
+}
+
+func TestAcquireAPIKeyLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   models.APIKeyLimits
+		consumed int // 之前请求已消耗的 token 数
+		tokens   int
+		stream   bool
+		wantKind string // 空字符串表示通过
+	}{
+		{"不限制", models.APIKeyLimits{}, 0, 100000, false, ""},
+		{"额度充足", models.APIKeyLimits{TPMLimit: 1000}, 200, 500, false, ""},
+		{"剩余额度不足", models.APIKeyLimits{TPMLimit: 1000}, 600, 500, false, "tokens"},
+		{"已透支", models.APIKeyLimits{TPMLimit: 1000}, 1200, 0, false, "tokens"},
+		{"超过整个限额", models.APIKeyLimits{TPMLimit: 1000}, 0, 1001, false, "request_tokens"},
+		{"请求数充足", models.APIKeyLimits{RPMLimit: 1}, 0, 0, false, ""},
+		{"流式并发", models.APIKeyLimits{MaxConcurrentStreams: 1}, 0, 0, true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &MemoryCache{apiKeys: map[string]*APIKeyCacheItem{}}
+			c.AddAPIKey(1, "sk", 1, "", tt.limits)
+			if tt.consumed > 0 {
+				limit, err := c.AcquireAPIKeyLimit("sk", false, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				limit.ConsumeTokens(tt.consumed)
+			}
+
+			_, err := c.AcquireAPIKeyLimit("sk", tt.stream, tt.tokens)
+			var limitErr *RateLimitError
+			switch {
+			case tt.wantKind == "" && err != nil:
+				t.Fatalf("err = %v, want nil", err)
+			case tt.wantKind != "" && (!errors.As(err, &limitErr) || limitErr.Kind != tt.wantKind):
+				t.Fatalf("err = %v, want kind %s", err, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestUpdateAPIKeyKeepsLimiterState(t *testing.T) {
+	c := &MemoryCache{apiKeys: map[string]*APIKeyCacheItem{}}
+	limits := models.APIKeyLimits{RPMLimit: 2, MaxConcurrentStreams: 1}
+	c.AddAPIKey(1, "sk", 1, "old", limits)
+	c.AddAPIKeyPrompt("sk", "tool", "tool prompt")
+
+	stream, err := c.AcquireAPIKeyLimit("sk", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.AcquireAPIKeyLimit("sk", false, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改提示词后请求数和流式并发仍然受限
+	c.UpdateAPIKey(1, "sk", 1, "new", limits)
+	if _, err := c.AcquireAPIKeyLimit("sk", false, 0); err == nil {
+		t.Error("RPM 在修改后被重置")
+	}
+	if prompt, _ := c.GetAPIKeyPrompt("sk"); prompt != "new" {
+		t.Errorf("prompt = %q, want new", prompt)
+	}
+	if prompt, ok := c.GetAPIKeyPromptByTool("sk", "tool"); !ok || prompt != "tool prompt" {
+		t.Errorf("tool prompt = %q, %v", prompt, ok)
+	}
+
+	// 放宽 RPM 后，进行中的流式请求仍计入并发
+	c.UpdateAPIKey(1, "sk", 1, "new", models.APIKeyLimits{MaxConcurrentStreams: 1})
+	var limitErr *RateLimitError
+	if _, err := c.AcquireAPIKeyLimit("sk", true, 0); !errors.As(err, &limitErr) || limitErr.Kind != "streams" {
+		t.Errorf("err = %v, want streams", err)
+	}
+	stream.Release()
+	if _, err := c.AcquireAPIKeyLimit("sk", true, 0); err != nil {
+		t.Errorf("释放后 err = %v", err)
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
@@ -14,6 +16,7 @@ type Config struct {
 	JWT      JWTConfig      `yaml:"jwt"`
 	Logging  LoggingConfig  `yaml:"logging"`
 	SSL      SSLConfig      `yaml:"ssl"`
+	Proxy    ProxyConfig    `yaml:"proxy"`
 	Debug    bool           `yaml:"debug"`
 }
 
@@ -55,6 +58,50 @@ type SSLConfig struct {
 	KeyFile  string `yaml:"key_file"`
 }
 
+// DefaultCompressThreshold 请求 token 数超过模型上下文长度的这一比例时开始压缩
+const DefaultCompressThreshold = 0.8
+
+// DefaultRetryBudget 单个请求重试和切换备用目标的默认总时长
+const DefaultRetryBudget = 120 * time.Second
+
+// DefaultMaxUploadSize 上传文件接口请求体的默认大小上限，单位 MB
+const DefaultMaxUploadSize = 25
+
+// ProxyConfig OpenAI 兼容代理配置
+type ProxyConfig struct {
+	BasePath            string  `yaml:"base_path"`             // OpenAI 兼容接口的挂载路径，默认 /v1
+	ExposeUpstreamModel bool    `yaml:"expose_upstream_model"` // 是否通过 X-Upstream-Model 响应头返回实际请求的上游模型ID
+	CompressThreshold   float64 `yaml:"compress_threshold"`    // 触发压缩的上下文占用比例，取值 (0, 1]，默认 0.8
+	RetryBudget         int     `yaml:"retry_budget"`          // 单个请求重试和切换备用目标的总时长，单位秒，默认 120
+	MaxUploadSize       int     `yaml:"max_upload_size"`       // 上传文件接口（如语音转写）请求体的大小上限，单位 MB，默认 25
+}
+
+// CompressBudget 返回触发压缩的 token 数，未配置或超出 (0, 1] 时使用默认比例
+func (p ProxyConfig) CompressBudget(contextTokens int) int {
+	threshold := p.CompressThreshold
+	if threshold <= 0 || threshold > 1 {
+		threshold = DefaultCompressThreshold
+	}
+	return int(float64(contextTokens) * threshold)
+}
+
+// RetryBudgetDuration 返回单个请求重试和切换备用目标的总时长，未配置时使用默认值
+func (p ProxyConfig) RetryBudgetDuration() time.Duration {
+	if p.RetryBudget <= 0 {
+		return DefaultRetryBudget
+	}
+	return time.Duration(p.RetryBudget) * time.Second
+}
+
+// MaxUploadBytes 返回上传文件接口请求体的大小上限（字节），未配置时使用默认值
+func (p ProxyConfig) MaxUploadBytes() int64 {
+	size := p.MaxUploadSize
+	if size <= 0 {
+		size = DefaultMaxUploadSize
+	}
+	return int64(size) << 20
+}
+
 // GetConnMaxDuration 获取连接最大存活时间
 func (d *DatabaseConfig) GetConnMaxDuration() time.Duration {
 	duration, err := time.ParseDuration(d.ConnMaxLifetime)
@@ -110,6 +157,17 @@ func Load(path string) (*Config, error) {
 	if cfg.SSL.KeyFile == "" {
 		cfg.SSL.KeyFile = "./cert/server.key"
 	}
+	if cfg.Proxy.BasePath == "" {
+		cfg.Proxy.BasePath = "/v1"
+	}
+	if !strings.HasPrefix(cfg.Proxy.BasePath, "/") {
+		cfg.Proxy.BasePath = "/" + cfg.Proxy.BasePath
+	}
+	cfg.Proxy.BasePath = strings.TrimSuffix(cfg.Proxy.BasePath, "/")
+	// 挂载到根路径会与管理接口、用户页面等路由冲突
+	if cfg.Proxy.BasePath == "" {
+		return nil, errors.New("proxy.base_path 不能为根路径 /")
+	}
 
 	return &cfg, nil
 }
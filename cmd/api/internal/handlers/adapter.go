@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// providerAdapter 厂商接口适配器
+// 将 OpenAI 格式的聊天补全请求转换为厂商原生请求，并把厂商的成功响应转换回 OpenAI 格式，
+// 上层的用量统计、流式转发和错误处理因此无需关心厂商协议
+type providerAdapter interface {
+	// buildRequest 返回厂商接口地址和请求体
+	buildRequest(req ChatCompletionRequest, target *upstreamTarget) (string, []byte, error)
+	// setHeaders 设置鉴权等厂商专用请求头
+	setHeaders(header http.Header, target *upstreamTarget)
+	// convertResponse 将状态码为 200 的厂商响应转换为 OpenAI 格式（非流式为 JSON，流式为 SSE）
+	convertResponse(resp *http.Response, stream bool) (*http.Response, error)
+	// modelsURL 返回厂商模型列表接口地址（GET），用于连接测试、模型导入和健康探测
+	modelsURL(target *upstreamTarget) string
+	// parseModels 解析模型列表接口的响应
+	parseModels(body []byte) ([]upstreamModel, error)
+}
+
+// providerAdapters 接口协议类型 -> 适配器
+var providerAdapters = map[string]providerAdapter{
+	models.ProviderTypeOpenAI:    openAIAdapter{},
+	models.ProviderTypeAnthropic: anthropicAdapter{},
+	models.ProviderTypeGemini:    geminiAdapter{},
+	models.ProviderTypeAzure:     azureAdapter{},
+}
+
+// adapterFor 返回厂商接口协议对应的适配器，未知类型按 OpenAI 兼容接口处理
+func adapterFor(providerType string) providerAdapter {
+	if adapter, ok := providerAdapters[providerType]; ok {
+		return adapter
+	}
+	return openAIAdapter{}
+}
+
+// endpointAdapter 支持聊天补全以外的 OpenAI 接口（如 /completions、/embeddings）的适配器
+// 这些接口的请求和响应原样透传，只有接口地址和鉴权方式因厂商而异
+type endpointAdapter interface {
+	providerAdapter
+	// endpointURL 返回 OpenAI 接口路径（如 /embeddings）对应的厂商接口地址
+	endpointURL(path string, target *upstreamTarget) string
+}
+
+// openAIAdapter OpenAI 兼容接口，请求和响应原样透传
+type openAIAdapter struct{}
+
+func (a openAIAdapter) buildRequest(req ChatCompletionRequest, target *upstreamTarget) (string, []byte, error) {
+	// 直接序列化 req（包含所有已修改的消息和 Extra 字段）
+	body, err := req.MarshalJSON()
+	return a.endpointURL("/chat/completions", target), body, err
+}
+
+func (openAIAdapter) endpointURL(path string, target *upstreamTarget) string {
+	return target.BaseURL + path
+}
+
+func (openAIAdapter) modelsURL(target *upstreamTarget) string {
+	return target.BaseURL + "/models"
+}
+
+func (openAIAdapter) parseModels(body []byte) ([]upstreamModel, error) {
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	result := make([]upstreamModel, 0, len(list.Data))
+	for _, m := range list.Data {
+		result = append(result, upstreamModel{ID: m.ID, DisplayName: m.ID})
+	}
+	return result, nil
+}
+
+func (openAIAdapter) setHeaders(header http.Header, target *upstreamTarget) {
+	header.Set("Authorization", "Bearer "+target.APIKey)
+}
+
+func (openAIAdapter) convertResponse(resp *http.Response, stream bool) (*http.Response, error) {
+	return resp, nil
+}
+
+// openAIToolCall OpenAI 格式的工具调用（流式增量时携带 Index）
+type openAIToolCall struct {
+	Index    *int   `json:"index,omitempty"`
+	ID       string `json:"id,omitempty"`
+	Type     string `json:"type,omitempty"`
+	Function struct {
+		Name      string `json:"name,omitempty"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// arguments 解析工具调用参数，无法解析时返回空对象
+func (call openAIToolCall) arguments() interface{} {
+	var args interface{}
+	if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil || args == nil {
+		return map[string]interface{}{}
+	}
+	return args
+}
+
+// parseToolCalls 解析 assistant 消息的 tool_calls
+func parseToolCalls(raw *json.RawMessage) []openAIToolCall {
+	if raw == nil {
+		return nil
+	}
+	var toolCalls []openAIToolCall
+	if err := json.Unmarshal(*raw, &toolCalls); err != nil {
+		return nil
+	}
+	return toolCalls
+}
+
+// imageURLOf 提取 OpenAI image_url 内容的地址（字符串或 {"url": ...} 对象）
+func imageURLOf(imageURL interface{}) string {
+	switch v := imageURL.(type) {
+	case string:
+		return v
+	case map[string]interface{}:
+		url, _ := v["url"].(string)
+		return url
+	}
+	return ""
+}
+
+// parseDataURL 解析 data:image/png;base64,xxxx 形式的地址，返回媒体类型和 base64 数据
+func parseDataURL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, found := strings.Cut(rest, ",")
+	if !found {
+		return "", "", false
+	}
+	mediaType, _, _ := strings.Cut(meta, ";")
+	return mediaType, data, true
+}
+
+// replaceBody 用转换后的内容替换响应体
+func replaceBody(resp *http.Response, body []byte) *http.Response {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Set("Content-Type", "application/json")
+	return resp
+}
+
+// translatedBody 转换后的流式响应体，关闭时同时关闭厂商连接
+type translatedBody struct {
+	*io.PipeReader
+	upstream io.Closer
+}
+
+func (b *translatedBody) Close() error {
+	b.PipeReader.Close()
+	return b.upstream.Close()
+}
+
+// streamTranslator 厂商流式响应转换器，返回的每个元素为一条 OpenAI 格式的 data 负载（JSON 或 [DONE]）
+type streamTranslator interface {
+	// translate 转换一条厂商 SSE 的 data 负载
+	translate(data []byte) []string
+	// finish 厂商流正常结束后追加输出的数据块
+	finish() []string
+}
+
+// translateStream 逐个读取厂商 SSE 事件的 data 负载，经 translator 转换为 OpenAI 数据块后输出
+func translateStream(resp *http.Response, translator streamTranslator) *http.Response {
+	reader, writer := io.Pipe()
+	upstream := resp.Body
+
+	// emit 输出数据块，下游已关闭时返回 false
+	emit := func(chunks []string) bool {
+		for _, chunk := range chunks {
+			if chunk == "" {
+				continue
+			}
+			if _, err := io.WriteString(writer, "data: "+chunk+"\n\n"); err != nil {
+				return false
+			}
+		}
+		return true
+	}
+
+	go func() {
+		defer upstream.Close()
+		reader := newSSEReader(upstream)
+		for {
+			event, err := reader.next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+			if !emit(translator.translate([]byte(event.Data))) {
+				return
+			}
+		}
+		emit(translator.finish())
+		writer.Close()
+	}()
+
+	resp.Body = &translatedBody{PipeReader: reader, upstream: upstream}
+	resp.ContentLength = -1
+	resp.Header.Del("Content-Length")
+	resp.Header.Set("Content-Type", "text/event-stream")
+	return resp
+}
+
+// marshalChunk 序列化流式数据块，失败时返回空字符串
+func marshalChunk(chunk interface{}) string {
+	data, err := json.Marshal(chunk)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
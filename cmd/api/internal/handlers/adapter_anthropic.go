@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion          = "2023-06-01"
+	anthropicDefaultMaxTokens = 4096 // 客户端未指定 max_tokens 时使用（Anthropic 要求必填）
+)
+
+// anthropicAdapter Anthropic Messages API（POST {base_url}/messages）
+type anthropicAdapter struct{}
+
+func (anthropicAdapter) modelsURL(target *upstreamTarget) string {
+	return target.BaseURL + "/models?limit=1000"
+}
+
+func (anthropicAdapter) parseModels(body []byte) ([]upstreamModel, error) {
+	var list struct {
+		Data []struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"display_name"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	result := make([]upstreamModel, 0, len(list.Data))
+	for _, m := range list.Data {
+		name := m.DisplayName
+		if name == "" {
+			name = m.ID
+		}
+		result = append(result, upstreamModel{ID: m.ID, DisplayName: name})
+	}
+	return result, nil
+}
+
+func (anthropicAdapter) setHeaders(header http.Header, target *upstreamTarget) {
+	header.Set("x-api-key", target.APIKey)
+	header.Set("anthropic-version", anthropicVersion)
+}
+
+// anthropicBlock Anthropic 内容块（text/image/tool_use/tool_result 等）
+type anthropicBlock map[string]interface{}
+
+// anthropicMessage Anthropic 消息（只有 user 和 assistant 两种角色）
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+func (anthropicAdapter) buildRequest(req ChatCompletionRequest, target *upstreamTarget) (string, []byte, error) {
+	var messages []ChatMessage
+	if err := json.Unmarshal(req.Messages, &messages); err != nil {
+		return "", nil, fmt.Errorf("解析消息失败: %w", err)
+	}
+
+	var system []anthropicBlock
+	var converted []anthropicMessage
+	for _, msg := range messages {
+		blocks := anthropicContentBlocks(msg.Content)
+		role := msg.Role
+		switch msg.Role {
+		case "system", "developer":
+			// 系统提示词放到顶层 system 字段，保留 cache_control
+			system = append(system, blocks...)
+			continue
+		case "assistant":
+			blocks = append(blocks, anthropicToolUseBlocks(msg.ToolCalls)...)
+		case "tool":
+			// 工具结果作为 user 消息中的 tool_result 块
+			result := anthropicBlock{"type": "tool_result", "content": blocks}
+			if msg.ToolCallID != nil {
+				result["tool_use_id"] = *msg.ToolCallID
+			}
+			if len(blocks) == 0 {
+				result["content"] = ""
+			}
+			blocks = []anthropicBlock{result}
+			role = "user"
+		default:
+			role = "user"
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		// 相邻的同角色消息合并（如连续多个工具结果）
+		if n := len(converted); n > 0 && converted[n-1].Role == role {
+			converted[n-1].Content = append(converted[n-1].Content, blocks...)
+			continue
+		}
+		converted = append(converted, anthropicMessage{Role: role, Content: blocks})
+	}
+
+	body := map[string]interface{}{
+		"model":      req.Model,
+		"messages":   converted,
+		"max_tokens": anthropicDefaultMaxTokens,
+	}
+	if req.Stream {
+		body["stream"] = true
+	}
+	if len(system) > 0 {
+		body["system"] = system
+	}
+	if req.MaxTokens != nil {
+		body["max_tokens"] = *req.MaxTokens
+	} else if maxTokens, ok := req.Extra["max_completion_tokens"].(float64); ok {
+		body["max_tokens"] = int(maxTokens)
+	}
+	if req.Temperature != nil {
+		// Anthropic 的 temperature 取值范围为 0~1
+		body["temperature"] = min(*req.Temperature, 1)
+	}
+	if topP, ok := req.Extra["top_p"]; ok {
+		body["top_p"] = topP
+	}
+	switch stop := req.Extra["stop"].(type) {
+	case string:
+		body["stop_sequences"] = []string{stop}
+	case []interface{}:
+		body["stop_sequences"] = stop
+	}
+	if user, ok := req.Extra["user"].(string); ok && user != "" {
+		body["metadata"] = map[string]string{"user_id": user}
+	}
+	if tools := anthropicTools(req.Extra["tools"]); len(tools) > 0 {
+		body["tools"] = tools
+		if choice := anthropicToolChoice(req.Extra["tool_choice"], req.Extra["parallel_tool_calls"]); choice != nil {
+			body["tool_choice"] = choice
+		}
+	}
+
+	data, err := json.Marshal(body)
+	return target.BaseURL + "/messages", data, err
+}
+
+// anthropicContentBlocks 将 OpenAI 消息内容（字符串或内容数组）转换为 Anthropic 内容块
+func anthropicContentBlocks(content json.RawMessage) []anthropicBlock {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		// Anthropic 不接受空文本块
+		if text == "" {
+			return nil
+		}
+		return []anthropicBlock{{"type": "text", "text": text}}
+	}
+
+	var parts []map[string]interface{}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return nil
+	}
+	blocks := make([]anthropicBlock, 0, len(parts))
+	for _, part := range parts {
+		var block anthropicBlock
+		switch part["type"] {
+		case "text":
+			if text, _ := part["text"].(string); text == "" {
+				continue
+			}
+			block = anthropicBlock{"type": "text", "text": part["text"]}
+		case "image_url":
+			block = anthropicImageBlock(part["image_url"])
+			if block == nil {
+				continue
+			}
+		default:
+			// 其他类型（如已是 Anthropic 格式的 image/document 块）原样透传
+			blocks = append(blocks, part)
+			continue
+		}
+		if cacheControl, ok := part["cache_control"]; ok {
+			block["cache_control"] = cacheControl
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+// anthropicImageBlock 将 OpenAI image_url 转换为 Anthropic image 块，支持 data URL 和普通 URL
+func anthropicImageBlock(imageURL interface{}) anthropicBlock {
+	url := imageURLOf(imageURL)
+	if url == "" {
+		return nil
+	}
+	if mediaType, data, ok := parseDataURL(url); ok {
+		return anthropicBlock{
+			"type":   "image",
+			"source": map[string]string{"type": "base64", "media_type": mediaType, "data": data},
+		}
+	}
+	return anthropicBlock{
+		"type":   "image",
+		"source": map[string]string{"type": "url", "url": url},
+	}
+}
+
+// anthropicToolUseBlocks 将 assistant 消息的 tool_calls 转换为 tool_use 块
+func anthropicToolUseBlocks(raw *json.RawMessage) []anthropicBlock {
+	toolCalls := parseToolCalls(raw)
+	blocks := make([]anthropicBlock, 0, len(toolCalls))
+	for _, call := range toolCalls {
+		blocks = append(blocks, anthropicBlock{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": call.arguments(),
+		})
+	}
+	return blocks
+}
+
+// anthropicTools 将 OpenAI tools（function 类型）转换为 Anthropic tools
+func anthropicTools(raw interface{}) []map[string]interface{} {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	tools := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		tool, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		function, ok := tool["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		converted := map[string]interface{}{
+			"name":         function["name"],
+			"input_schema": function["parameters"],
+		}
+		if function["parameters"] == nil {
+			converted["input_schema"] = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		if description, ok := function["description"]; ok {
+			converted["description"] = description
+		}
+		if cacheControl, ok := tool["cache_control"]; ok {
+			converted["cache_control"] = cacheControl
+		}
+		tools = append(tools, converted)
+	}
+	return tools
+}
+
+// anthropicToolChoice 将 OpenAI tool_choice 转换为 Anthropic tool_choice，未指定时返回 nil
+func anthropicToolChoice(raw, parallel interface{}) map[string]interface{} {
+	var choice map[string]interface{}
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "auto":
+			choice = map[string]interface{}{"type": "auto"}
+		case "required":
+			choice = map[string]interface{}{"type": "any"}
+		case "none":
+			choice = map[string]interface{}{"type": "none"}
+		}
+	case map[string]interface{}:
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			choice = map[string]interface{}{"type": "tool", "name": function["name"]}
+		}
+	}
+
+	if allowed, ok := parallel.(bool); ok && !allowed {
+		if choice == nil {
+			choice = map[string]interface{}{"type": "auto"}
+		}
+		if choice["type"] != "none" {
+			choice["disable_parallel_tool_use"] = true
+		}
+	}
+	return choice
+}
+
+// anthropicUsage Anthropic 用量（input_tokens 不含缓存读写部分）
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toOpenAI 转换为 OpenAI 用量，缓存命中的 token 计入 prompt_tokens_details.cached_tokens
+func (u anthropicUsage) toOpenAI() *Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	usage := &Usage{
+		PromptTokens:     prompt,
+		CompletionTokens: u.OutputTokens,
+		TotalTokens:      prompt + u.OutputTokens,
+	}
+	if u.CacheReadInputTokens > 0 {
+		usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: u.CacheReadInputTokens}
+	}
+	return usage
+}
+
+// anthropicFinishReason 将 Anthropic stop_reason 转换为 OpenAI finish_reason
+func anthropicFinishReason(stopReason string) string {
+	switch stopReason {
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	default:
+		return "stop"
+	}
+}
+
+// anthropicContent Anthropic 响应中的内容块
+type anthropicContent struct {
+	Type  string          `json:"type"`
+	Text  string          `json:"text"`
+	ID    string          `json:"id"`
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+}
+
+// anthropicResponse Anthropic 非流式响应
+type anthropicResponse struct {
+	ID         string             `json:"id"`
+	Model      string             `json:"model"`
+	Content    []anthropicContent `json:"content"`
+	StopReason string             `json:"stop_reason"`
+	Usage      anthropicUsage     `json:"usage"`
+}
+
+func (anthropicAdapter) convertResponse(resp *http.Response, stream bool) (*http.Response, error) {
+	if stream {
+		return translateStream(resp, newAnthropicStreamTranslator()), nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取厂商响应失败: %w", err)
+	}
+	var parsed anthropicResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("解析厂商响应失败: %w", err)
+	}
+
+	var text strings.Builder
+	var toolCalls []openAIToolCall
+	for _, content := range parsed.Content {
+		switch content.Type {
+		case "text":
+			text.WriteString(content.Text)
+		case "tool_use":
+			call := openAIToolCall{ID: content.ID, Type: "function"}
+			call.Function.Name = content.Name
+			call.Function.Arguments = string(content.Input)
+			toolCalls = append(toolCalls, call)
+		}
+	}
+
+	message := ChatMessage{Role: "assistant", Content: json.RawMessage("null")}
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		message.Content, _ = json.Marshal(text.String())
+	}
+	if len(toolCalls) > 0 {
+		raw, _ := json.Marshal(toolCalls)
+		message.ToolCalls = (*json.RawMessage)(&raw)
+	}
+
+	converted, err := json.Marshal(ChatCompletionResponse{
+		ID:      parsed.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   parsed.Model,
+		Choices: []Choice{{
+			Index:        0,
+			Message:      message,
+			FinishReason: anthropicFinishReason(parsed.StopReason),
+		}},
+		Usage: *parsed.Usage.toOpenAI(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("转换厂商响应失败: %w", err)
+	}
+	return replaceBody(resp, converted), nil
+}
+
+// anthropicStreamTranslator 将 Anthropic 流式事件转换为 OpenAI chat.completion.chunk
+type anthropicStreamTranslator struct {
+	id        string
+	model     string
+	created   int64
+	usage     anthropicUsage
+	toolIndex map[int]int // 内容块序号 -> tool_calls 序号
+}
+
+func newAnthropicStreamTranslator() *anthropicStreamTranslator {
+	return &anthropicStreamTranslator{
+		created:   time.Now().Unix(),
+		toolIndex: make(map[int]int),
+	}
+}
+
+// anthropicStreamEvent Anthropic 流式事件（按 type 区分）
+type anthropicStreamEvent struct {
+	Type    string `json:"type"`
+	Index   int    `json:"index"`
+	Message struct {
+		ID    string         `json:"id"`
+		Model string         `json:"model"`
+		Usage anthropicUsage `json:"usage"`
+	} `json:"message"`
+	ContentBlock anthropicContent `json:"content_block"`
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage *anthropicUsage `json:"usage"`
+	Error json.RawMessage `json:"error"`
+}
+
+// chunk 生成一个 OpenAI 流式数据块
+func (t *anthropicStreamTranslator) chunk(delta map[string]interface{}, finishReason *string, usage *Usage) string {
+	chunk := map[string]interface{}{
+		"id":      t.id,
+		"object":  "chat.completion.chunk",
+		"created": t.created,
+		"model":   t.model,
+		"choices": []map[string]interface{}{{
+			"index":         0,
+			"delta":         delta,
+			"finish_reason": finishReason,
+		}},
+	}
+	if usage != nil {
+		chunk["usage"] = usage
+	}
+	return marshalChunk(chunk)
+}
+
+func (t *anthropicStreamTranslator) translate(data []byte) []string {
+	var event anthropicStreamEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil
+	}
+
+	switch event.Type {
+	case "message_start":
+		t.id = event.Message.ID
+		t.model = event.Message.Model
+		t.usage = event.Message.Usage
+		return []string{t.chunk(map[string]interface{}{"role": "assistant", "content": ""}, nil, nil)}
+
+	case "content_block_start":
+		if event.ContentBlock.Type != "tool_use" {
+			return nil
+		}
+		index := len(t.toolIndex)
+		t.toolIndex[event.Index] = index
+		call := openAIToolCall{Index: &index, ID: event.ContentBlock.ID, Type: "function"}
+		call.Function.Name = event.ContentBlock.Name
+		return []string{t.chunk(map[string]interface{}{"tool_calls": []openAIToolCall{call}}, nil, nil)}
+
+	case "content_block_delta":
+		switch event.Delta.Type {
+		case "text_delta":
+			return []string{t.chunk(map[string]interface{}{"content": event.Delta.Text}, nil, nil)}
+		case "input_json_delta":
+			index, ok := t.toolIndex[event.Index]
+			if !ok {
+				return nil
+			}
+			call := openAIToolCall{Index: &index}
+			call.Function.Arguments = event.Delta.PartialJSON
+			return []string{t.chunk(map[string]interface{}{"tool_calls": []openAIToolCall{call}}, nil, nil)}
+		}
+		return nil
+
+	case "message_delta":
+		if event.Usage != nil {
+			// message_delta 中的 usage 为累计值
+			t.usage.OutputTokens = event.Usage.OutputTokens
+			if event.Usage.InputTokens > 0 {
+				t.usage.InputTokens = event.Usage.InputTokens
+			}
+		}
+		finishReason := anthropicFinishReason(event.Delta.StopReason)
+		return []string{t.chunk(map[string]interface{}{}, &finishReason, t.usage.toOpenAI())}
+
+	case "message_stop":
+		return []string{"[DONE]"}
+
+	case "error":
+		return []string{marshalChunk(map[string]json.RawMessage{"error": event.Error})}
+	}
+	return nil
+}
+
+// finish message_stop 时已输出 [DONE]
+func (t *anthropicStreamTranslator) finish() []string {
+	return nil
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// assertJSON 比较两个 JSON 是否语义相同（忽略字段顺序和空白）
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w interface{}
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("got 不是合法 JSON: %v\n%s", err, got)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatalf("want 不是合法 JSON: %v", err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("JSON 不一致\n got: %s\nwant: %s", got, want)
+	}
+}
+
+// chatRequest 解析 OpenAI 格式的请求体
+func chatRequest(t *testing.T, body string) ChatCompletionRequest {
+	t.Helper()
+	var req ChatCompletionRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAnthropicBuildRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		req  string
+		want string
+	}{
+		{
+			name: "系统提示词和默认 max_tokens",
+			req:  `{"model":"claude","messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`,
+			want: `{"model":"claude","max_tokens":4096,"system":[{"type":"text","text":"sys"}],
+				"messages":[{"role":"user","content":[{"type":"text","text":"hi"}]}]}`,
+		},
+		{
+			name: "工具调用和相邻的工具结果合并",
+			req: `{"model":"claude","max_completion_tokens":100,"messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":null,"tool_calls":[
+					{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}},
+					{"id":"c2","type":"function","function":{"name":"g","arguments":""}}]},
+				{"role":"tool","tool_call_id":"c1","content":"r1"},
+				{"role":"tool","tool_call_id":"c2","content":""}]}`,
+			want: `{"model":"claude","max_tokens":100,"messages":[
+				{"role":"user","content":[{"type":"text","text":"hi"}]},
+				{"role":"assistant","content":[
+					{"type":"tool_use","id":"c1","name":"f","input":{"a":1}},
+					{"type":"tool_use","id":"c2","name":"g","input":{}}]},
+				{"role":"user","content":[
+					{"type":"tool_result","tool_use_id":"c1","content":[{"type":"text","text":"r1"}]},
+					{"type":"tool_result","tool_use_id":"c2","content":""}]}]}`,
+		},
+		{
+			name: "参数转换",
+			req: `{"model":"claude","max_tokens":10,"temperature":1.5,"stop":"END","user":"u1",
+				"tools":[{"type":"function","function":{"name":"f","description":"d"}}],
+				"tool_choice":"required","parallel_tool_calls":false,
+				"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}},
+					{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]}]}`,
+			want: `{"model":"claude","max_tokens":10,"temperature":1,"stop_sequences":["END"],"metadata":{"user_id":"u1"},
+				"tools":[{"name":"f","description":"d","input_schema":{"type":"object","properties":{}}}],
+				"tool_choice":{"type":"any","disable_parallel_tool_use":true},
+				"messages":[{"role":"user","content":[{"type":"text","text":"hi","cache_control":{"type":"ephemeral"}},
+					{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, body, err := anthropicAdapter{}.buildRequest(chatRequest(t, tt.req), &upstreamTarget{BaseURL: "https://api.anthropic.com/v1"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != "https://api.anthropic.com/v1/messages" {
+				t.Errorf("url = %s", url)
+			}
+			assertJSON(t, body, tt.want)
+		})
+	}
+}
+
+func TestAnthropicFinishReason(t *testing.T) {
+	tests := map[string]string{
+		"end_turn":      "stop",
+		"stop_sequence": "stop",
+		"max_tokens":    "length",
+		"tool_use":      "tool_calls",
+		"refusal":       "content_filter",
+	}
+	for stopReason, want := range tests {
+		if got := anthropicFinishReason(stopReason); got != want {
+			t.Errorf("anthropicFinishReason(%q) = %q, want %q", stopReason, got, want)
+		}
+	}
+}
+
+func TestAnthropicUsageToOpenAI(t *testing.T) {
+	usage := anthropicUsage{InputTokens: 10, OutputTokens: 5, CacheCreationInputTokens: 20, CacheReadInputTokens: 30}.toOpenAI()
+	if usage.PromptTokens != 60 || usage.CompletionTokens != 5 || usage.TotalTokens != 65 {
+		t.Errorf("usage = %+v", usage)
+	}
+	if usage.PromptTokensDetails == nil || usage.PromptTokensDetails.CachedTokens != 30 {
+		t.Errorf("cached = %+v", usage.PromptTokensDetails)
+	}
+}
+
+func TestAnthropicStreamTranslator(t *testing.T) {
+	events := []string{
+		`{"type":"message_start","message":{"id":"msg_1","model":"claude","usage":{"input_tokens":7}}}`,
+		`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Hi"}}`,
+		`{"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"tu_1","name":"f"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":"}}`,
+		`{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"1}"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"tool_use"},"usage":{"output_tokens":3}}`,
+		`{"type":"message_stop"}`,
+	}
+	translator := newAnthropicStreamTranslator()
+	var chunks []string
+	for _, event := range events {
+		chunks = append(chunks, translator.translate([]byte(event))...)
+	}
+	chunks = append(chunks, translator.finish()...)
+
+	if n := len(chunks); n != 7 || chunks[n-1] != "[DONE]" {
+		t.Fatalf("chunks = %q", chunks)
+	}
+
+	var content, name, arguments, finishReason string
+	var usage *Usage
+	for _, data := range chunks[:len(chunks)-1] {
+		chunk := decodeStreamChunk(&sseEvent{Data: data})
+		if chunk == nil {
+			t.Fatalf("无法解码数据块: %s", data)
+		}
+		if chunk.ID != "msg_1" || chunk.Model != "claude" {
+			t.Errorf("chunk id/model = %s/%s", chunk.ID, chunk.Model)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			content += choice.Delta.Content
+			for _, call := range choice.Delta.ToolCalls {
+				name += call.Function.Name
+				arguments += call.Function.Arguments
+			}
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if content != "Hi" || name != "f" || arguments != `{"a":1}` || finishReason != "tool_calls" {
+		t.Errorf("content=%q name=%q arguments=%q finish=%q", content, name, arguments, finishReason)
+	}
+	if usage == nil || usage.PromptTokens != 7 || usage.CompletionTokens != 3 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
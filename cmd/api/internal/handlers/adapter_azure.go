@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// azureDefaultAPIVersion 厂商未配置 api-version 时使用
+const azureDefaultAPIVersion = "2024-10-21"
+
+// azureAdapter Azure OpenAI（POST {base_url}/openai/deployments/{deployment}/{接口路径}?api-version=...）
+// 模型ID即部署名，请求和响应格式与 OpenAI 相同
+type azureAdapter struct{}
+
+func (a azureAdapter) buildRequest(req ChatCompletionRequest, target *upstreamTarget) (string, []byte, error) {
+	body, err := req.MarshalJSON()
+	return a.endpointURL("/chat/completions", target), body, err
+}
+
+func (azureAdapter) endpointURL(path string, target *upstreamTarget) string {
+	return target.BaseURL + "/openai/deployments/" + url.PathEscape(target.ModelID) +
+		path + "?api-version=" + url.QueryEscape(azureAPIVersion(target))
+}
+
+// azureAPIVersion 返回目标的 api-version，未配置时使用默认版本
+func azureAPIVersion(target *upstreamTarget) string {
+	if target.APIVersion == "" {
+		return azureDefaultAPIVersion
+	}
+	return target.APIVersion
+}
+
+// modelsURL Azure 的模型列表不在部署路径下
+func (azureAdapter) modelsURL(target *upstreamTarget) string {
+	return target.BaseURL + "/openai/models?api-version=" + url.QueryEscape(azureAPIVersion(target))
+}
+
+// parseModels Azure 的模型列表与 OpenAI 格式相同，列出的是可部署的基础模型而非部署名
+func (azureAdapter) parseModels(body []byte) ([]upstreamModel, error) {
+	return openAIAdapter{}.parseModels(body)
+}
+
+func (azureAdapter) setHeaders(header http.Header, target *upstreamTarget) {
+	header.Set("api-key", target.APIKey)
+}
+
+func (azureAdapter) convertResponse(resp *http.Response, stream bool) (*http.Response, error) {
+	return resp, nil
+}
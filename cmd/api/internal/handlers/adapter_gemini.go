@@ -0,0 +1,536 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// geminiAdapter Google Gemini API（POST {base_url}/models/{model}:generateContent）
+type geminiAdapter struct{}
+
+func (geminiAdapter) modelsURL(target *upstreamTarget) string {
+	return target.BaseURL + "/models?pageSize=1000"
+}
+
+// parseModels 只保留支持 generateContent 的模型，上下文长度取 inputTokenLimit
+func (geminiAdapter) parseModels(body []byte) ([]upstreamModel, error) {
+	var list struct {
+		Models []struct {
+			Name                       string   `json:"name"` // models/gemini-1.5-pro
+			DisplayName                string   `json:"displayName"`
+			InputTokenLimit            int      `json:"inputTokenLimit"`
+			SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
+		} `json:"models"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	result := make([]upstreamModel, 0, len(list.Models))
+	for _, m := range list.Models {
+		if !slices.Contains(m.SupportedGenerationMethods, "generateContent") {
+			continue
+		}
+		id := strings.TrimPrefix(m.Name, "models/")
+		name := m.DisplayName
+		if name == "" {
+			name = id
+		}
+		result = append(result, upstreamModel{ID: id, DisplayName: name, ContextLength: m.InputTokenLimit / 1000})
+	}
+	return result, nil
+}
+
+func (geminiAdapter) setHeaders(header http.Header, target *upstreamTarget) {
+	header.Set("x-goog-api-key", target.APIKey)
+}
+
+// geminiPart Gemini 内容片段（text/inlineData/fileData/functionCall/functionResponse）
+type geminiPart map[string]interface{}
+
+// geminiContent Gemini 消息（角色为 user 或 model）
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+func (geminiAdapter) buildRequest(req ChatCompletionRequest, target *upstreamTarget) (string, []byte, error) {
+	var messages []ChatMessage
+	if err := json.Unmarshal(req.Messages, &messages); err != nil {
+		return "", nil, fmt.Errorf("解析消息失败: %w", err)
+	}
+
+	// functionResponse 需要函数名，按 tool_call_id 从之前的 tool_calls 中查找
+	toolNames := make(map[string]string)
+	var system []geminiPart
+	var contents []geminiContent
+	for _, msg := range messages {
+		parts := geminiParts(msg.Content)
+		role := "user"
+		switch msg.Role {
+		case "system", "developer":
+			system = append(system, parts...)
+			continue
+		case "assistant":
+			role = "model"
+			for _, call := range parseToolCalls(msg.ToolCalls) {
+				toolNames[call.ID] = call.Function.Name
+				parts = append(parts, geminiPart{
+					"functionCall": map[string]interface{}{"name": call.Function.Name, "args": call.arguments()},
+				})
+			}
+		case "tool":
+			var name string
+			if msg.ToolCallID != nil {
+				name = toolNames[*msg.ToolCallID]
+			}
+			parts = []geminiPart{{
+				"functionResponse": map[string]interface{}{"name": name, "response": geminiToolResponse(msg.Content)},
+			}}
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		// 相邻的同角色消息合并（如连续多个工具结果）
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, parts...)
+			continue
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: parts})
+	}
+
+	body := map[string]interface{}{
+		"contents": contents,
+	}
+	if len(system) > 0 {
+		body["systemInstruction"] = geminiContent{Parts: system}
+	}
+	if config := geminiGenerationConfig(req); len(config) > 0 {
+		body["generationConfig"] = config
+	}
+	if tools := geminiTools(req.Extra["tools"]); len(tools) > 0 {
+		body["tools"] = []map[string]interface{}{{"functionDeclarations": tools}}
+		if toolConfig := geminiToolConfig(req.Extra["tool_choice"]); toolConfig != nil {
+			body["toolConfig"] = toolConfig
+		}
+	}
+
+	endpoint := target.BaseURL + "/models/" + strings.TrimPrefix(req.Model, "models/")
+	if req.Stream {
+		endpoint += ":streamGenerateContent?alt=sse"
+	} else {
+		endpoint += ":generateContent"
+	}
+
+	data, err := json.Marshal(body)
+	return endpoint, data, err
+}
+
+// geminiParts 将 OpenAI 消息内容（字符串或内容数组）转换为 Gemini parts
+func geminiParts(content json.RawMessage) []geminiPart {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		if text == "" {
+			return nil
+		}
+		return []geminiPart{{"text": text}}
+	}
+
+	var items []map[string]interface{}
+	if err := json.Unmarshal(content, &items); err != nil {
+		return nil
+	}
+	parts := make([]geminiPart, 0, len(items))
+	for _, item := range items {
+		switch item["type"] {
+		case "text":
+			if text, _ := item["text"].(string); text != "" {
+				parts = append(parts, geminiPart{"text": text})
+			}
+		case "image_url":
+			url := imageURLOf(item["image_url"])
+			if url == "" {
+				continue
+			}
+			if mediaType, data, ok := parseDataURL(url); ok {
+				parts = append(parts, geminiPart{"inlineData": map[string]string{"mimeType": mediaType, "data": data}})
+			} else {
+				parts = append(parts, geminiPart{"fileData": map[string]string{"fileUri": url}})
+			}
+		}
+	}
+	return parts
+}
+
+// geminiToolResponse 将工具结果转换为 functionResponse.response（必须为 JSON 对象）
+func geminiToolResponse(content json.RawMessage) interface{} {
+	var text string
+	if err := json.Unmarshal(content, &text); err != nil {
+		// 内容数组：拼接其中的文本
+		var items []map[string]interface{}
+		json.Unmarshal(content, &items)
+		var sb strings.Builder
+		for _, item := range items {
+			if s, ok := item["text"].(string); ok {
+				sb.WriteString(s)
+			}
+		}
+		text = sb.String()
+	}
+
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(text), &object); err == nil && object != nil {
+		return object
+	}
+	return map[string]interface{}{"content": text}
+}
+
+// geminiGenerationConfig 将 OpenAI 采样参数转换为 Gemini generationConfig
+func geminiGenerationConfig(req ChatCompletionRequest) map[string]interface{} {
+	config := make(map[string]interface{})
+	if req.Temperature != nil {
+		config["temperature"] = *req.Temperature
+	}
+	if req.MaxTokens != nil {
+		config["maxOutputTokens"] = *req.MaxTokens
+	} else if maxTokens, ok := req.Extra["max_completion_tokens"]; ok {
+		config["maxOutputTokens"] = maxTokens
+	}
+	switch stop := req.Extra["stop"].(type) {
+	case string:
+		config["stopSequences"] = []string{stop}
+	case []interface{}:
+		config["stopSequences"] = stop
+	}
+
+	params := map[string]string{
+		"top_p":             "topP",
+		"n":                 "candidateCount",
+		"presence_penalty":  "presencePenalty",
+		"frequency_penalty": "frequencyPenalty",
+		"seed":              "seed",
+	}
+	for from, to := range params {
+		if value, ok := req.Extra[from]; ok {
+			config[to] = value
+		}
+	}
+
+	if format, ok := req.Extra["response_format"].(map[string]interface{}); ok {
+		if format["type"] == "json_object" || format["type"] == "json_schema" {
+			config["responseMimeType"] = "application/json"
+		}
+	}
+	return config
+}
+
+// geminiUnsupportedSchemaKeys Gemini 函数参数不支持的 JSON Schema 字段
+var geminiUnsupportedSchemaKeys = []string{"$schema", "additionalProperties"}
+
+// geminiSchema 递归移除 Gemini 不支持的 JSON Schema 字段
+func geminiSchema(schema interface{}) interface{} {
+	switch v := schema.(type) {
+	case map[string]interface{}:
+		cleaned := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			cleaned[key] = geminiSchema(value)
+		}
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(cleaned, key)
+		}
+		return cleaned
+	case []interface{}:
+		cleaned := make([]interface{}, len(v))
+		for i, value := range v {
+			cleaned[i] = geminiSchema(value)
+		}
+		return cleaned
+	}
+	return schema
+}
+
+// geminiTools 将 OpenAI tools（function 类型）转换为 Gemini functionDeclarations
+func geminiTools(raw interface{}) []map[string]interface{} {
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil
+	}
+	declarations := make([]map[string]interface{}, 0, len(list))
+	for _, item := range list {
+		tool, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		function, ok := tool["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		declaration := map[string]interface{}{"name": function["name"]}
+		if description, ok := function["description"]; ok {
+			declaration["description"] = description
+		}
+		if parameters, ok := function["parameters"]; ok && parameters != nil {
+			declaration["parameters"] = geminiSchema(parameters)
+		}
+		declarations = append(declarations, declaration)
+	}
+	return declarations
+}
+
+// geminiToolConfig 将 OpenAI tool_choice 转换为 Gemini toolConfig，未指定时返回 nil
+func geminiToolConfig(raw interface{}) map[string]interface{} {
+	var config map[string]interface{}
+	switch v := raw.(type) {
+	case string:
+		switch v {
+		case "auto":
+			config = map[string]interface{}{"mode": "AUTO"}
+		case "required":
+			config = map[string]interface{}{"mode": "ANY"}
+		case "none":
+			config = map[string]interface{}{"mode": "NONE"}
+		}
+	case map[string]interface{}:
+		if function, ok := v["function"].(map[string]interface{}); ok {
+			config = map[string]interface{}{"mode": "ANY", "allowedFunctionNames": []interface{}{function["name"]}}
+		}
+	}
+	if config == nil {
+		return nil
+	}
+	return map[string]interface{}{"functionCallingConfig": config}
+}
+
+// geminiUsageMetadata Gemini 用量
+type geminiUsageMetadata struct {
+	PromptTokenCount        int `json:"promptTokenCount"`
+	CandidatesTokenCount    int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int `json:"thoughtsTokenCount"`
+	CachedContentTokenCount int `json:"cachedContentTokenCount"`
+	TotalTokenCount         int `json:"totalTokenCount"`
+}
+
+// toOpenAI 转换为 OpenAI 用量，思考 token 计入 completion_tokens
+func (u geminiUsageMetadata) toOpenAI() *Usage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	usage := &Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: completion,
+		TotalTokens:      u.TotalTokenCount,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = u.PromptTokenCount + completion
+	}
+	if u.CachedContentTokenCount > 0 {
+		usage.PromptTokensDetails = &PromptTokensDetails{CachedTokens: u.CachedContentTokenCount}
+	}
+	return usage
+}
+
+// geminiCandidate Gemini 候选结果
+type geminiCandidate struct {
+	Index   int `json:"index"`
+	Content struct {
+		Parts []struct {
+			Text         string `json:"text"`
+			Thought      bool   `json:"thought"`
+			FunctionCall *struct {
+				Name string          `json:"name"`
+				Args json.RawMessage `json:"args"`
+			} `json:"functionCall"`
+		} `json:"parts"`
+	} `json:"content"`
+	FinishReason string `json:"finishReason"`
+}
+
+// geminiResponse Gemini 响应（流式响应的每个数据块结构相同）
+type geminiResponse struct {
+	Candidates    []geminiCandidate    `json:"candidates"`
+	UsageMetadata *geminiUsageMetadata `json:"usageMetadata"`
+	ModelVersion  string               `json:"modelVersion"`
+	ResponseID    string               `json:"responseId"`
+}
+
+// split 拆分候选结果的文本（跳过思考内容）和函数调用，callID 生成工具调用ID
+func (c geminiCandidate) split(callID func() string) (string, []openAIToolCall) {
+	var text strings.Builder
+	var toolCalls []openAIToolCall
+	for _, part := range c.Content.Parts {
+		if part.FunctionCall != nil {
+			call := openAIToolCall{ID: callID(), Type: "function"}
+			call.Function.Name = part.FunctionCall.Name
+			call.Function.Arguments = "{}"
+			if len(part.FunctionCall.Args) > 0 {
+				call.Function.Arguments = string(part.FunctionCall.Args)
+			}
+			toolCalls = append(toolCalls, call)
+			continue
+		}
+		if !part.Thought {
+			text.WriteString(part.Text)
+		}
+	}
+	return text.String(), toolCalls
+}
+
+// geminiFinishReason 将 Gemini finishReason 转换为 OpenAI finish_reason
+func geminiFinishReason(finishReason string, hasToolCalls bool) string {
+	switch finishReason {
+	case "MAX_TOKENS":
+		return "length"
+	case "SAFETY", "RECITATION", "BLOCKLIST", "PROHIBITED_CONTENT", "SPII", "IMAGE_SAFETY":
+		return "content_filter"
+	}
+	if hasToolCalls {
+		return "tool_calls"
+	}
+	return "stop"
+}
+
+// geminiCallIDs 生成工具调用ID（Gemini 不返回调用ID）
+func geminiCallIDs(responseID string) func() string {
+	count := 0
+	return func() string {
+		count++
+		return fmt.Sprintf("call_%s_%d", responseID, count)
+	}
+}
+
+func (geminiAdapter) convertResponse(resp *http.Response, stream bool) (*http.Response, error) {
+	if stream {
+		return translateStream(resp, newGeminiStreamTranslator()), nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("读取厂商响应失败: %w", err)
+	}
+	var parsed geminiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("解析厂商响应失败: %w", err)
+	}
+
+	callID := geminiCallIDs(parsed.ResponseID)
+	choices := make([]Choice, 0, len(parsed.Candidates))
+	for _, candidate := range parsed.Candidates {
+		text, toolCalls := candidate.split(callID)
+		message := ChatMessage{Role: "assistant", Content: json.RawMessage("null")}
+		if text != "" || len(toolCalls) == 0 {
+			message.Content, _ = json.Marshal(text)
+		}
+		if len(toolCalls) > 0 {
+			raw, _ := json.Marshal(toolCalls)
+			message.ToolCalls = (*json.RawMessage)(&raw)
+		}
+		choices = append(choices, Choice{
+			Index:        candidate.Index,
+			Message:      message,
+			FinishReason: geminiFinishReason(candidate.FinishReason, len(toolCalls) > 0),
+		})
+	}
+
+	response := ChatCompletionResponse{
+		ID:      "chatcmpl-" + parsed.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   parsed.ModelVersion,
+		Choices: choices,
+	}
+	if parsed.UsageMetadata != nil {
+		response.Usage = *parsed.UsageMetadata.toOpenAI()
+	}
+
+	converted, err := json.Marshal(response)
+	if err != nil {
+		return nil, fmt.Errorf("转换厂商响应失败: %w", err)
+	}
+	return replaceBody(resp, converted), nil
+}
+
+// geminiStreamTranslator 将 Gemini 流式数据块转换为 OpenAI chat.completion.chunk
+type geminiStreamTranslator struct {
+	id        string
+	created   int64
+	callID    func() string
+	started   map[int]bool // 已输出 role 的候选结果
+	toolCount map[int]int  // 候选结果 -> 已输出的 tool_calls 数
+}
+
+func newGeminiStreamTranslator() *geminiStreamTranslator {
+	return &geminiStreamTranslator{
+		created:   time.Now().Unix(),
+		started:   make(map[int]bool),
+		toolCount: make(map[int]int),
+	}
+}
+
+func (t *geminiStreamTranslator) translate(data []byte) []string {
+	var parsed geminiResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		return nil
+	}
+	if t.callID == nil {
+		t.id = "chatcmpl-" + parsed.ResponseID
+		t.callID = geminiCallIDs(parsed.ResponseID)
+	}
+
+	var chunks []string
+	for _, candidate := range parsed.Candidates {
+		text, toolCalls := candidate.split(t.callID)
+		delta := map[string]interface{}{}
+		if !t.started[candidate.Index] {
+			t.started[candidate.Index] = true
+			delta["role"] = "assistant"
+		}
+		if text != "" {
+			delta["content"] = text
+		}
+		if len(toolCalls) > 0 {
+			// Gemini 一次返回完整的函数调用
+			for i := range toolCalls {
+				index := t.toolCount[candidate.Index]
+				toolCalls[i].Index = &index
+				t.toolCount[candidate.Index]++
+			}
+			delta["tool_calls"] = toolCalls
+		}
+
+		var finishReason *string
+		if candidate.FinishReason != "" {
+			reason := geminiFinishReason(candidate.FinishReason, t.toolCount[candidate.Index] > 0)
+			finishReason = &reason
+		}
+		if len(delta) == 0 && finishReason == nil {
+			continue
+		}
+
+		chunk := map[string]interface{}{
+			"id":      t.id,
+			"object":  "chat.completion.chunk",
+			"created": t.created,
+			"model":   parsed.ModelVersion,
+			"choices": []map[string]interface{}{{
+				"index":         candidate.Index,
+				"delta":         delta,
+				"finish_reason": finishReason,
+			}},
+		}
+		// 结束的数据块附带累计用量
+		if finishReason != nil && parsed.UsageMetadata != nil {
+			chunk["usage"] = parsed.UsageMetadata.toOpenAI()
+		}
+		chunks = append(chunks, marshalChunk(chunk))
+	}
+	return chunks
+}
+
+// finish Gemini 流没有结束事件，厂商关闭连接后输出 [DONE]
+func (t *geminiStreamTranslator) finish() []string {
+	return []string{"[DONE]"}
+}
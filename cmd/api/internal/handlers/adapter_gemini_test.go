@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestGeminiBuildRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		wantURL string
+		want    string
+	}{
+		{
+			name:    "系统提示词和角色转换",
+			req:     `{"model":"gemini-pro","messages":[{"role":"system","content":"sys"},{"role":"user","content":"hi"},{"role":"assistant","content":"hello"}]}`,
+			wantURL: "https://g/v1beta/models/gemini-pro:generateContent",
+			want: `{"systemInstruction":{"parts":[{"text":"sys"}]},"contents":[
+				{"role":"user","parts":[{"text":"hi"}]},
+				{"role":"model","parts":[{"text":"hello"}]}]}`,
+		},
+		{
+			name: "函数调用和相邻的工具结果合并",
+			req: `{"model":"models/gemini-pro","stream":true,"messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":null,"tool_calls":[
+					{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}},
+					{"id":"c2","type":"function","function":{"name":"g","arguments":"{}"}}]},
+				{"role":"tool","tool_call_id":"c1","content":"{\"ok\":true}"},
+				{"role":"tool","tool_call_id":"c2","content":"plain"}]}`,
+			wantURL: "https://g/v1beta/models/gemini-pro:streamGenerateContent?alt=sse",
+			want: `{"contents":[
+				{"role":"user","parts":[{"text":"hi"}]},
+				{"role":"model","parts":[{"functionCall":{"name":"f","args":{"a":1}}},{"functionCall":{"name":"g","args":{}}}]},
+				{"role":"user","parts":[
+					{"functionResponse":{"name":"f","response":{"ok":true}}},
+					{"functionResponse":{"name":"g","response":{"content":"plain"}}}]}]}`,
+		},
+		{
+			name: "参数转换",
+			req: `{"model":"gemini-pro","max_tokens":10,"temperature":0.5,"stop":"END","top_p":0.9,
+				"response_format":{"type":"json_object"},
+				"tools":[{"type":"function","function":{"name":"f","parameters":{"$schema":"x","type":"object","additionalProperties":false}}}],
+				"tool_choice":{"type":"function","function":{"name":"f"}},
+				"messages":[{"role":"user","content":[{"type":"text","text":"hi"},
+					{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}},
+					{"type":"image_url","image_url":{"url":"https://img/a.png"}}]}]}`,
+			wantURL: "https://g/v1beta/models/gemini-pro:generateContent",
+			want: `{"contents":[{"role":"user","parts":[{"text":"hi"},
+					{"inlineData":{"mimeType":"image/png","data":"AAA"}},
+					{"fileData":{"fileUri":"https://img/a.png"}}]}],
+				"generationConfig":{"maxOutputTokens":10,"temperature":0.5,"stopSequences":["END"],"topP":0.9,"responseMimeType":"application/json"},
+				"tools":[{"functionDeclarations":[{"name":"f","parameters":{"type":"object"}}]}],
+				"toolConfig":{"functionCallingConfig":{"mode":"ANY","allowedFunctionNames":["f"]}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, body, err := geminiAdapter{}.buildRequest(chatRequest(t, tt.req), &upstreamTarget{BaseURL: "https://g/v1beta"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if url != tt.wantURL {
+				t.Errorf("url = %s, want %s", url, tt.wantURL)
+			}
+			assertJSON(t, body, tt.want)
+		})
+	}
+}
+
+func TestGeminiFinishReason(t *testing.T) {
+	tests := []struct {
+		finishReason string
+		hasToolCalls bool
+		want         string
+	}{
+		{"STOP", false, "stop"},
+		{"STOP", true, "tool_calls"},
+		{"MAX_TOKENS", true, "length"},
+		{"SAFETY", false, "content_filter"},
+		{"PROHIBITED_CONTENT", false, "content_filter"},
+	}
+	for _, tt := range tests {
+		if got := geminiFinishReason(tt.finishReason, tt.hasToolCalls); got != tt.want {
+			t.Errorf("geminiFinishReason(%q, %v) = %q, want %q", tt.finishReason, tt.hasToolCalls, got, tt.want)
+		}
+	}
+}
+
+func TestGeminiParseModels(t *testing.T) {
+	body := []byte(`{"models":[
+		{"name":"models/gemini-1.5-pro","displayName":"Gemini 1.5 Pro","inputTokenLimit":2000000,"supportedGenerationMethods":["generateContent","countTokens"]},
+		{"name":"models/text-embedding-004","inputTokenLimit":2048,"supportedGenerationMethods":["embedContent"]},
+		{"name":"models/gemini-exp","inputTokenLimit":32768,"supportedGenerationMethods":["generateContent"]}]}`)
+	got, err := geminiAdapter{}.parseModels(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []upstreamModel{
+		{ID: "gemini-1.5-pro", DisplayName: "Gemini 1.5 Pro", ContextLength: 2000},
+		{ID: "gemini-exp", DisplayName: "gemini-exp", ContextLength: 32},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("model %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestGeminiConvertResponse(t *testing.T) {
+	body := `{"responseId":"r1","modelVersion":"gemini-pro","candidates":[{"index":0,"finishReason":"STOP","content":{"parts":[
+		{"text":"thinking","thought":true},{"text":"Hi"},{"functionCall":{"name":"f","args":{"a":1}}}]}}],
+		"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"thoughtsTokenCount":3,"cachedContentTokenCount":1}}`
+	resp := &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(bytes.NewBufferString(body))}
+	converted, err := geminiAdapter{}.convertResponse(resp, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(converted.Body)
+
+	var parsed ChatCompletionResponse
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if parsed.ID != "chatcmpl-r1" || parsed.Model != "gemini-pro" || len(parsed.Choices) != 1 {
+		t.Fatalf("response = %s", data)
+	}
+	choice := parsed.Choices[0]
+	if string(choice.Message.Content) != `"Hi"` || choice.FinishReason != "tool_calls" {
+		t.Errorf("choice = %s / %s", choice.Message.Content, choice.FinishReason)
+	}
+	if calls := parseToolCalls(choice.Message.ToolCalls); len(calls) != 1 || calls[0].ID != "call_r1_1" || calls[0].Function.Arguments != `{"a":1}` {
+		t.Errorf("tool_calls = %+v", calls)
+	}
+	if u := parsed.Usage; u.PromptTokens != 4 || u.CompletionTokens != 5 || u.TotalTokens != 9 || u.PromptTokensDetails == nil || u.PromptTokensDetails.CachedTokens != 1 {
+		t.Errorf("usage = %+v", u)
+	}
+}
+
+func TestGeminiStreamTranslator(t *testing.T) {
+	events := []string{
+		`{"responseId":"r1","modelVersion":"gemini-pro","candidates":[{"index":0,"content":{"parts":[{"text":"He"}]}}]}`,
+		`{"responseId":"r1","modelVersion":"gemini-pro","candidates":[{"index":0,"content":{"parts":[{"text":"llo"},{"functionCall":{"name":"f","args":{}}}]}}]}`,
+		`{"responseId":"r1","modelVersion":"gemini-pro","candidates":[{"index":0,"finishReason":"STOP","content":{"parts":[]}}],
+			"usageMetadata":{"promptTokenCount":4,"candidatesTokenCount":2,"totalTokenCount":6}}`,
+	}
+	translator := newGeminiStreamTranslator()
+	var chunks []string
+	for _, event := range events {
+		chunks = append(chunks, translator.translate([]byte(event))...)
+	}
+	chunks = append(chunks, translator.finish()...)
+
+	if n := len(chunks); n != 4 || chunks[n-1] != "[DONE]" {
+		t.Fatalf("chunks = %q", chunks)
+	}
+
+	var role, content, finishReason string
+	var calls []openAIToolCall
+	var usage *Usage
+	for _, data := range chunks[:len(chunks)-1] {
+		chunk := decodeStreamChunk(&sseEvent{Data: data})
+		if chunk == nil {
+			t.Fatalf("无法解码数据块: %s", data)
+		}
+		if chunk.ID != "chatcmpl-r1" {
+			t.Errorf("chunk id = %s", chunk.ID)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage
+		}
+		for _, choice := range chunk.Choices {
+			role += choice.Delta.Role
+			content += choice.Delta.Content
+			calls = append(calls, choice.Delta.ToolCalls...)
+			if choice.FinishReason != nil {
+				finishReason = *choice.FinishReason
+			}
+		}
+	}
+	if role != "assistant" || content != "Hello" || finishReason != "tool_calls" {
+		t.Errorf("role=%q content=%q finish=%q", role, content, finishReason)
+	}
+	if len(calls) != 1 || calls[0].ID != "call_r1_1" || calls[0].Index == nil || *calls[0].Index != 0 || calls[0].Function.Arguments != "{}" {
+		t.Errorf("tool_calls = %+v", calls)
+	}
+	if usage == nil || usage.TotalTokens != 6 {
+		t.Errorf("usage = %+v", usage)
+	}
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"log"
 	"net/http"
 	"strconv"
 
@@ -23,6 +24,7 @@ func (h *Handler) CreateAPIKey(c echo.Context) error {
 	var req struct {
 		KeyName string `json:"key_name"`
 		Prompt  string `json:"prompt"`
+		models.APIKeyLimits
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -36,7 +38,14 @@ func (h *Handler) CreateAPIKey(c echo.Context) error {
 		req.KeyName = "Default Key"
 	}
 
-	apiKey, err := h.apiKeyService.GenerateAPIKey(userID, req.KeyName, req.Prompt)
+	if !validAPIKeyLimits(req.APIKeyLimits) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "限流配置不能为负数",
+		})
+	}
+
+	apiKey, err := h.apiKeyService.GenerateAPIKey(userID, req.KeyName, req.Prompt, req.APIKeyLimits)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
@@ -61,6 +70,13 @@ type APIKeyWithPrompts struct {
 	Prompts   []*models.APIKeyPrompt `json:"prompts"`    // 关联的提示词数组
 	CreatedAt string                `json:"created_at"`
 	UpdatedAt string                `json:"updated_at"`
+	Quotas    []models.Quota        `json:"quotas"` // 作用于该密钥的配额（含用户级配额）
+	models.APIKeyLimits
+}
+
+// validAPIKeyLimits 检查限流配置是否合法（0 表示不限制）
+func validAPIKeyLimits(limits models.APIKeyLimits) bool {
+	return limits.RPMLimit >= 0 && limits.TPMLimit >= 0 && limits.MaxConcurrentStreams >= 0
 }
 
 // GetAPIKeys 获取当前用户的API密钥列表
@@ -97,6 +113,8 @@ func (h *Handler) GetAPIKeys(c echo.Context) error {
 			Prompts:   prompts,
 			CreatedAt: apiKey.CreatedAt.Format("2006-01-02 15:04:05"),
 			UpdatedAt: apiKey.UpdatedAt.Format("2006-01-02 15:04:05"),
+			Quotas:    h.quotaService.GetAPIKeyQuotas(userID, apiKey.ID),
+			APIKeyLimits: apiKey.APIKeyLimits,
 		})
 	}
 
@@ -149,6 +167,11 @@ func (h *Handler) DeleteAPIKey(c echo.Context) error {
 		})
 	}
 
+	// 清理该密钥的配额
+	if err := h.quotaService.DeleteByAPIKey(id); err != nil {
+		log.Printf("[WARN] 清理API密钥配额失败 (api_key_id: %d): %v", id, err)
+	}
+
 	return c.JSON(http.StatusOK, Response{
 		Code:    0,
 		Message: "删除成功",
@@ -175,8 +198,11 @@ func (h *Handler) UpdateAPIKey(c echo.Context) error {
 	}
 
 	var req struct {
-		KeyName string `json:"key_name"`
-		Prompt  string `json:"prompt"`
+		KeyName              string `json:"key_name"`
+		Prompt               string `json:"prompt"`
+		RPMLimit             *int   `json:"rpm_limit"`
+		TPMLimit             *int   `json:"tpm_limit"`
+		MaxConcurrentStreams *int   `json:"max_concurrent_streams"`
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -186,7 +212,32 @@ func (h *Handler) UpdateAPIKey(c echo.Context) error {
 		})
 	}
 
-	apiKey, err := h.apiKeyService.UpdateAPIKey(id, userID, req.KeyName, req.Prompt)
+	// 未传的限流字段保持原值
+	existing, err := h.apiKeyService.ValidateAPIKeyByID(id)
+	if err != nil || existing == nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: "API密钥不存在",
+		})
+	}
+	limits := existing.APIKeyLimits
+	if req.RPMLimit != nil {
+		limits.RPMLimit = *req.RPMLimit
+	}
+	if req.TPMLimit != nil {
+		limits.TPMLimit = *req.TPMLimit
+	}
+	if req.MaxConcurrentStreams != nil {
+		limits.MaxConcurrentStreams = *req.MaxConcurrentStreams
+	}
+	if !validAPIKeyLimits(limits) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "限流配置不能为负数",
+		})
+	}
+
+	apiKey, err := h.apiKeyService.UpdateAPIKey(id, userID, req.KeyName, req.Prompt, limits)
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
@@ -22,7 +22,10 @@ type Handler struct {
 	apiKeyService       *service.APIKeyService
 	apiKeyPromptService *service.APIKeyPromptService
 	providerService     *service.ProviderService
+	providerKeyService  *service.ProviderKeyService
 	modelService        *service.ModelService
+	usageService        *service.UsageService
+	quotaService        *service.QuotaService
 	cfg                 *config.Config
 	jwtSecret           string
 	jwtExpiration       time.Duration
@@ -35,7 +38,10 @@ func NewHandler(cfg *config.Config) *Handler {
 		apiKeyService:       service.NewAPIKeyService(),
 		apiKeyPromptService: service.NewAPIKeyPromptService(),
 		providerService:     service.NewProviderService(),
+		providerKeyService:  service.NewProviderKeyService(),
 		modelService:        service.NewModelService(),
+		usageService:        service.NewUsageService(),
+		quotaService:        service.NewQuotaService(),
 		cfg:                 cfg,
 		jwtSecret:           cfg.JWT.Secret,
 		jwtExpiration:       parseExpiration(cfg.JWT.Expiration),
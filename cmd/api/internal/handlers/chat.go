@@ -1,13 +1,10 @@
 package handlers
 
 import (
-	"bufio"
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
-	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -15,6 +12,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/models"
 	"github.com/tiktoken-go/tokenizer"
 )
 
@@ -30,16 +28,11 @@ func init() {
 		MaxIdleConns:        100,              // 全局空闲连接数
 		MaxIdleConnsPerHost: 10,               // 每个 host 的空闲连接数
 		IdleConnTimeout:     90 * time.Second, // 空闲连接超时
-		DialContext: (&net.Dialer{
-			Timeout:   30 * time.Second,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:         dialContext,      // 建立连接超时按厂商配置
 	}
-	// 注意：SSE 流式请求不能设置整体超时，由 context 控制
-	// 这里设置的超时只适用于普通请求
+	// 注意：SSE 流式请求不能设置整体超时，首字节和空闲超时由 sendHTTP 按厂商配置控制
 	globalHTTPClient = &http.Client{
 		Transport: transport,
-		Timeout:   300 * time.Second, // 调整为 5 分钟，用于普通请求
 	}
 }
 
@@ -224,9 +217,15 @@ type Choice struct {
 
 // Usage 使用统计
 type Usage struct {
-	PromptTokens     int `json:"prompt_tokens"`
-	CompletionTokens int `json:"completion_tokens"`
-	TotalTokens      int `json:"total_tokens"`
+	PromptTokens        int                  `json:"prompt_tokens"`
+	CompletionTokens    int                  `json:"completion_tokens"`
+	TotalTokens         int                  `json:"total_tokens"`
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+// PromptTokensDetails 输入token明细
+type PromptTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"` // 命中厂商缓存的输入token数
 }
 
 // ChatStreamChunk 流式响应块
@@ -236,15 +235,21 @@ type ChatStreamChunk struct {
 	Created int64          `json:"created"`
 	Model   string         `json:"model"`
 	Choices []StreamChoice `json:"choices"`
+	Usage   *Usage         `json:"usage,omitempty"` // 开启 stream_options.include_usage 时最后一个数据块携带
+	Error   *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"` // 部分厂商在流中返回错误
 }
 
 // StreamChoice 流式选择
 type StreamChoice struct {
 	Index int `json:"index"`
 	Delta struct {
-		Role    string `json:"role,omitempty"`
-		Content string `json:"content,omitempty"`
+		Role      string           `json:"role,omitempty"`
+		Content   string           `json:"content,omitempty"`
+		ToolCalls []openAIToolCall `json:"tool_calls,omitempty"`
 	} `json:"delta"`
+	Text         string  `json:"text,omitempty"` // 旧版文本补全
 	FinishReason *string `json:"finish_reason,omitempty"`
 }
 
@@ -259,9 +264,8 @@ func countMessageTokens(msg ChatMessage, enc tokenizer.Codec) int {
 	// 添加角色标记的 token（OpenAI 格式）
 	tokens += 1 // role 标签
 
-	// 计算 content 的 token 数
-	content := string(msg.Content)
-	contentTokens, _, _ := enc.Encode(content)
+	// 计算 content 的 token 数（只计文本）
+	contentTokens, _, _ := enc.Encode(messageText(msg.Content))
 	tokens += len(contentTokens)
 
 	// 添加内容标记的 token
@@ -273,28 +277,102 @@ func countMessageTokens(msg ChatMessage, enc tokenizer.Codec) int {
 	return tokens
 }
 
-// countMessagesTokens 计算 messages 的 token 总数
-func countMessagesTokens(messages []ChatMessage) int {
+// countTextTokens 计算文本的 token 数量
+func countTextTokens(text string) int {
+	if text == "" {
+		return 0
+	}
 	if globalTokenizer == nil {
 		// 回退：简单估算
-		total := 0
-		for _, msg := range messages {
-			total += len(msg.Role) + len(string(msg.Content)) + 10
-		}
-		return total
+		return len(text) / 4
 	}
 
+	tokens, _, _ := globalTokenizer.Encode(text)
+	return len(tokens)
+}
+
+// countMessagesTokens 计算 messages 的 token 总数
+func countMessagesTokens(messages []ChatMessage) int {
 	total := 0
 	for _, msg := range messages {
-		total += countMessageTokens(msg, globalTokenizer)
+		total += countChatMessageTokens(msg)
 	}
 	return total
 }
 
-// truncateLongTexts 截断过长文本
-// 找到倒数第N个 user 角色的消息索引，截断从模型第一次调用工具到该消息之间指定类型消息的过长text
-// 返回修改后的消息和日志字符串
-func truncateLongTexts(messages []ChatMessage, userCount int, truncateLen int, roleTypes string) ([]ChatMessage, string) {
+// countChatMessageTokens 计算单条消息的 token 数
+func countChatMessageTokens(msg ChatMessage) int {
+	if globalTokenizer == nil {
+		// 回退：简单估算
+		return len(msg.Role) + len(messageText(msg.Content)) + 10
+	}
+	return countMessageTokens(msg, globalTokenizer)
+}
+
+// messageText 返回消息内容中的文本，内容数组只取各部分的 text 字段
+// 图片、音频和文件等部分（如 base64 编码的 image_url）不计入，厂商按各自的规则计费
+func messageText(content json.RawMessage) string {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text
+	}
+	var parts []struct {
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return ""
+	}
+	var b strings.Builder
+	for _, part := range parts {
+		b.WriteString(part.Text)
+	}
+	return b.String()
+}
+
+// requestedMaxTokens 返回请求的最大输出 token 数（max_tokens 或 max_completion_tokens），未指定时为 0
+func requestedMaxTokens(req ChatCompletionRequest) int {
+	if req.MaxTokens != nil {
+		return *req.MaxTokens
+	}
+	if maxTokens, ok := req.Extra["max_completion_tokens"].(float64); ok {
+		return int(maxTokens)
+	}
+	return 0
+}
+
+// compressForContext 模型开启压缩且请求超出上下文预算时压缩消息，返回压缩后的消息、token 数和压缩日志
+// fits 为 false 表示压缩后仍超出模型的上下文长度；未开启压缩的模型不做判断，由厂商决定是否接受
+// （本地 token 数只是估算，与各厂商的 tokenizer 并不一致）
+func (h *Handler) compressForContext(model *models.Model, messages []ChatMessage, tokenCount, maxTokens int) ([]ChatMessage, int, string, bool) {
+	if !model.CompressEnabled {
+		return messages, tokenCount, "", true
+	}
+
+	contextTokens := model.ContextTokens()
+	var compressLog string
+	if budget := h.cfg.Proxy.CompressBudget(contextTokens); tokenCount+maxTokens > budget {
+		messages, tokenCount, compressLog = compressToBudget(messages, budget, maxTokens, model.CompressUserCount, model.CompressTruncateLen, model.CompressRoleTypes)
+	}
+	return messages, tokenCount, compressLog, tokenCount+maxTokens <= contextTokens
+}
+
+// compressToBudget 按上下文预算截断过长文本
+// 消息 token 数加上预留的输出 token 数不超过 budget 时不压缩；否则从最早的对话轮次开始，
+// 每轮把截断范围向后推进到下一个 user 消息，直到放入预算或推进到倒数第 userCount 个 user 消息为止。
+// 只截断模型第一次调用工具之后、指定类型的消息，system 消息和最近 userCount 轮对话始终保留原文；
+// 没有工具调用、user 消息不足 userCount 个或截断后仍超出预算时，交给 compressOldestTurns 处理更早的对话
+// 返回修改后的消息、消息的 token 数和日志字符串
+func compressToBudget(messages []ChatMessage, budget, reserved, userCount, truncateLen int, roleTypes string) ([]ChatMessage, int, string) {
+	tokens := make([]int, len(messages))
+	total := 0
+	for i, msg := range messages {
+		tokens[i] = countChatMessageTokens(msg)
+		total += tokens[i]
+	}
+	if total+reserved <= budget {
+		return messages, total, ""
+	}
+
 	// 解析角色类型配置，用于截断这些类型消息的 text
 	targetRoles := map[string]bool{}
 	if roleTypes == "" {
@@ -311,7 +389,7 @@ func truncateLongTexts(messages []ChatMessage, userCount int, truncateLen int, r
 		}
 	}
 
-	// 从前往后找到第一个包含 ToolCalls（模型决定调用工具）的 assistant 消息索引
+	// 从前往后找到第一个包含 ToolCalls（模型决定调用工具）的 assistant 消息索引，之前的消息不截断
 	targetToolIndex := -1
 	for i := 0; i < len(messages); i++ {
 		if messages[i].Role == "assistant" && messages[i].ToolCalls != nil {
@@ -320,133 +398,235 @@ func truncateLongTexts(messages []ChatMessage, userCount int, truncateLen int, r
 		}
 	}
 
-	// 从后往前找到第N个 user 角色的消息，获取其索引
-	count := 0
-	targetMsgIndex := -1
-	for i := len(messages) - 1; i >= 0; i-- {
+	// 每个 user 消息是一个截断边界，最后一个边界为倒数第N个 user 消息
+	var boundaries []int
+	for i := range messages {
 		if messages[i].Role == "user" {
-			count++
-			if count == userCount {
-				targetMsgIndex = i
-				break
-			}
+			boundaries = append(boundaries, i)
 		}
 	}
+	if targetToolIndex == -1 || userCount < 1 || len(boundaries) < userCount {
+		return compressOldestTurns(messages, tokens, total, budget, reserved, userCount, truncateLen, targetRoles)
+	}
+	boundaries = boundaries[:len(boundaries)-userCount+1]
 
-	if targetMsgIndex == -1 {
-		return messages, ""
+	// 逐轮推进，截断 [done, boundary) 之间消息的过长 text
+	originalTotal := total
+	done := targetToolIndex
+	for _, boundary := range boundaries {
+		if boundary <= done {
+			continue
+		}
+		for i := done; i < boundary; i++ {
+			if messages[i].Role == "system" || !targetRoles[messages[i].Role] {
+				continue
+			}
+			if truncateMessageText(&messages[i], truncateLen) {
+				total -= tokens[i]
+				tokens[i] = countChatMessageTokens(messages[i])
+				total += tokens[i]
+			}
+		}
+		done = boundary
+		if total+reserved <= budget {
+			break
+		}
 	}
-	// 如果没有工具调用或工具调用在目标消息之后，则无需截断
-	if targetToolIndex == -1 || targetToolIndex > targetMsgIndex {
-		return messages, ""
+
+	var logMsg string
+	if total != originalTotal {
+		logMsg = fmt.Sprintf("[CONTEXT] 超出上下文预算 %d，已截断第%d到第%d条消息的过长文本 (总消息数: %d, tokens: %d -> %d)",
+			budget, targetToolIndex, done-1, len(messages), originalTotal, total)
+	}
+	if total+reserved > budget {
+		var fallbackLog string
+		messages, total, fallbackLog = compressOldestTurns(messages, tokens, total, budget, reserved, userCount, truncateLen, targetRoles)
+		if fallbackLog != "" {
+			logMsg = strings.TrimSpace(logMsg + " " + fallbackLog)
+		}
 	}
+	return messages, total, logMsg
+}
 
-	// 循环所有消息，截断在 targetToolIndex 和 targetMsgIndex 之间的消息的过长 text
-	modified := false
+// compressOldestTurns 从最早的对话轮次开始逐轮截断过长文本，仍超出预算时再逐轮丢弃最早的对话
+// 一轮从 user 消息开始到下一个 user 消息之前，整轮丢弃以保证工具调用和工具结果成对出现；
+// system 消息和最近 userCount 轮对话（user 消息不足时为最后一轮）始终保留，tokens 为各消息的 token 数
+func compressOldestTurns(messages []ChatMessage, tokens []int, total, budget, reserved, userCount, truncateLen int, targetRoles map[string]bool) ([]ChatMessage, int, string) {
+	var users []int
 	for i := range messages {
+		if messages[i].Role == "user" {
+			users = append(users, i)
+		}
+	}
+	keepFrom := len(messages) - 1
+	switch {
+	case userCount >= 1 && len(users) >= userCount:
+		keepFrom = users[len(users)-userCount]
+	case len(users) > 0:
+		keepFrom = users[len(users)-1]
+	}
+
+	// 划分 keepFrom 之前的对话轮次，system 消息不属于任何一轮
+	var turns [][]int
+	for i := 0; i < keepFrom; i++ {
 		if messages[i].Role == "system" {
 			continue
 		}
-		if i >= targetMsgIndex {
-			continue // 只截断小于目标索引的消息
+		if len(turns) == 0 || messages[i].Role == "user" {
+			turns = append(turns, nil)
 		}
-		if i < targetToolIndex {
-			continue // 只截断大于等于工具调用索引的消息
+		turns[len(turns)-1] = append(turns[len(turns)-1], i)
+	}
+
+	originalTotal := total
+	truncated := 0
+	for _, turn := range turns {
+		if total+reserved <= budget {
+			break
 		}
-		// 只截断指定类型消息的 text
-		if !targetRoles[messages[i].Role] {
-			continue
+		for _, i := range turn {
+			if targetRoles[messages[i].Role] && truncateMessageText(&messages[i], truncateLen) {
+				total -= tokens[i]
+				tokens[i] = countChatMessageTokens(messages[i])
+				total += tokens[i]
+				truncated++
+			}
 		}
+	}
 
-		// 解析 content
-		var content []map[string]interface{}
-		contentStr := string(messages[i].Content)
-		if err := json.Unmarshal([]byte(contentStr), &content); err != nil {
-			continue
+	dropped := make(map[int]bool)
+	for _, turn := range turns {
+		if total+reserved <= budget {
+			break
+		}
+		for _, i := range turn {
+			dropped[i] = true
+			total -= tokens[i]
 		}
+	}
 
-		for _, item := range content {
-			if text, ok := item["text"].(string); ok {
-				if len(text) > truncateLen {
-					item["text"] = text[:truncateLen]
-					modified = true
-				}
+	if total == originalTotal {
+		return messages, total, ""
+	}
+	if len(dropped) > 0 {
+		kept := make([]ChatMessage, 0, len(messages)-len(dropped))
+		for i, msg := range messages {
+			if !dropped[i] {
+				kept = append(kept, msg)
 			}
 		}
+		messages = kept
+	}
+	logMsg := fmt.Sprintf("[CONTEXT] 超出上下文预算 %d，已截断 %d 条消息的过长文本、丢弃最早的 %d 条消息 (总消息数: %d, tokens: %d -> %d)",
+		budget, truncated, len(dropped), len(messages), originalTotal, total)
+	return messages, total, logMsg
+}
 
-		if modified {
-			newContent, err := json.Marshal(content)
-			if err != nil {
-				continue
-			}
-			messages[i].Content = newContent
+// truncateMessageText 截断消息 content（字符串或内容数组）中过长的 text，返回是否有修改
+func truncateMessageText(msg *ChatMessage, truncateLen int) bool {
+	var text string
+	if err := json.Unmarshal(msg.Content, &text); err == nil {
+		if len(text) <= truncateLen {
+			return false
+		}
+		newContent, err := json.Marshal(text[:truncateLen])
+		if err != nil {
+			return false
 		}
+		msg.Content = newContent
+		return true
 	}
 
-	var logMsg string
-	if modified {
-		roleLabel := "user"
-		if roleTypes != "" {
-			roleLabel = roleTypes
+	// 解析 content
+	var content []map[string]interface{}
+	if err := json.Unmarshal(msg.Content, &content); err != nil {
+		return false
+	}
+
+	modified := false
+	for _, item := range content {
+		if text, ok := item["text"].(string); ok {
+			if len(text) > truncateLen {
+				item["text"] = text[:truncateLen]
+				modified = true
+			}
 		}
-		logMsg = fmt.Sprintf("[CONTEXT] 已截断所有小于第%d个%s消息的过长文本 (总消息数: %d)", targetMsgIndex, roleLabel, len(messages))
+	}
+	if !modified {
+		return false
 	}
 
-	return messages, logMsg
+	newContent, err := json.Marshal(content)
+	if err != nil {
+		return false
+	}
+	msg.Content = newContent
+	return true
 }
 
-// ChatCompletion 聊天补全处理函数
-// POST /api/v1/chat/completions
-func (h *Handler) ChatCompletion(c echo.Context) error {
+// authenticateAPIKey 从 Authorization 请求头（或 Anthropic 客户端使用的 x-api-key）中提取 API 密钥并查找所属用户
+func authenticateAPIKey(c echo.Context) (string, uint64, bool) {
 	// 从请求头获取API密钥
 	authHeader := c.Request().Header.Get("Authorization")
+	if authHeader == "" {
+		if apiKey := c.Request().Header.Get("x-api-key"); apiKey != "" {
+			authHeader = "Bearer " + apiKey
+		}
+	}
 	if authHeader == "" {
 		log.Printf("[ERROR] 请求头中没有Authorization")
-		return c.JSON(http.StatusUnauthorized, Response{
-			Code:    401,
-			Message: "Invalid API key",
-		})
+		return "", 0, false
 	}
 
 	// 提取Bearer token
 	apiKey := strings.TrimPrefix(authHeader, "Bearer ")
 	if apiKey == "" {
 		log.Printf("[ERROR] 请求头中没有Bearer token")
-		return c.JSON(http.StatusUnauthorized, Response{
-			Code:    401,
-			Message: "Invalid API key",
-		})
+		return "", 0, false
 	}
 
 	// 检查API密钥是否在全局缓存中，并获取用户ID
 	userID, exists := cache.GetCache().GetUserIDByAPIKey(apiKey)
 	if !exists {
 		log.Printf("[ERROR] API密钥不存在")
-		return c.JSON(http.StatusUnauthorized, Response{
-			Code:    401,
-			Message: "Invalid API key",
-		})
+		return "", 0, false
 	}
 
+	return apiKey, userID, true
+}
+
+// ChatCompletion 聊天补全处理函数
+// POST /api/v1/chat/completions
+func (h *Handler) ChatCompletion(c echo.Context) error {
+	startTime := time.Now()
+
+	// 验证API密钥并获取用户ID
+	apiKey, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "Incorrect API key provided")
+	}
+
+	apiKeyID, _ := cache.GetCache().GetAPIKeyID(apiKey)
+
 	// 读取请求体
 	body, err := io.ReadAll(c.Request().Body)
 	if err != nil {
 		log.Printf("[ERROR] 读取请求体失败: %v", err)
-		return c.JSON(http.StatusBadRequest, Response{
-			Code:    400,
-			Message: "读取请求体失败",
-		})
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Failed to read request body")
 	}
 	// 解析请求
 	var req ChatCompletionRequest
 	if err := json.Unmarshal(body, &req); err != nil {
 		log.Printf("[ERROR] 解析请求失败: %v", err)
-		return c.JSON(http.StatusBadRequest, Response{
-			Code:    400,
-			Message: "解析请求失败",
-		})
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Invalid JSON in request body: "+err.Error())
 	}
 
+	return h.proxyChat(c, startTime, apiKey, apiKeyID, userID, body, req, openAIOutput{})
+}
+
+// proxyChat 聊天补全代理流程：模型检查、限流、配额、压缩、提示词注入、转发厂商并由 output 写回响应
+// body 为原始请求体，req 为 OpenAI 格式的请求
+func (h *Handler) proxyChat(c echo.Context, startTime time.Time, apiKey string, apiKeyID, userID uint64, body []byte, req ChatCompletionRequest, output chatOutput) error {
 	// 解析 messages 为 []ChatMessage，确保 Extra 完整
 	var messages []ChatMessage
 	if err := json.Unmarshal(req.Messages, &messages); err != nil {
@@ -464,49 +644,58 @@ func (h *Handler) ChatCompletion(c echo.Context) error {
 	// 验证模型参数
 	if req.Model == "" {
 		log.Printf("[ERROR] 模型参数不能为空")
-		return c.JSON(http.StatusBadRequest, Response{
-			Code:    400,
-			Message: "模型参数不能为空",
-		})
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "You must provide a model parameter")
+	}
+
+	// 从缓存中查找模型，检查归属、启用状态和可用时间段
+	modelItem, err := h.resolveModel(c, userID, req.Model)
+	if err != nil {
+		log.Printf("[ERROR] 模型不可用 (%s): %v", req.Model, err)
+		return modelAccessErrorResponse(c, err)
 	}
 
-	// 从缓存中查找模型
-	modelItem, err := h.findModelByName(req.Model)
+	// 在判断截断之前计算原始 token 数
+	originalTokenCount := countMessagesTokens(messages)
+
+	// 检查API密钥的请求频率、token用量和流式并发限制
+	limit, err := cache.GetCache().AcquireAPIKeyLimit(apiKey, req.Stream, originalTokenCount)
 	if err != nil {
-		log.Printf("[ERROR] 模型不存在: %v", err)
-		return c.JSON(http.StatusNotFound, Response{
-			Code:    404,
-			Message: err.Error(),
-		})
+		log.Printf("[WARN] API密钥触发限流 (api_key_id: %d): %v", apiKeyID, err)
+		return rateLimitError(c, err)
 	}
+	defer limit.Release()
+	setRateLimitHeaders(c, limit.Status)
 
-	// 检查模型是否属于该API密钥的用户
-	if modelItem.Model.UserID != userID {
-		log.Printf("[ERROR] 模型不属于该API密钥的用户")
-		return c.JSON(http.StatusForbidden, Response{
-			Code:    403,
-			Message: "This model does not belong to your account",
-		})
+	// 检查用户和API密钥的用量配额，按输入 token 数和 max_tokens 预占
+	maxTokens := requestedMaxTokens(req)
+	reservation, err := h.quotaService.Reserve(userID, apiKeyID, originalTokenCount+maxTokens,
+		modelItem.Model.ModelPricing.Cost(originalTokenCount, 0, maxTokens))
+	if err != nil {
+		log.Printf("[WARN] 用量配额已用尽 (api_key_id: %d): %v", apiKeyID, err)
+		return quotaError(c, err)
 	}
 
+	// 记录本次代理请求的用量
+	tracker := newUsageTracker(startTime, userID, apiKeyID, req.Model, modelItem, req.Stream)
+	tracker.limit = limit
+	tracker.quota = reservation
+	defer h.recordUsage(c, tracker)
+
 	// 定义日志附加信息字符串
 	var logExtra string
 
-	// 在判断截断之前计算原始 token 数
-	originalTokenCount := countMessagesTokens(messages)
-
-	// 根据模型配置压缩/截断消息
-	if modelItem.Model.CompressEnabled {
-		// 截断过长文本：找到指定数量 user 角色的消息，截断其content中过长的text
-		truncatedMessages, truncateLog := truncateLongTexts(messages, modelItem.Model.CompressUserCount, modelItem.Model.CompressTruncateLen, modelItem.Model.CompressRoleTypes)
-		messages = truncatedMessages
-		if truncateLog != "" {
-			logExtra += " " + truncateLog
-		}
+	// 根据模型配置压缩/截断消息：只在请求超出上下文预算时压缩，压缩后仍超出上下文长度时直接拒绝
+	messages, tokenCount, compressLog, fits := h.compressForContext(&modelItem.Model, messages, originalTokenCount, maxTokens)
+	if compressLog != "" {
+		logExtra += " " + compressLog
+	}
+	if !fits {
+		contextTokens := modelItem.Model.ContextTokens()
+		log.Printf("[WARN] 压缩后仍超出模型上下文长度 (model: %s, context: %d, messages: %d, max_tokens: %d)", req.Model, contextTokens, tokenCount, maxTokens)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, errCodeContextLength,
+			fmt.Sprintf("This model's maximum context length is %d tokens. However, you requested %d tokens (%d in the messages, %d in the completion). Please reduce the length of the messages or the completion.",
+				contextTokens, tokenCount+maxTokens, tokenCount, maxTokens))
 	}
-
-	// 计算 token 数
-	tokenCount := countMessagesTokens(messages)
 
 	// 输出请求日志
 	log.Printf("client IP: %s, model: %s, model_id: %s, body tokens: %d (原tokens: %d)%s", c.RealIP(), req.Model, modelItem.Model.ModelID, tokenCount, originalTokenCount, logExtra)
@@ -593,73 +782,45 @@ func (h *Handler) ChatCompletion(c echo.Context) error {
 		}
 	}
 
-	// 准备转发到厂商的请求
-	providerURL := modelItem.ProviderBaseURL + "/chat/completions"
-	providerKey := modelItem.ProviderKey
+	// 记录 token 数（提示词追加后的消息数作为 prompt tokens 估算值）
+	tracker.setTokens(originalTokenCount, tokenCount, countMessagesTokens(messages))
 
-	// 更新 messages 和 model
+	// 更新 messages
 	req.Messages = MarshalMessagesToJSON(messages)
-	req.Model = modelItem.Model.ModelID
-
-	// 直接序列化 req（包含所有已修改的消息和 Extra 字段）
-	providerReqBody, err := req.MarshalJSON()
-	if err != nil {
-		log.Printf("[ERROR] 序列化请求失败: %v", err)
-		return c.JSON(http.StatusInternalServerError, Response{
-			Code:    500,
-			Message: "序列化请求失败",
-		})
-	}
 
-	if h.cfg.Debug {
-		if err := writeDynamicFile("providerReqBody.json", providerReqBody); err != nil {
-			log.Printf("[WARN] 写入调试文件失败: %v", err)
-		} else {
-			log.Printf("[DEBUG] 序列化请求体: providerReqBody.json")
-		}
+	// 发送请求到厂商（主目标失败时依次尝试备用目标）
+	resp, target, err := h.sendUpstream(c.Request().Context(), req, upstreamTargets(modelItem))
+	if err != nil && c.Request().Context().Err() != nil {
+		return clientCancelled(c, tracker)
 	}
-
-	// 发送请求到厂商
-	providerReq, err := http.NewRequest("POST", providerURL, bytes.NewReader(providerReqBody))
-	if err != nil {
-		log.Printf("[ERROR] 创建请求失败: %v", err)
-		return c.JSON(http.StatusInternalServerError, Response{
-			Code:    500,
-			Message: "创建请求失败",
-		})
-	}
-
-	// 设置请求头
-	providerReq.Header.Set("Content-Type", "application/json")
-	providerReq.Header.Set("Authorization", "Bearer "+providerKey)
-
-	// 发送请求
-	resp, err := globalHTTPClient.Do(providerReq)
 	if err != nil {
 		log.Printf("[ERROR] 请求厂商失败: %v", err)
-		return c.JSON(http.StatusBadGateway, Response{
-			Code:    502,
-			Message: "请求厂商失败: " + err.Error(),
-		})
+		return upstreamRequestError(c, err)
 	}
 	defer resp.Body.Close()
 
+	// 记录实际服务的目标
+	tracker.setTarget(target)
+	h.setUpstreamModelHeader(c, target)
+	if target.Index > 0 {
+		log.Printf("[FALLBACK] model: %s 由备用目标 #%d 服务 (provider: %s, model_id: %s)", modelItem.CacheKey(), target.Index, target.ProviderName, target.ModelID)
+	}
+
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
 		log.Printf("[ERROR] 厂商返回错误 (status: %d): %s", resp.StatusCode, string(respBody))
-		return c.JSON(http.StatusBadGateway, Response{
-			Code:    502,
-			Message: "厂商返回错误: " + string(respBody),
-		})
+		return upstreamError(c, resp.StatusCode, resp.Header, respBody)
 	}
 
 	// 如果不流式，直接返回响应
 	if !req.Stream {
-		respBody, _ := io.ReadAll(resp.Body)
-		// 直接返回厂商的响应
-		c.Response().Header().Set("Content-Type", "application/json")
-		return c.String(http.StatusOK, string(respBody))
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil && c.Request().Context().Err() != nil {
+			return clientCancelled(c, tracker)
+		}
+		tracker.observeResponse(respBody)
+		return output.writeResponse(c, rewriteModelField(respBody, req.Model))
 	}
 
 	// 流式响应
@@ -672,70 +833,53 @@ func (h *Handler) ChatCompletion(c echo.Context) error {
 	c.Response().WriteHeader(http.StatusOK)
 	c.Response().Flush()
 
-	// 使用 bufio.Reader 实时读取并转发每个数据块
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				// 正常结束
-				break
-			}
-			// 连接错误
-			return nil
-		}
-
-		// 检测是否包含 ListMcpResources 工具调用
-		lineStr := string(line)
-		if strings.Contains(lineStr, "ListMcpResources") {
-			// 关闭当前流式响应
-			resp.Body.Close()
-
-			// 将 MCP 工具列表信息作为字符串追加到消息中
-			mcpToolsInfo := "MCP工具列表查询：以下是可用的 MCP 工具函数列表"
-
-			// 更新请求体中的消息，追加 MCP 工具信息
-			var reqData map[string]interface{}
-			if err := json.Unmarshal(body, &reqData); err == nil {
-				if messages, ok := reqData["messages"].([]interface{}); ok {
-					// 创建提示词消息
-					promptContent := []map[string]interface{}{
-						{
-							"type":          "text",
-							"text":          mcpToolsInfo,
-							"cache_control": map[string]string{"type": "ephemeral"},
-						},
-					}
+	// 逐个解析并转发厂商的 SSE 事件，检测到 ListMcpResources 工具调用时改为重新请求
+	result := h.relayStream(c, resp.Body, tracker, output, func(event *sseEvent) bool {
+		return strings.Contains(event.Data, "ListMcpResources")
+	})
+	switch result {
+	case streamIntercepted:
+		// 关闭当前流式响应
+		resp.Body.Close()
+
+		// 将 MCP 工具列表信息作为字符串追加到消息中
+		mcpToolsInfo := "MCP工具列表查询：以下是可用的 MCP 工具函数列表"
+
+		// 更新请求体中的消息，追加 MCP 工具信息
+		var reqData map[string]interface{}
+		if err := json.Unmarshal(body, &reqData); err == nil {
+			if messages, ok := reqData["messages"].([]interface{}); ok {
+				// 创建提示词消息
+				promptContent := []map[string]interface{}{
+					{
+						"type":          "text",
+						"text":          mcpToolsInfo,
+						"cache_control": map[string]string{"type": "ephemeral"},
+					},
+				}
 
-					// 创建 user 消息
-					userMsg := map[string]interface{}{
-						"role":    "user",
-						"content": promptContent,
-					}
-					// 将提示词作为 user 消息追加到消息数组最后
-					messages = append(messages, userMsg)
-					reqData["messages"] = messages
+				// 创建 user 消息
+				userMsg := map[string]interface{}{
+					"role":    "user",
+					"content": promptContent,
+				}
+				// 将提示词作为 user 消息追加到消息数组最后
+				messages = append(messages, userMsg)
+				reqData["messages"] = messages
 
-					// 重新编码请求体
-					if newBody, err := json.Marshal(reqData); err == nil {
-						body = newBody
-					}
+				// 重新编码请求体
+				if newBody, err := json.Marshal(reqData); err == nil {
+					body = newBody
 				}
 			}
-
-			// 重新请求模型
-			h.sendProviderRequest(c, modelItem, req)
-			return nil
 		}
 
-		// 转发数据块到客户端
-		if _, writeErr := c.Response().Writer.Write([]byte(line)); writeErr != nil {
-			// 客户端断开连接
-			return nil
-		}
-		c.Response().Flush() // 强制立即发送
+		// 重新请求模型（之前已转发的内容也计入用量）
+		h.sendProviderRequest(c, modelItem, req, tracker, output)
+		return nil
+	case streamCompleted:
+		return output.finishStream(c)
 	}
-
 	return nil
 }
 
@@ -838,58 +982,37 @@ func extractToolsStringFromExtra(extra map[string]interface{}) string {
 }
 
 // sendProviderRequest 发送请求到厂商并处理响应
-func (h *Handler) sendProviderRequest(c echo.Context, modelItem *cache.ModelCacheItem, req ChatCompletionRequest) {
-	// 准备转发到厂商的请求
-	providerURL := modelItem.ProviderBaseURL + "/chat/completions"
-	providerKey := modelItem.ProviderKey
-
-	// 更新 model 字段为厂商实际的模型ID
-	req.Model = modelItem.Model.ModelID
-
-	// 直接序列化 req（包含所有已修改的消息）
-	providerReqBody, _ := req.MarshalJSON()
-
-	// 发送请求到厂商
-	client := globalHTTPClient
-	providerReq, err := http.NewRequest("POST", providerURL, bytes.NewReader(providerReqBody))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, Response{
-			Code:    500,
-			Message: "创建请求失败",
-		})
+func (h *Handler) sendProviderRequest(c echo.Context, modelItem *cache.ModelCacheItem, req ChatCompletionRequest, tracker *usageTracker, output chatOutput) {
+	// 发送请求到厂商（主目标失败时依次尝试备用目标）
+	resp, target, err := h.sendUpstream(c.Request().Context(), req, upstreamTargets(modelItem))
+	if err != nil && c.Request().Context().Err() != nil {
+		clientCancelled(c, tracker)
 		return
 	}
-
-	// 设置请求头
-	providerReq.Header.Set("Content-Type", "application/json")
-	providerReq.Header.Set("Authorization", "Bearer "+providerKey)
-
-	// 发送请求
-	resp, err := client.Do(providerReq)
 	if err != nil {
-		c.JSON(http.StatusBadGateway, Response{
-			Code:    502,
-			Message: "请求厂商失败: " + err.Error(),
-		})
+		upstreamRequestError(c, err)
 		return
 	}
 	defer resp.Body.Close()
+	tracker.setTarget(target)
+	h.setUpstreamModelHeader(c, target)
 
 	// 检查响应状态
 	if resp.StatusCode != http.StatusOK {
 		respBody, _ := io.ReadAll(resp.Body)
-		c.JSON(http.StatusBadGateway, Response{
-			Code:    502,
-			Message: "厂商返回错误: " + string(respBody),
-		})
+		upstreamError(c, resp.StatusCode, resp.Header, respBody)
 		return
 	}
 
 	// 如果不流式，直接返回响应
 	if !req.Stream {
-		respBody, _ := io.ReadAll(resp.Body)
-		c.Response().Header().Set("Content-Type", "application/json")
-		c.String(http.StatusOK, string(respBody))
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil && c.Request().Context().Err() != nil {
+			clientCancelled(c, tracker)
+			return
+		}
+		tracker.observeResponse(respBody)
+		output.writeResponse(c, rewriteModelField(respBody, tracker.record.ModelName))
 		return
 	}
 
@@ -903,24 +1026,8 @@ func (h *Handler) sendProviderRequest(c echo.Context, modelItem *cache.ModelCach
 	c.Response().WriteHeader(http.StatusOK)
 	c.Response().Flush()
 
-	// 使用 bufio.Reader 实时读取并转发每个数据块
-	reader := bufio.NewReader(resp.Body)
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				// 正常结束
-				break
-			}
-			// 连接错误
-			return
-		}
-
-		// 转发数据块到客户端
-		if _, writeErr := c.Response().Writer.Write([]byte(line)); writeErr != nil {
-			// 客户端断开连接
-			return
-		}
-		c.Response().Flush() // 强制立即发送
+	// 逐个解析并转发厂商的 SSE 事件
+	if h.relayStream(c, resp.Body, tracker, output, nil) == streamCompleted {
+		output.finishStream(c)
 	}
 }
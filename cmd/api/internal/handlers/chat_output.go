@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// chatOutput 将 OpenAI 格式的厂商响应按客户端协议写回
+type chatOutput interface {
+	// writeResponse 写回非流式响应
+	writeResponse(c echo.Context, body []byte) error
+	// writeStreamEvent 写回一个厂商 SSE 事件，chunk 为解码后的数据块（[DONE] 或无法解码时为 nil）
+	// 返回错误表示客户端已断开
+	writeStreamEvent(c echo.Context, event *sseEvent, chunk *ChatStreamChunk) error
+	// finishStream 厂商流正常结束后调用
+	finishStream(c echo.Context) error
+	// failStream 厂商流在结束前中断时调用，输出协议对应的错误事件
+	failStream(c echo.Context, message string) error
+}
+
+// openAIOutput OpenAI 客户端，响应原样转发
+type openAIOutput struct{}
+
+func (openAIOutput) writeResponse(c echo.Context, body []byte) error {
+	c.Response().Header().Set("Content-Type", "application/json")
+	return c.String(http.StatusOK, string(body))
+}
+
+func (openAIOutput) writeStreamEvent(c echo.Context, event *sseEvent, chunk *ChatStreamChunk) error {
+	return writeSSEEvent(c, event)
+}
+
+func (openAIOutput) finishStream(c echo.Context) error {
+	return nil
+}
+
+// failStream 输出 {"error":{...}} 数据块，不再发送 [DONE]
+func (openAIOutput) failStream(c echo.Context, message string) error {
+	code := errCodeUpstream
+	payload, err := json.Marshal(OpenAIErrorResponse{Error: OpenAIError{Message: message, Type: errTypeUpstream, Code: &code}})
+	if err != nil {
+		return err
+	}
+	return writeSSEEvent(c, &sseEvent{Data: string(payload)})
+}
+
+// rewriteModelField 将 JSON 对象顶层的 model 字段改写为客户端请求的别名，其余内容和字段顺序保持不变
+// 不是 JSON 对象或没有字符串类型的 model 字段时原样返回
+func rewriteModelField(data []byte, alias string) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return data
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return data
+		}
+		start := dec.InputOffset()
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return data
+		}
+		if key != "model" {
+			continue
+		}
+		if len(value) == 0 || value[0] != '"' {
+			return data
+		}
+		// start 位于键名之后，值的实际位置需跳过冒号和空白
+		offset := int(start) + bytes.Index(data[start:dec.InputOffset()], value)
+		quoted, _ := json.Marshal(alias)
+		result := make([]byte, 0, len(data)-len(value)+len(quoted))
+		result = append(result, data[:offset]...)
+		result = append(result, quoted...)
+		return append(result, data[offset+len(value):]...)
+	}
+	return data
+}
+
+// setUpstreamModelHeader 开启 expose_upstream_model 时通过响应头返回实际请求的上游模型ID
+func (h *Handler) setUpstreamModelHeader(c echo.Context, target *upstreamTarget) {
+	if h.cfg.Proxy.ExposeUpstreamModel {
+		c.Response().Header().Set("X-Upstream-Model", target.ModelID)
+	}
+}
@@ -0,0 +1,31 @@
+package handlers
+
+import "testing"
+
+func TestRewriteModelField(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  string
+		alias string
+		want  string
+	}{
+		{"改写顶层 model", `{"id":"1","model":"gpt-4o-2024","object":"chat.completion"}`, "mm-gpt", `{"id":"1","model":"mm-gpt","object":"chat.completion"}`},
+		{"保留空白和字段顺序", `{ "model" : "up",  "x": [1, 2] }`, "alias", `{ "model" : "alias",  "x": [1, 2] }`},
+		{"只改写顶层字段", `{"choices":[{"model":"inner"}],"model":"up"}`, "alias", `{"choices":[{"model":"inner"}],"model":"alias"}`},
+		{"嵌套对象中的 model 不改写", `{"data":{"model":"inner"}}`, "alias", `{"data":{"model":"inner"}}`},
+		{"别名需要转义", `{"model":"up"}`, `a"b`, `{"model":"a\"b"}`},
+		{"model 不是字符串", `{"model":null}`, "alias", `{"model":null}`},
+		{"没有 model 字段", `{"id":"1"}`, "alias", `{"id":"1"}`},
+		{"不是 JSON 对象", `[DONE]`, "alias", `[DONE]`},
+		{"数组", `[{"model":"up"}]`, "alias", `[{"model":"up"}]`},
+		{"model 之前的内容无效", `{"id":,"model":"up"}`, "alias", `{"id":,"model":"up"}`},
+		{"找到 model 后不再解析后续内容", `{"model":"up"`, "alias", `{"model":"alias"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(rewriteModelField([]byte(tt.data), tt.alias)); got != tt.want {
+				t.Errorf("rewriteModelField(%s) = %s, want %s", tt.data, got, tt.want)
+			}
+		})
+	}
+}
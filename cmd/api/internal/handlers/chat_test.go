@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/model-system/api/internal/config"
+	"github.com/model-system/api/internal/models"
+)
+
+// 测试中未设置 tokenizer，token 数按字节估算
+const (
+	longText  = 100 // 超过截断长度的文本长度
+	shortText = 10  // 截断长度
+)
+
+// textMessage 生成内容为 n 个字符的消息
+func textMessage(role string, n int) ChatMessage {
+	content, _ := json.Marshal(strings.Repeat("x", n))
+	return ChatMessage{Role: role, Content: content}
+}
+
+// toolCallMessage 生成调用工具的 assistant 消息
+func toolCallMessage(n int) ChatMessage {
+	msg := textMessage("assistant", n)
+	calls := json.RawMessage(`[{"id":"c1","type":"function","function":{"name":"f","arguments":"{}"}}]`)
+	msg.ToolCalls = &calls
+	return msg
+}
+
+// toolResultMessage 生成工具结果消息
+func toolResultMessage(n int) ChatMessage {
+	msg := textMessage("tool", n)
+	id := "c1"
+	msg.ToolCallID = &id
+	return msg
+}
+
+func TestCompressToBudget(t *testing.T) {
+	L, S := longText, shortText
+	tests := []struct {
+		name      string
+		messages  []ChatMessage
+		userCount int
+		budget    int // 0 表示取 want 的 token 数，即压缩到恰好放入预算
+		want      []ChatMessage
+		wantLog   bool
+	}{
+		{
+			name:      "预算内不压缩",
+			messages:  []ChatMessage{textMessage("system", L), textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			userCount: 1,
+			want:      []ChatMessage{textMessage("system", L), textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+		},
+		{
+			name: "工具调用之后逐轮截断，放入预算即停止",
+			messages: []ChatMessage{textMessage("system", L), textMessage("user", L), toolCallMessage(L), toolResultMessage(L),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			userCount: 1,
+			want: []ChatMessage{textMessage("system", L), textMessage("user", L), toolCallMessage(S), toolResultMessage(S),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			wantLog: true,
+		},
+		{
+			name: "预算过小时只保留 system 和最近 N 轮",
+			messages: []ChatMessage{textMessage("system", L), textMessage("user", L), toolCallMessage(L), toolResultMessage(L),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			userCount: 2,
+			budget:    1,
+			want: []ChatMessage{textMessage("system", L),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			wantLog: true,
+		},
+		{
+			name: "没有工具调用时截断最早的对话",
+			messages: []ChatMessage{textMessage("system", L), textMessage("user", L), textMessage("assistant", L),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			userCount: 2,
+			want: []ChatMessage{textMessage("system", L), textMessage("user", S), textMessage("assistant", S),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			wantLog: true,
+		},
+		{
+			name: "截断后仍超出时整轮丢弃最早的对话",
+			messages: []ChatMessage{textMessage("system", L), textMessage("user", L), toolCallMessage(L), toolResultMessage(L), textMessage("assistant", L),
+				textMessage("user", L), textMessage("assistant", L), textMessage("user", L)},
+			userCount: 1,
+			want: []ChatMessage{textMessage("system", L),
+				textMessage("user", S), textMessage("assistant", S), textMessage("user", L)},
+			wantLog: true,
+		},
+		{
+			name:      "user 消息不足 N 个时只保留最后一轮",
+			messages:  []ChatMessage{textMessage("user", L), toolCallMessage(L), toolResultMessage(L), textMessage("user", L)},
+			userCount: 3,
+			want:      []ChatMessage{textMessage("user", S), toolCallMessage(S), toolResultMessage(S), textMessage("user", L)},
+			wantLog:   true,
+		},
+		{
+			name:      "只有最后一轮时不压缩",
+			messages:  []ChatMessage{textMessage("system", L), textMessage("user", L)},
+			userCount: 3,
+			budget:    1,
+			want:      []ChatMessage{textMessage("system", L), textMessage("user", L)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			budget := tt.budget
+			if budget == 0 {
+				budget = countMessagesTokens(tt.want)
+			}
+			got, tokens, logMsg := compressToBudget(tt.messages, budget, 0, tt.userCount, shortText, "")
+
+			gotJSON, _ := json.Marshal(got)
+			wantJSON, _ := json.Marshal(tt.want)
+			if string(gotJSON) != string(wantJSON) {
+				t.Errorf("messages =\n%s\nwant\n%s", gotJSON, wantJSON)
+			}
+			if tokens != countMessagesTokens(got) {
+				t.Errorf("tokens = %d, want %d", tokens, countMessagesTokens(got))
+			}
+			if (logMsg != "") != tt.wantLog {
+				t.Errorf("log = %q", logMsg)
+			}
+		})
+	}
+}
+
+func TestTruncateMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"短字符串", `"abc"`, `"abc"`},
+		{"长字符串", `"abcdefghijkl"`, `"abcdefghij"`},
+		{"内容数组", `[{"type":"text","text":"abcdefghijkl"},{"type":"image_url","image_url":{"url":"https://a"}}]`,
+			`[{"text":"abcdefghij","type":"text"},{"image_url":{"url":"https://a"},"type":"image_url"}]`},
+		{"null", `null`, `null`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := ChatMessage{Role: "user", Content: json.RawMessage(tt.content)}
+			modified := truncateMessageText(&msg, 10)
+			if string(msg.Content) != tt.want {
+				t.Errorf("content = %s, want %s", msg.Content, tt.want)
+			}
+			if modified != (tt.content != tt.want) {
+				t.Errorf("modified = %v", modified)
+			}
+		})
+	}
+}
+
+func TestMessageText(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"字符串", `"hello"`, "hello"},
+		{"内容数组只取文本", `[{"type":"text","text":"look "},{"type":"image_url","image_url":{"url":"data:image/png;base64,iVBORw0KGgo"}},{"type":"text","text":"here"}]`, "look here"},
+		{"null", `null`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageText(json.RawMessage(tt.content)); got != tt.want {
+				t.Errorf("messageText = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// imageMessage 生成带 n 字节 base64 图片的 user 消息
+func imageMessage(n int) ChatMessage {
+	content, _ := json.Marshal([]map[string]interface{}{
+		{"type": "text", "text": "describe this image"},
+		{"type": "image_url", "image_url": map[string]string{"url": "data:image/png;base64," + strings.Repeat("A", n)}},
+	})
+	return ChatMessage{Role: "user", Content: content}
+}
+
+func TestCompressForContext(t *testing.T) {
+	tests := []struct {
+		name     string
+		compress bool
+		messages []ChatMessage
+		fits     bool
+	}{
+		{"大图片请求不被拒绝", true, []ChatMessage{textMessage("system", 10), imageMessage(4 << 20)}, true},
+		{"未开启压缩时交给厂商判断", false, []ChatMessage{textMessage("system", 5000), textMessage("user", 10)}, true},
+		{"压缩后仍超出上下文长度", true, []ChatMessage{textMessage("system", 5000), textMessage("user", 10)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{cfg: &config.Config{}}
+			model := &models.Model{ContextLength: 1, CompressEnabled: tt.compress, CompressUserCount: 1, CompressTruncateLen: shortText}
+			messages, tokens, _, fits := h.compressForContext(model, tt.messages, countMessagesTokens(tt.messages), 100)
+			if fits != tt.fits {
+				t.Errorf("fits = %v, want %v (tokens: %d)", fits, tt.fits, tokens)
+			}
+			if tokens != countMessagesTokens(messages) {
+				t.Errorf("tokens = %d, want %d", tokens, countMessagesTokens(messages))
+			}
+		})
+	}
+}
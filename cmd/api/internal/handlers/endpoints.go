@@ -0,0 +1,421 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// multipartMaxMemory 解析上传文件时保存在内存中的最大字节数，超出部分暂存到临时文件
+const multipartMaxMemory = 1 << 20
+
+// Completions 旧版文本补全接口，请求和响应原样透传
+// POST /v1/completions
+func (h *Handler) Completions(c echo.Context) error {
+	return h.proxyEndpoint(c, "/completions", false, jsonEndpointParser("prompt"))
+}
+
+// Embeddings 向量接口，只能使用开启了 embeddings 的模型
+// POST /v1/embeddings
+func (h *Handler) Embeddings(c echo.Context) error {
+	return h.proxyEndpoint(c, "/embeddings", true, jsonEndpointParser("input"))
+}
+
+// ImageGenerations 图片生成接口
+// POST /v1/images/generations
+func (h *Handler) ImageGenerations(c echo.Context) error {
+	return h.proxyEndpoint(c, "/images/generations", false, jsonEndpointParser("prompt"))
+}
+
+// AudioSpeech 语音合成接口，响应为音频二进制流
+// POST /v1/audio/speech
+func (h *Handler) AudioSpeech(c echo.Context) error {
+	return h.proxyEndpoint(c, "/audio/speech", false, jsonEndpointParser("input"))
+}
+
+// AudioTranscriptions 语音转写接口，请求为 multipart 上传
+// POST /v1/audio/transcriptions
+func (h *Handler) AudioTranscriptions(c echo.Context) error {
+	return h.proxyEndpoint(c, "/audio/transcriptions", false, multipartEndpointParser(h.cfg.Proxy.MaxUploadBytes()))
+}
+
+// Moderations 内容审核接口
+// POST /v1/moderations
+func (h *Handler) Moderations(c echo.Context) error {
+	return h.proxyEndpoint(c, "/moderations", false, jsonEndpointParser("input"))
+}
+
+// endpointBody 透传接口的请求体
+type endpointBody interface {
+	// model 请求的模型别名
+	model() string
+	// stream 是否请求流式响应
+	stream() bool
+	// inputTokens 估算的输入 token 数
+	inputTokens() int
+	// build 生成发往厂商的请求体和 Content-Type，model 替换为厂商实际的模型ID
+	// 每次尝试目标时调用一次，返回的请求体由 HTTP 客户端关闭，未交给客户端时由调用方关闭
+	build(modelID string) (io.ReadCloser, string, error)
+	// close 释放请求体占用的资源（如上传的临时文件）
+	close()
+}
+
+// endpointParser 从客户端请求中解析请求体，返回的错误作为 400 的错误消息（请求体超出大小上限时返回 413）
+type endpointParser func(c echo.Context) (endpointBody, error)
+
+// jsonEndpointBody JSON 请求体
+type jsonEndpointBody struct {
+	fields     map[string]json.RawMessage
+	inputField string // 用于估算输入 token 的字段
+}
+
+// jsonEndpointParser 返回 JSON 请求体的解析函数，inputField 为用于估算输入 token 的字段
+func jsonEndpointParser(inputField string) endpointParser {
+	return func(c echo.Context) (endpointBody, error) {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return nil, errors.New("Failed to read request body")
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, errors.New("Invalid JSON in request body: " + err.Error())
+		}
+		return &jsonEndpointBody{fields: fields, inputField: inputField}, nil
+	}
+}
+
+func (b *jsonEndpointBody) model() string {
+	var model string
+	json.Unmarshal(b.fields["model"], &model)
+	return model
+}
+
+func (b *jsonEndpointBody) stream() bool {
+	var stream bool
+	json.Unmarshal(b.fields["stream"], &stream)
+	return stream
+}
+
+func (b *jsonEndpointBody) inputTokens() int {
+	return countInputTokens(b.fields[b.inputField])
+}
+
+func (b *jsonEndpointBody) build(modelID string) (io.ReadCloser, string, error) {
+	b.fields["model"], _ = json.Marshal(modelID)
+	body, err := json.Marshal(b.fields)
+	if err != nil {
+		return nil, "", err
+	}
+	return io.NopCloser(bytes.NewReader(body)), "application/json", nil
+}
+
+func (b *jsonEndpointBody) close() {}
+
+// multipartEndpointBody multipart 请求体，上传的文件超过 multipartMaxMemory 时暂存在临时文件中，
+// 切换备用目标时可以重新发送
+type multipartEndpointBody struct {
+	form  *multipart.Form
+	pipes []*io.PipeReader // 每次尝试目标创建的请求体管道，请求结束时关闭
+}
+
+// multipartEndpointParser 返回 multipart 请求体的解析函数，maxBytes 为请求体的大小上限
+func multipartEndpointParser(maxBytes int64) endpointParser {
+	return func(c echo.Context) (endpointBody, error) {
+		mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get("Content-Type"))
+		if mediaType != "multipart/form-data" {
+			return nil, errors.New("Content-Type must be multipart/form-data")
+		}
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxBytes)
+		if err := c.Request().ParseMultipartForm(multipartMaxMemory); err != nil {
+			return nil, fmt.Errorf("Invalid multipart body: %w", err)
+		}
+		return &multipartEndpointBody{form: c.Request().MultipartForm}, nil
+	}
+}
+
+// value 返回表单字段的第一个值
+func (b *multipartEndpointBody) value(key string) string {
+	if values := b.form.Value[key]; len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (b *multipartEndpointBody) model() string {
+	return b.value("model")
+}
+
+func (b *multipartEndpointBody) stream() bool {
+	return b.value("stream") == "true"
+}
+
+func (b *multipartEndpointBody) inputTokens() int {
+	return countTextTokens(b.value("prompt"))
+}
+
+// build 通过管道边读边写 multipart 请求体，文件内容不会整体读入内存
+func (b *multipartEndpointBody) build(modelID string) (io.ReadCloser, string, error) {
+	reader, writer := io.Pipe()
+	mw := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(b.write(mw, modelID))
+	}()
+	b.pipes = append(b.pipes, reader)
+	return reader, mw.FormDataContentType(), nil
+}
+
+// quoteEscaper 转义 Content-Disposition 中的引号和反斜杠
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (b *multipartEndpointBody) write(mw *multipart.Writer, modelID string) error {
+	for key, values := range b.form.Value {
+		if key == "model" {
+			values = []string{modelID}
+		}
+		for _, value := range values {
+			if err := mw.WriteField(key, value); err != nil {
+				return err
+			}
+		}
+	}
+	for key, files := range b.form.File {
+		for _, fileHeader := range files {
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				quoteEscaper.Replace(key), quoteEscaper.Replace(fileHeader.Filename)))
+			contentType := fileHeader.Header.Get("Content-Type")
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			header.Set("Content-Type", contentType)
+
+			part, err := mw.CreatePart(header)
+			if err != nil {
+				return err
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(part, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return mw.Close()
+}
+
+// close 关闭请求体管道，结束厂商未读完请求体时仍在写入的 goroutine，并删除临时文件
+func (b *multipartEndpointBody) close() {
+	for _, pipe := range b.pipes {
+		pipe.CloseWithError(errEndpointRequestDone)
+	}
+	b.form.RemoveAll()
+}
+
+// errEndpointRequestDone 请求结束后关闭仍在写入的请求体管道
+var errEndpointRequestDone = errors.New("请求已结束")
+
+// proxyEndpoint 透传聊天补全以外的 OpenAI 接口
+// 与聊天补全共用API密钥鉴权、模型别名解析和归属检查、限流、配额、备用目标和用量记录，不做压缩和提示词注入
+// embeddings 为 true 时要求模型开启 embeddings；响应按厂商的 Content-Type 转发（JSON、SSE 或二进制流）
+func (h *Handler) proxyEndpoint(c echo.Context, path string, embeddings bool, parse endpointParser) error {
+	startTime := time.Now()
+
+	// 验证API密钥并获取用户ID（在读取请求体之前，避免为未授权的请求接收上传文件）
+	apiKey, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "Incorrect API key provided")
+	}
+
+	apiKeyID, _ := cache.GetCache().GetAPIKeyID(apiKey)
+
+	body, err := parse(c)
+	if err != nil {
+		log.Printf("[ERROR] 解析请求失败: %v", err)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return proxyError(c, http.StatusRequestEntityTooLarge, errTypeInvalidRequest, "",
+				fmt.Sprintf("Request body too large. The maximum size is %d MB.", tooLarge.Limit>>20))
+		}
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", err.Error())
+	}
+	defer body.close()
+
+	modelName := body.model()
+	stream := body.stream()
+	if modelName == "" {
+		log.Printf("[ERROR] 模型参数不能为空")
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "You must provide a model parameter")
+	}
+
+	// 从缓存中查找模型，检查归属、启用状态和可用时间段
+	modelItem, err := h.resolveModel(c, userID, modelName)
+	if err != nil {
+		log.Printf("[ERROR] 模型不可用 (%s): %v", modelName, err)
+		return modelAccessErrorResponse(c, err)
+	}
+	if embeddings && !modelItem.Model.EmbeddingsEnabled {
+		log.Printf("[ERROR] 模型未开启 embeddings (%s)", modelName)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "",
+			fmt.Sprintf("The model `%s` does not support embeddings", modelName))
+	}
+	targets := endpointTargets(upstreamTargets(modelItem))
+	if len(targets) == 0 {
+		log.Printf("[ERROR] 模型的厂商不支持 %s (%s)", path, modelName)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "",
+			fmt.Sprintf("The model `%s` is served by a provider that does not support %s", modelName, path))
+	}
+
+	tokenCount := body.inputTokens()
+
+	// 检查API密钥的请求频率、token用量和流式并发限制
+	limit, err := cache.GetCache().AcquireAPIKeyLimit(apiKey, stream, tokenCount)
+	if err != nil {
+		log.Printf("[WARN] API密钥触发限流 (api_key_id: %d): %v", apiKeyID, err)
+		return rateLimitError(c, err)
+	}
+	defer limit.Release()
+	setRateLimitHeaders(c, limit.Status)
+
+	// 检查用户和API密钥的用量配额，按输入 token 数预占
+	reservation, err := h.quotaService.Reserve(userID, apiKeyID, tokenCount, modelItem.Model.ModelPricing.Cost(tokenCount, 0, 0))
+	if err != nil {
+		log.Printf("[WARN] 用量配额已用尽 (api_key_id: %d): %v", apiKeyID, err)
+		return quotaError(c, err)
+	}
+
+	// 记录本次代理请求的用量
+	tracker := newUsageTracker(startTime, userID, apiKeyID, modelName, modelItem, stream)
+	tracker.limit = limit
+	tracker.quota = reservation
+	defer h.recordUsage(c, tracker)
+
+	tracker.setTokens(tokenCount, tokenCount, tokenCount)
+
+	log.Printf("client IP: %s, model: %s, model_id: %s, endpoint: %s, input tokens: %d", c.RealIP(), modelName, modelItem.Model.ModelID, path, tokenCount)
+
+	// 发送请求到厂商（主目标失败时依次尝试备用目标）
+	ctx := c.Request().Context()
+	resp, target, err := h.sendWithFallback(ctx, targets, func(target *upstreamTarget) (*http.Response, error) {
+		return h.doEndpointRequest(ctx, path, body, target)
+	})
+	if err != nil && ctx.Err() != nil {
+		return clientCancelled(c, tracker)
+	}
+	if err != nil {
+		log.Printf("[ERROR] 请求厂商失败: %v", err)
+		return upstreamRequestError(c, err)
+	}
+	defer resp.Body.Close()
+
+	// 记录实际服务的目标
+	tracker.setTarget(target)
+	h.setUpstreamModelHeader(c, target)
+	if target.Index > 0 {
+		log.Printf("[FALLBACK] model: %s 由备用目标 #%d 服务 (provider: %s, model_id: %s)", modelItem.CacheKey(), target.Index, target.ProviderName, target.ModelID)
+	}
+
+	// 检查响应状态
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		log.Printf("[ERROR] 厂商返回错误 (status: %d): %s", resp.StatusCode, string(respBody))
+		return upstreamError(c, resp.StatusCode, resp.Header, respBody)
+	}
+
+	return h.writeEndpointResponse(c, resp, tracker)
+}
+
+// writeEndpointResponse 按厂商响应的 Content-Type 转发：JSON 整体转发，SSE 逐个事件转发，其余（音频等）按二进制流转发
+func (h *Handler) writeEndpointResponse(c echo.Context, resp *http.Response, tracker *usageTracker) error {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	if mediaType == "application/json" {
+		respBody, err := io.ReadAll(resp.Body)
+		if err != nil && c.Request().Context().Err() != nil {
+			return clientCancelled(c, tracker)
+		}
+		tracker.observeResponse(respBody)
+		return openAIOutput{}.writeResponse(c, rewriteModelField(respBody, tracker.record.ModelName))
+	}
+
+	if mediaType == "text/event-stream" {
+		c.Response().Header().Set("Content-Type", "text/event-stream")
+		c.Response().Header().Set("Cache-Control", "no-cache")
+		c.Response().Header().Set("Connection", "keep-alive")
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Flush()
+
+		h.relayStream(c, resp.Body, tracker, openAIOutput{}, nil)
+		return nil
+	}
+
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Response().Header().Set("Content-Type", contentType)
+	c.Response().WriteHeader(http.StatusOK)
+
+	// 边读边写，每次读取后立即发送，音频可以边生成边播放
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, writeErr := c.Response().Write(buf[:n]); writeErr != nil {
+				return clientCancelled(c, tracker)
+			}
+			c.Response().Flush()
+		}
+		if err != nil && c.Request().Context().Err() != nil {
+			return clientCancelled(c, tracker)
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// countInputTokens 估算 prompt/input 字段的 token 数
+// 支持字符串、字符串数组、token 数组和 token 数组的数组
+func countInputTokens(raw json.RawMessage) int {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return countTextTokens(text)
+	}
+	var texts []string
+	if err := json.Unmarshal(raw, &texts); err == nil {
+		total := 0
+		for _, text := range texts {
+			total += countTextTokens(text)
+		}
+		return total
+	}
+	var tokens []int
+	if err := json.Unmarshal(raw, &tokens); err == nil {
+		return len(tokens)
+	}
+	var batches [][]int
+	if err := json.Unmarshal(raw, &batches); err == nil {
+		total := 0
+		for _, batch := range batches {
+			total += len(batch)
+		}
+		return total
+	}
+	return 0
+}
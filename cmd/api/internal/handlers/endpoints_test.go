@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// multipartContext 构造上传 size 字节文件的 multipart 请求
+func multipartContext(t *testing.T, size int) echo.Context {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("model", "whisper")
+	part, err := mw.CreateFormFile("file", "a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("x"), size))
+	mw.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/audio/transcriptions", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestMultipartEndpointParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		maxBytes int64
+		tooLarge bool
+	}{
+		{"上限内", 1024, 1 << 20, false},
+		{"超出上限", 2 << 20, 1 << 20, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := multipartEndpointParser(tt.maxBytes)(multipartContext(t, tt.size))
+			var maxBytesErr *http.MaxBytesError
+			if got := errors.As(err, &maxBytesErr); got != tt.tooLarge {
+				t.Fatalf("err = %v, want too large %v", err, tt.tooLarge)
+			}
+			if err == nil {
+				defer body.close()
+				if body.model() != "whisper" {
+					t.Errorf("model = %q", body.model())
+				}
+			}
+		})
+	}
+}
+
+func TestMultipartEndpointBodyClose(t *testing.T) {
+	body, err := multipartEndpointParser(1 << 20)(multipartContext(t, 64<<10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 厂商未读取请求体时，请求结束后写入 goroutine 随管道关闭退出
+	before := runtime.NumGoroutine()
+	reader, _, err := body.build("whisper-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body.close()
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatal("写入请求体的 goroutine 未退出")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if _, err := reader.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("read err = %v, want io.ErrClosedPipe", err)
+	}
+}
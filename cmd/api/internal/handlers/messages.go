@@ -0,0 +1,636 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// anthropicClientKey 标记请求来自 Anthropic 协议客户端（/v1/messages），错误按 Anthropic 格式返回
+const anthropicClientKey = "anthropic_client"
+
+// isAnthropicClient 判断当前请求是否来自 /v1/messages
+func isAnthropicClient(c echo.Context) bool {
+	flag, _ := c.Get(anthropicClientKey).(bool)
+	return flag
+}
+
+// AnthropicErrorResponse Anthropic 格式的错误响应
+// {"type":"error","error":{"type":"...","message":"..."}}
+type AnthropicErrorResponse struct {
+	Type  string `json:"type"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicErrorResponse 根据状态码生成 Anthropic 格式的错误响应
+func anthropicErrorResponse(status int, message string) AnthropicErrorResponse {
+	resp := AnthropicErrorResponse{Type: "error"}
+	resp.Error.Message = message
+	switch {
+	case status == http.StatusUnauthorized:
+		resp.Error.Type = "authentication_error"
+	case status == http.StatusPaymentRequired:
+		resp.Error.Type = "billing_error"
+	case status == http.StatusForbidden:
+		resp.Error.Type = "permission_error"
+	case status == http.StatusNotFound:
+		resp.Error.Type = "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		resp.Error.Type = "request_too_large"
+	case status == http.StatusTooManyRequests:
+		resp.Error.Type = "rate_limit_error"
+	case status == http.StatusServiceUnavailable:
+		resp.Error.Type = "overloaded_error"
+	case status < 500:
+		resp.Error.Type = "invalid_request_error"
+	default:
+		resp.Error.Type = "api_error"
+	}
+	return resp
+}
+
+// MessagesRequest Anthropic Messages API 请求
+type MessagesRequest struct {
+	Model         string                   `json:"model"`
+	MaxTokens     *int                     `json:"max_tokens"`
+	System        json.RawMessage          `json:"system"`
+	Messages      []MessagesMessage        `json:"messages"`
+	Stream        bool                     `json:"stream"`
+	Temperature   *float64                 `json:"temperature"`
+	TopP          *float64                 `json:"top_p"`
+	StopSequences []string                 `json:"stop_sequences"`
+	Tools         []map[string]interface{} `json:"tools"`
+	ToolChoice    map[string]interface{}   `json:"tool_choice"`
+	Metadata      struct {
+		UserID string `json:"user_id"`
+	} `json:"metadata"`
+}
+
+// MessagesMessage Anthropic 消息，content 为字符串或内容块数组
+type MessagesMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// Messages Anthropic 兼容的消息接口，转换为聊天补全请求后走同一代理流程
+// POST /v1/messages
+func (h *Handler) Messages(c echo.Context) error {
+	startTime := time.Now()
+	c.Set(anthropicClientKey, true)
+
+	// 验证API密钥并获取用户ID（支持 x-api-key 和 Authorization 请求头）
+	apiKey, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "invalid x-api-key")
+	}
+
+	apiKeyID, _ := cache.GetCache().GetAPIKeyID(apiKey)
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Printf("[ERROR] 读取请求体失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Failed to read request body")
+	}
+	var messagesReq MessagesRequest
+	if err := json.Unmarshal(body, &messagesReq); err != nil {
+		log.Printf("[ERROR] 解析请求失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Invalid JSON in request body: "+err.Error())
+	}
+
+	req, err := messagesReq.toChatCompletion()
+	if err != nil {
+		log.Printf("[ERROR] 转换 Anthropic 请求失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", err.Error())
+	}
+	chatBody, _ := req.MarshalJSON()
+
+	return h.proxyChat(c, startTime, apiKey, apiKeyID, userID, chatBody, req, &anthropicOutput{})
+}
+
+// toChatCompletion 转换为 OpenAI 格式的聊天补全请求，保留内容块上的 cache_control
+func (r MessagesRequest) toChatCompletion() (ChatCompletionRequest, error) {
+	var messages []ChatMessage
+
+	if system := messagesSystem(r.System); system != nil {
+		messages = append(messages, ChatMessage{Role: "system", Content: system})
+	}
+
+	for i, msg := range r.Messages {
+		switch msg.Role {
+		case "user":
+			toolResults, content := messagesUserContent(msg.Content)
+			// 工具结果必须紧跟在 assistant 的工具调用之后
+			messages = append(messages, toolResults...)
+			if content != nil {
+				messages = append(messages, ChatMessage{Role: "user", Content: content})
+			}
+		case "assistant":
+			messages = append(messages, messagesAssistant(msg.Content))
+		default:
+			return ChatCompletionRequest{}, fmt.Errorf("messages.%d.role: unexpected role %q", i, msg.Role)
+		}
+	}
+
+	req := ChatCompletionRequest{
+		Model:       r.Model,
+		Messages:    MarshalMessagesToJSON(messages),
+		Stream:      r.Stream,
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxTokens,
+		Extra:       make(map[string]interface{}),
+	}
+	if r.Stream {
+		// 要求 OpenAI 兼容厂商在流式响应最后返回 usage
+		req.Extra["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if r.TopP != nil {
+		req.Extra["top_p"] = *r.TopP
+	}
+	if len(r.StopSequences) > 0 {
+		req.Extra["stop"] = r.StopSequences
+	}
+	if r.Metadata.UserID != "" {
+		req.Extra["user"] = r.Metadata.UserID
+	}
+	if len(r.Tools) > 0 {
+		tools := make([]interface{}, 0, len(r.Tools))
+		for _, tool := range r.Tools {
+			function := map[string]interface{}{
+				"name":       tool["name"],
+				"parameters": tool["input_schema"],
+			}
+			if description, ok := tool["description"]; ok {
+				function["description"] = description
+			}
+			converted := map[string]interface{}{"type": "function", "function": function}
+			if cacheControl, ok := tool["cache_control"]; ok {
+				converted["cache_control"] = cacheControl
+			}
+			tools = append(tools, converted)
+		}
+		req.Extra["tools"] = tools
+	}
+	if r.ToolChoice != nil {
+		switch r.ToolChoice["type"] {
+		case "auto":
+			req.Extra["tool_choice"] = "auto"
+		case "any":
+			req.Extra["tool_choice"] = "required"
+		case "none":
+			req.Extra["tool_choice"] = "none"
+		case "tool":
+			req.Extra["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": r.ToolChoice["name"]},
+			}
+		}
+		if disabled, _ := r.ToolChoice["disable_parallel_tool_use"].(bool); disabled {
+			req.Extra["parallel_tool_calls"] = false
+		}
+	}
+	return req, nil
+}
+
+// parseMessagesBlocks 解析 Anthropic content，字符串返回单个 text 块
+func parseMessagesBlocks(content json.RawMessage) []map[string]interface{} {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return []map[string]interface{}{{"type": "text", "text": text}}
+	}
+	var blocks []map[string]interface{}
+	json.Unmarshal(content, &blocks)
+	return blocks
+}
+
+// messagesContentParts 将 Anthropic 内容块转换为 OpenAI 内容数组
+// text 和 image 块转换为 OpenAI 格式并保留 cache_control，其余块原样保留
+func messagesContentParts(blocks []map[string]interface{}) []map[string]interface{} {
+	parts := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		var part map[string]interface{}
+		switch block["type"] {
+		case "text":
+			part = map[string]interface{}{"type": "text", "text": block["text"]}
+		case "image":
+			source, _ := block["source"].(map[string]interface{})
+			var url string
+			switch source["type"] {
+			case "base64":
+				url = fmt.Sprintf("data:%v;base64,%v", source["media_type"], source["data"])
+			case "url":
+				url, _ = source["url"].(string)
+			}
+			if url == "" {
+				continue
+			}
+			part = map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}}
+		case "thinking", "redacted_thinking":
+			continue
+		default:
+			parts = append(parts, block)
+			continue
+		}
+		if cacheControl, ok := block["cache_control"]; ok {
+			part["cache_control"] = cacheControl
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// messagesSystem 转换 system 字段，未设置时返回 nil
+func messagesSystem(system json.RawMessage) json.RawMessage {
+	if len(system) == 0 || string(system) == "null" {
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(system, &text); err == nil {
+		if text == "" {
+			return nil
+		}
+		return system
+	}
+	parts := messagesContentParts(parseMessagesBlocks(system))
+	if len(parts) == 0 {
+		return nil
+	}
+	content, _ := json.Marshal(parts)
+	return content
+}
+
+// messagesUserContent 转换 user 消息，tool_result 块拆分为 OpenAI tool 消息，返回工具结果和剩余内容
+func messagesUserContent(content json.RawMessage) ([]ChatMessage, json.RawMessage) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return nil, content
+	}
+
+	var toolResults []ChatMessage
+	var others []map[string]interface{}
+	for _, block := range parseMessagesBlocks(content) {
+		if block["type"] != "tool_result" {
+			others = append(others, block)
+			continue
+		}
+		toolCallID, _ := block["tool_use_id"].(string)
+		var resultContent json.RawMessage
+		switch v := block["content"].(type) {
+		case string:
+			resultContent, _ = json.Marshal(v)
+		case []interface{}:
+			raw, _ := json.Marshal(v)
+			resultContent, _ = json.Marshal(messagesContentParts(parseMessagesBlocks(raw)))
+		default:
+			resultContent, _ = json.Marshal("")
+		}
+		toolResults = append(toolResults, ChatMessage{Role: "tool", ToolCallID: &toolCallID, Content: resultContent})
+	}
+
+	parts := messagesContentParts(others)
+	if len(parts) == 0 {
+		return toolResults, nil
+	}
+	converted, _ := json.Marshal(parts)
+	return toolResults, converted
+}
+
+// messagesAssistant 转换 assistant 消息，tool_use 块转换为 tool_calls
+func messagesAssistant(content json.RawMessage) ChatMessage {
+	msg := ChatMessage{Role: "assistant", Content: json.RawMessage("null")}
+
+	var text strings.Builder
+	var toolCalls []openAIToolCall
+	for _, block := range parseMessagesBlocks(content) {
+		switch block["type"] {
+		case "text":
+			s, _ := block["text"].(string)
+			text.WriteString(s)
+		case "tool_use":
+			call := openAIToolCall{Type: "function"}
+			call.ID, _ = block["id"].(string)
+			call.Function.Name, _ = block["name"].(string)
+			arguments, _ := json.Marshal(block["input"])
+			call.Function.Arguments = string(arguments)
+			toolCalls = append(toolCalls, call)
+		}
+	}
+
+	if text.Len() > 0 || len(toolCalls) == 0 {
+		msg.Content, _ = json.Marshal(text.String())
+	}
+	if len(toolCalls) > 0 {
+		raw, _ := json.Marshal(toolCalls)
+		msg.ToolCalls = (*json.RawMessage)(&raw)
+	}
+	return msg
+}
+
+// messagesStopReason 将 OpenAI finish_reason 转换为 Anthropic stop_reason
+func messagesStopReason(finishReason string) string {
+	switch finishReason {
+	case "length":
+		return "max_tokens"
+	case "tool_calls", "function_call":
+		return "tool_use"
+	case "content_filter":
+		return "refusal"
+	default:
+		return "end_turn"
+	}
+}
+
+// messagesUsage 将 OpenAI 用量转换为 Anthropic 用量（input_tokens 不含缓存命中部分）
+func messagesUsage(usage *Usage) map[string]int {
+	result := map[string]int{"input_tokens": 0, "output_tokens": 0}
+	if usage == nil {
+		return result
+	}
+	cached := 0
+	if usage.PromptTokensDetails != nil {
+		cached = usage.PromptTokensDetails.CachedTokens
+	}
+	result["input_tokens"] = usage.PromptTokens - cached
+	result["output_tokens"] = usage.CompletionTokens
+	if cached > 0 {
+		result["cache_read_input_tokens"] = cached
+	}
+	return result
+}
+
+// anthropicOutput Anthropic 客户端，将 OpenAI 响应和数据块转换为 Anthropic 消息和事件
+type anthropicOutput struct {
+	started    bool
+	finished   bool
+	id         string
+	model      string
+	blockCount int         // 已打开的内容块数，即下一个内容块的序号
+	textBlock  int         // 打开的文本块序号，-1 表示没有
+	toolBlocks map[int]int // OpenAI tool_calls 序号 -> 内容块序号
+	openTools  []int       // 打开的工具调用块序号，文本之后仍可能到达参数，结束时才关闭
+	stopReason string
+	usage      *Usage
+}
+
+func (o *anthropicOutput) writeResponse(c echo.Context, body []byte) error {
+	var resp struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   json.RawMessage  `json:"content"`
+				ToolCalls []openAIToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Choices) == 0 {
+		return proxyError(c, http.StatusBadGateway, errTypeUpstream, errCodeUpstream, "Invalid response from upstream provider")
+	}
+
+	choice := resp.Choices[0]
+	content := make([]map[string]interface{}, 0, len(choice.Message.ToolCalls)+1)
+	var text string
+	if err := json.Unmarshal(choice.Message.Content, &text); err != nil {
+		// 内容数组：拼接其中的文本
+		for _, block := range parseMessagesBlocks(choice.Message.Content) {
+			if s, ok := block["text"].(string); ok {
+				text += s
+			}
+		}
+	}
+	if text != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": text})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		content = append(content, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call.ID,
+			"name":  call.Function.Name,
+			"input": call.arguments(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":            resp.ID,
+		"type":          "message",
+		"role":          "assistant",
+		"model":         resp.Model,
+		"content":       content,
+		"stop_reason":   messagesStopReason(choice.FinishReason),
+		"stop_sequence": nil,
+		"usage":         messagesUsage(resp.Usage),
+	})
+}
+
+// writeEvent 写出一个 Anthropic SSE 事件
+func (o *anthropicOutput) writeEvent(c echo.Context, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return writeSSEEvent(c, &sseEvent{Event: event, Data: string(payload)})
+}
+
+// start 首个数据块前输出 message_start
+func (o *anthropicOutput) start(c echo.Context) error {
+	if o.started {
+		return nil
+	}
+	o.started = true
+	o.textBlock = -1
+	o.toolBlocks = make(map[int]int)
+	return o.writeEvent(c, "message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":            o.id,
+			"type":          "message",
+			"role":          "assistant",
+			"model":         o.model,
+			"content":       []interface{}{},
+			"stop_reason":   nil,
+			"stop_sequence": nil,
+			"usage":         messagesUsage(nil),
+		},
+	})
+}
+
+// openBlock 打开新的内容块，返回内容块序号
+func (o *anthropicOutput) openBlock(c echo.Context, block map[string]interface{}) (int, error) {
+	index := o.blockCount
+	o.blockCount++
+	return index, o.writeEvent(c, "content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": block,
+	})
+}
+
+// closeBlock 关闭内容块
+func (o *anthropicOutput) closeBlock(c echo.Context, index int) error {
+	return o.writeEvent(c, "content_block_stop", map[string]interface{}{
+		"type":  "content_block_stop",
+		"index": index,
+	})
+}
+
+// closeTextBlock 关闭打开的文本块
+func (o *anthropicOutput) closeTextBlock(c echo.Context) error {
+	if o.textBlock < 0 {
+		return nil
+	}
+	index := o.textBlock
+	o.textBlock = -1
+	return o.closeBlock(c, index)
+}
+
+// closeBlocks 按序号关闭所有打开的内容块
+func (o *anthropicOutput) closeBlocks(c echo.Context) error {
+	open := o.openTools
+	if o.textBlock >= 0 {
+		open = append(open, o.textBlock)
+	}
+	sort.Ints(open)
+	o.textBlock = -1
+	o.openTools = nil
+	for _, index := range open {
+		if err := o.closeBlock(c, index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *anthropicOutput) writeStreamEvent(c echo.Context, event *sseEvent, chunk *ChatStreamChunk) error {
+	if o.finished {
+		return nil
+	}
+	if event.Data == sseDone {
+		return o.finish(c)
+	}
+	if chunk == nil {
+		return nil
+	}
+	if o.id == "" {
+		o.id = chunk.ID
+		o.model = chunk.Model
+	}
+	if chunk.Error != nil {
+		return o.failStream(c, chunk.Error.Message)
+	}
+	if err := o.start(c); err != nil {
+		return err
+	}
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		o.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			// 工具调用块保持打开，其后续参数仍可写入
+			if o.textBlock < 0 {
+				index, err := o.openBlock(c, map[string]interface{}{"type": "text", "text": ""})
+				if err != nil {
+					return err
+				}
+				o.textBlock = index
+			}
+			if err := o.writeEvent(c, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": o.textBlock,
+				"delta": map[string]interface{}{"type": "text_delta", "text": choice.Delta.Content},
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			// 带 ID 的数据块表示新的工具调用
+			if call.ID != "" {
+				if err := o.closeTextBlock(c); err != nil {
+					return err
+				}
+				blockIndex, err := o.openBlock(c, map[string]interface{}{
+					"type":  "tool_use",
+					"id":    call.ID,
+					"name":  call.Function.Name,
+					"input": map[string]interface{}{},
+				})
+				if err != nil {
+					return err
+				}
+				o.toolBlocks[index] = blockIndex
+				o.openTools = append(o.openTools, blockIndex)
+			}
+			blockIndex, ok := o.toolBlocks[index]
+			if !ok || call.Function.Arguments == "" {
+				continue
+			}
+			if err := o.writeEvent(c, "content_block_delta", map[string]interface{}{
+				"type":  "content_block_delta",
+				"index": blockIndex,
+				"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": call.Function.Arguments},
+			}); err != nil {
+				return err
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			o.stopReason = messagesStopReason(*choice.FinishReason)
+		}
+	}
+	return nil
+}
+
+func (o *anthropicOutput) finishStream(c echo.Context) error {
+	return o.finish(c)
+}
+
+// failStream 输出 error 事件结束流，不再输出 message_stop
+func (o *anthropicOutput) failStream(c echo.Context, message string) error {
+	if o.finished {
+		return nil
+	}
+	o.finished = true
+	return o.writeEvent(c, "error", anthropicErrorResponse(http.StatusBadGateway, message))
+}
+
+// finish 关闭内容块并输出 message_delta（结束原因和用量）和 message_stop
+func (o *anthropicOutput) finish(c echo.Context) error {
+	if o.finished {
+		return nil
+	}
+	if err := o.start(c); err != nil {
+		return err
+	}
+	o.finished = true
+	if err := o.closeBlocks(c); err != nil {
+		return err
+	}
+	if o.stopReason == "" {
+		o.stopReason = "end_turn"
+	}
+	if err := o.writeEvent(c, "message_delta", map[string]interface{}{
+		"type":  "message_delta",
+		"delta": map[string]interface{}{"stop_reason": o.stopReason, "stop_sequence": nil},
+		"usage": messagesUsage(o.usage),
+	}); err != nil {
+		return err
+	}
+	return o.writeEvent(c, "message_stop", map[string]interface{}{"type": "message_stop"})
+}
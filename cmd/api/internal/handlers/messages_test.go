@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// newTestContext 返回记录响应的 echo.Context
+func newTestContext() (echo.Context, *httptest.ResponseRecorder) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	return echo.New().NewContext(req, rec), rec
+}
+
+// readSSE 解析响应中的所有 SSE 事件
+func readSSE(t *testing.T, body string) []*sseEvent {
+	t.Helper()
+	reader := newSSEReader(strings.NewReader(body))
+	var events []*sseEvent
+	for {
+		event, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			return events
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+}
+
+func TestMessagesToChatCompletion(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     string
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "字符串内容",
+			req:  `{"model":"claude","max_tokens":100,"system":"sys","messages":[{"role":"user","content":"hi"}]}`,
+			want: `{"model":"claude","max_tokens":100,"stream":false,"messages":[
+				{"role":"system","content":"sys"},{"role":"user","content":"hi"}]}`,
+		},
+		{
+			name: "工具调用和工具结果",
+			req: `{"model":"claude","max_tokens":100,"messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":[{"type":"thinking","thinking":"..."},{"type":"text","text":"ok"},
+					{"type":"tool_use","id":"t1","name":"f","input":{"a":1}}]},
+				{"role":"user","content":[{"type":"tool_result","tool_use_id":"t1","content":"r"},{"type":"text","text":"next"}]}]}`,
+			want: `{"model":"claude","max_tokens":100,"stream":false,"messages":[
+				{"role":"user","content":"hi"},
+				{"role":"assistant","content":"ok","tool_calls":[{"id":"t1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},
+				{"role":"tool","tool_call_id":"t1","content":"r"},
+				{"role":"user","content":[{"type":"text","text":"next"}]}]}`,
+		},
+		{
+			name: "参数转换并保留 cache_control",
+			req: `{"model":"claude","max_tokens":100,"stream":true,"top_p":0.5,"stop_sequences":["X"],"metadata":{"user_id":"u"},
+				"system":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}],
+				"tools":[{"name":"f","description":"d","input_schema":{"type":"object"},"cache_control":{"type":"ephemeral"}}],
+				"tool_choice":{"type":"tool","name":"f","disable_parallel_tool_use":true},
+				"messages":[{"role":"user","content":[{"type":"image","source":{"type":"base64","media_type":"image/png","data":"AAA"}}]}]}`,
+			want: `{"model":"claude","max_tokens":100,"stream":true,"stream_options":{"include_usage":true},
+				"top_p":0.5,"stop":["X"],"user":"u",
+				"tools":[{"type":"function","function":{"name":"f","description":"d","parameters":{"type":"object"}},"cache_control":{"type":"ephemeral"}}],
+				"tool_choice":{"type":"function","function":{"name":"f"}},"parallel_tool_calls":false,
+				"messages":[
+					{"role":"system","content":[{"type":"text","text":"sys","cache_control":{"type":"ephemeral"}}]},
+					{"role":"user","content":[{"type":"image_url","image_url":{"url":"data:image/png;base64,AAA"}}]}]}`,
+		},
+		{
+			name:    "不支持的角色",
+			req:     `{"model":"claude","messages":[{"role":"system","content":"sys"}]}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req MessagesRequest
+			if err := json.Unmarshal([]byte(tt.req), &req); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := req.toChatCompletion()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			body, err := converted.MarshalJSON()
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, body, tt.want)
+		})
+	}
+}
+
+func TestMessagesStopReason(t *testing.T) {
+	tests := map[string]string{
+		"stop":           "end_turn",
+		"length":         "max_tokens",
+		"tool_calls":     "tool_use",
+		"function_call":  "tool_use",
+		"content_filter": "refusal",
+		"":               "end_turn",
+	}
+	for finishReason, want := range tests {
+		if got := messagesStopReason(finishReason); got != want {
+			t.Errorf("messagesStopReason(%q) = %q, want %q", finishReason, got, want)
+		}
+	}
+}
+
+func TestAnthropicOutputResponse(t *testing.T) {
+	c, rec := newTestContext()
+	body := `{"id":"chatcmpl-1","model":"gpt","choices":[{"message":{"content":"Hi","tool_calls":[
+		{"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\":1}"}}]},"finish_reason":"tool_calls"}],
+		"usage":{"prompt_tokens":10,"completion_tokens":3,"total_tokens":13,"prompt_tokens_details":{"cached_tokens":4}}}`
+	if err := (&anthropicOutput{}).writeResponse(c, []byte(body)); err != nil {
+		t.Fatal(err)
+	}
+	assertJSON(t, rec.Body.Bytes(), `{"id":"chatcmpl-1","type":"message","role":"assistant","model":"gpt",
+		"content":[{"type":"text","text":"Hi"},{"type":"tool_use","id":"c1","name":"f","input":{"a":1}}],
+		"stop_reason":"tool_use","stop_sequence":null,
+		"usage":{"input_tokens":6,"output_tokens":3,"cache_read_input_tokens":4}}`)
+
+	c, rec = newTestContext()
+	if err := (&anthropicOutput{}).writeResponse(c, []byte(`{"choices":[]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("无效响应的状态码 = %d", rec.Code)
+	}
+}
+
+// writeAnthropicStream 依次写入 OpenAI 数据块，返回输出的 Anthropic 事件
+func writeAnthropicStream(t *testing.T, chunks []string) []*sseEvent {
+	t.Helper()
+	c, rec := newTestContext()
+	output := &anthropicOutput{}
+	for _, data := range chunks {
+		event := &sseEvent{Data: data}
+		if err := output.writeStreamEvent(c, event, decodeStreamChunk(event)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := output.finishStream(c); err != nil {
+		t.Fatal(err)
+	}
+	return readSSE(t, rec.Body.String())
+}
+
+func TestAnthropicOutputStream(t *testing.T) {
+	chunks := []string{
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"role":"assistant","content":"Hi"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"c1","type":"function","function":{"name":"f","arguments":""}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"a\":1}"}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{},"finish_reason":"tool_calls"}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2,"total_tokens":7}}`,
+		sseDone,
+	}
+	// [DONE] 后 finishStream 不重复输出结束事件
+	events := writeAnthropicStream(t, chunks)
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Event)
+	}
+	want := []string{
+		"message_start",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"content_block_start", "content_block_delta", "content_block_stop",
+		"message_delta", "message_stop",
+	}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", names, want)
+	}
+	assertJSON(t, []byte(events[5].Data), `{"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"a\":1}"}}`)
+	assertJSON(t, []byte(events[7].Data), `{"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},
+		"usage":{"input_tokens":5,"output_tokens":2}}`)
+}
+
+func TestAnthropicOutputStreamToolArgumentsAfterText(t *testing.T) {
+	events := writeAnthropicStream(t, []string{
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"id":"c1","type":"function","function":{"name":"f","arguments":"{\"a\""}}]}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"tool_calls":[{"index":0,"function":{"arguments":":1}"}}]}}]}`,
+		sseDone,
+	})
+
+	// 工具调用块在文本之后仍然打开，结束时按序号关闭
+	var got []string
+	for _, event := range events {
+		var data struct {
+			Index *int `json:"index"`
+			Delta struct {
+				Text        string `json:"text"`
+				PartialJSON string `json:"partial_json"`
+			} `json:"delta"`
+		}
+		if err := json.Unmarshal([]byte(event.Data), &data); err != nil {
+			t.Fatal(err)
+		}
+		line := event.Event
+		if data.Index != nil {
+			line += fmt.Sprintf(" %d", *data.Index)
+		}
+		got = append(got, line+" "+data.Delta.Text+data.Delta.PartialJSON)
+	}
+	want := []string{
+		"message_start ",
+		"content_block_start 0 ",
+		`content_block_delta 0 {"a"`,
+		"content_block_start 1 ",
+		"content_block_delta 1 Hi",
+		"content_block_delta 0 :1}",
+		"content_block_stop 0 ",
+		"content_block_stop 1 ",
+		"message_delta ",
+		"message_stop ",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("events =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestAnthropicOutputStreamErrorChunk(t *testing.T) {
+	events := writeAnthropicStream(t, []string{
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+		`{"error":{"message":"upstream overloaded","type":"server_error"}}`,
+		`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"ignored"}}]}`,
+		sseDone,
+	})
+
+	// 错误事件之后不再输出任何事件
+	var names []string
+	for _, event := range events {
+		names = append(names, event.Event)
+	}
+	want := []string{"message_start", "content_block_start", "content_block_delta", "error"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Fatalf("events = %v, want %v", names, want)
+	}
+	if !strings.Contains(events[3].Data, "upstream overloaded") {
+		t.Errorf("error = %s", events[3].Data)
+	}
+}
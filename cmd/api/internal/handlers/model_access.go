@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// modelAccessError 模型无法服务本次请求的原因
+type modelAccessError struct {
+	Status     int
+	Type       string
+	Code       string
+	Message    string
+	RetryAfter time.Duration // 大于 0 时返回 Retry-After 响应头
+}
+
+// Error 返回与 OpenAI 一致的错误提示
+func (e *modelAccessError) Error() string {
+	return e.Message
+}
+
+// modelNotFound 生成模型不存在的错误
+func modelNotFound(modelName string) *modelAccessError {
+	return &modelAccessError{
+		Status:  http.StatusNotFound,
+		Type:    errTypeInvalidRequest,
+		Code:    errCodeModelNotFound,
+		Message: fmt.Sprintf("The model `%s` does not exist", modelName),
+	}
+}
+
+// resolveModel 查找用户请求的模型并检查能否服务，返回实际服务请求的模型
+// 依次检查归属、启用状态、弃用重定向（只跳转一次）和可用时间段，已弃用的模型会设置提示响应头
+func (h *Handler) resolveModel(c echo.Context, userID uint64, modelName string) (*cache.ModelCacheItem, error) {
+	item, err := h.findModelByName(modelName)
+	if err != nil {
+		return nil, modelNotFound(modelName)
+	}
+	if item.Model.UserID != userID {
+		return nil, &modelAccessError{
+			Status:  http.StatusForbidden,
+			Type:    errTypePermission,
+			Message: fmt.Sprintf("The model `%s` does not belong to your account", modelName),
+		}
+	}
+	// 已停用的模型按不存在处理
+	if !item.Model.IsActive {
+		return nil, modelNotFound(modelName)
+	}
+
+	deprecated := item.Model.Deprecated
+	if deprecated && item.Model.RedirectTo != "" {
+		target, err := h.findModelByName(item.Model.RedirectTo)
+		if err != nil || target.Model.UserID != userID || !target.Model.IsActive {
+			return nil, &modelAccessError{
+				Status:  http.StatusNotFound,
+				Type:    errTypeInvalidRequest,
+				Code:    errCodeModelNotFound,
+				Message: fmt.Sprintf("The model `%s` is deprecated and its replacement `%s` is not available", modelName, item.Model.RedirectTo),
+			}
+		}
+		c.Response().Header().Set("x-model-redirected-to", target.CacheKey())
+		item = target
+	}
+	if deprecated {
+		c.Response().Header().Set("x-model-deprecated", "true")
+	}
+
+	now := time.Now()
+	if !item.AvailableAt(now) {
+		next := item.NextAvailable(now)
+		return nil, &modelAccessError{
+			Status: http.StatusServiceUnavailable,
+			Type:   errTypeServer,
+			Code:   errCodeModelUnavailable,
+			Message: fmt.Sprintf("The model `%s` is only available during its scheduled hours (%s). It will be available again at %s.",
+				modelName, item.Model.Availability, next.Format("2006-01-02 15:04:05 MST")),
+			RetryAfter: next.Sub(now),
+		}
+	}
+
+	return item, nil
+}
+
+// modelAccessErrorResponse 返回 OpenAI 格式的模型不可用错误
+func modelAccessErrorResponse(c echo.Context, err error) error {
+	accessErr, ok := err.(*modelAccessError)
+	if !ok {
+		return proxyError(c, http.StatusInternalServerError, errTypeServer, "", err.Error())
+	}
+	if accessErr.RetryAfter > 0 {
+		c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(accessErr.RetryAfter.Seconds()))))
+	}
+	return proxyError(c, accessErr.Status, accessErr.Type, accessErr.Code, accessErr.Message)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/model-system/api/internal/middleware"
+	"github.com/model-system/api/internal/models"
 )
 
 // CreateModel 创建模型
@@ -28,6 +29,9 @@ func (h *Handler) CreateModel(c echo.Context) error {
 		CompressTruncateLen int    `json:"compress_truncate_len"`
 		CompressUserCount   int    `json:"compress_user_count"`
 		CompressRoleTypes   string `json:"compress_role_types"`
+		EmbeddingsEnabled   bool   `json:"embeddings_enabled"`
+		models.ModelPricing
+		models.ModelLifecycle
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -48,6 +52,13 @@ func (h *Handler) CreateModel(c echo.Context) error {
 		req.DisplayName = req.ModelID
 	}
 
+	if !validModelPricing(req.ModelPricing) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "模型单价不能为负数",
+		})
+	}
+
 	// 设置默认值
 	if req.CompressTruncateLen <= 0 {
 		req.CompressTruncateLen = 500
@@ -57,7 +68,7 @@ func (h *Handler) CreateModel(c echo.Context) error {
 	}
 
 	model, err := h.modelService.Create(userID, req.ProviderID, req.ModelID, req.DisplayName, req.ContextLength,
-		req.CompressEnabled, req.CompressTruncateLen, req.CompressUserCount, req.CompressRoleTypes)
+		req.CompressEnabled, req.CompressTruncateLen, req.CompressUserCount, req.CompressRoleTypes, req.EmbeddingsEnabled, req.ModelPricing, req.ModelLifecycle)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, Response{
 			Code:    400,
@@ -80,6 +91,11 @@ func (h *Handler) CreateModel(c echo.Context) error {
 	})
 }
 
+// validModelPricing 检查模型单价是否合法（0 表示不计费）
+func validModelPricing(pricing models.ModelPricing) bool {
+	return pricing.InputPrice >= 0 && pricing.OutputPrice >= 0 && pricing.CachedInputPrice >= 0
+}
+
 // GetModels 获取所有模型
 // GET /api/models
 func (h *Handler) GetModels(c echo.Context) error {
@@ -176,6 +192,9 @@ func (h *Handler) UpdateModel(c echo.Context) error {
 		CompressTruncateLen int    `json:"compress_truncate_len"`
 		CompressUserCount   int    `json:"compress_user_count"`
 		CompressRoleTypes   string `json:"compress_role_types"`
+		EmbeddingsEnabled   bool   `json:"embeddings_enabled"`
+		models.ModelPricing
+		models.ModelLifecycle
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -194,6 +213,13 @@ func (h *Handler) UpdateModel(c echo.Context) error {
 		})
 	}
 
+	if !validModelPricing(req.ModelPricing) {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "模型单价不能为负数",
+		})
+	}
+
 	// 设置默认值
 	if req.CompressTruncateLen <= 0 {
 		req.CompressTruncateLen = 500
@@ -203,7 +229,7 @@ func (h *Handler) UpdateModel(c echo.Context) error {
 	}
 
 	_, err = h.modelService.Update(id, userID, req.ProviderID, req.ModelID, req.DisplayName, req.IsActive, req.ContextLength,
-		req.CompressEnabled, req.CompressTruncateLen, req.CompressUserCount, req.CompressRoleTypes)
+		req.CompressEnabled, req.CompressTruncateLen, req.CompressUserCount, req.CompressRoleTypes, req.EmbeddingsEnabled, req.ModelPricing, req.ModelLifecycle)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, Response{
 			Code:    400,
@@ -257,6 +283,126 @@ func (h *Handler) DeleteModel(c echo.Context) error {
 	})
 }
 
+// GetModelFallbacks 获取模型的备用目标
+// GET /api/models/:id/fallbacks
+func (h *Handler) GetModelFallbacks(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	model, ok := h.modelService.GetByID(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: "模型不存在",
+		})
+	}
+
+	if model.UserID != userID {
+		return c.JSON(http.StatusForbidden, Response{
+			Code:    403,
+			Message: "无权限查看此模型",
+		})
+	}
+
+	fallbacks := model.Fallbacks
+	if fallbacks == nil {
+		fallbacks = []models.ModelFallbackWithProvider{}
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    fallbacks,
+	})
+}
+
+// UpdateModelFallbacks 设置模型的备用目标（整体替换，数组顺序即尝试顺序）
+// PUT /api/models/:id/fallbacks
+func (h *Handler) UpdateModelFallbacks(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	var req struct {
+		Fallbacks []struct {
+			ProviderID    uint64 `json:"provider_id"`
+			TargetModelID string `json:"target_model_id"`
+		} `json:"fallbacks"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+
+	model, ok := h.modelService.GetByID(id)
+	if !ok {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: "模型不存在",
+		})
+	}
+
+	if model.UserID != userID {
+		return c.JSON(http.StatusForbidden, Response{
+			Code:    403,
+			Message: "无权限修改此模型",
+		})
+	}
+
+	fallbacks := make([]models.ModelFallback, 0, len(req.Fallbacks))
+	for _, item := range req.Fallbacks {
+		fallbacks = append(fallbacks, models.ModelFallback{
+			ProviderID:    item.ProviderID,
+			TargetModelID: item.TargetModelID,
+		})
+	}
+
+	result, err := h.modelService.SetFallbacks(id, fallbacks)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	}
+	if result == nil {
+		result = []models.ModelFallbackWithProvider{}
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    result,
+	})
+}
+
 // RefreshModelCache 刷新模型缓存
 // POST /api/admin/models/refresh
 func (h *Handler) RefreshModelCache(c echo.Context) error {
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OpenAI 错误类型
+const (
+	errTypeInvalidRequest    = "invalid_request_error"
+	errTypeAuthentication    = "authentication_error"
+	errTypePermission        = "permission_error"
+	errTypeRateLimit         = "rate_limit_error"
+	errTypeInsufficientQuota = "insufficient_quota"
+	errTypeServer            = "server_error"
+	errTypeUpstream          = "upstream_error"
+)
+
+// OpenAI 错误码
+const (
+	errCodeInvalidAPIKey     = "invalid_api_key"
+	errCodeModelNotFound     = "model_not_found"
+	errCodeModelUnavailable  = "model_unavailable"
+	errCodeUpstream          = "upstream_error"
+	errCodeRateLimitExceeded = "rate_limit_exceeded"
+	errCodeInsufficientQuota = "insufficient_quota"
+	errCodeContextLength     = "context_length_exceeded"
+)
+
+// upstreamErrorMaxLen 厂商非 JSON 错误内容写入错误消息的最大长度
+const upstreamErrorMaxLen = 1000
+
+// OpenAIError OpenAI 格式的错误信息
+type OpenAIError struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+// OpenAIErrorResponse OpenAI 格式的错误响应
+type OpenAIErrorResponse struct {
+	Error OpenAIError `json:"error"`
+}
+
+// proxyError 返回代理接口的 OpenAI 格式错误响应
+// {"error":{"message":"...","type":"...","param":null,"code":"..."}}
+func proxyError(c echo.Context, status int, errType, code, message string) error {
+	openAIErr := OpenAIError{
+		Message: message,
+		Type:    errType,
+	}
+	if code != "" {
+		openAIErr.Code = &code
+	}
+	return writeProxyError(c, status, openAIErr)
+}
+
+// writeProxyError 按客户端协议写回错误响应，/v1/messages 返回 Anthropic 格式
+func writeProxyError(c echo.Context, status int, openAIErr OpenAIError) error {
+	if isAnthropicClient(c) {
+		return c.JSON(status, anthropicErrorResponse(status, openAIErr.Message))
+	}
+	return c.JSON(status, OpenAIErrorResponse{Error: openAIErr})
+}
+
+// upstreamErrorStatus 计算返回给客户端的状态码
+// 客户端可处理的 4xx（参数错误、限流等）原样透传；厂商鉴权失败属于代理配置问题，和其余 5xx 一样返回 502
+func upstreamErrorStatus(status int) int {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden || status == http.StatusProxyAuthRequired:
+		return http.StatusBadGateway
+	case status >= 400 && status < 500:
+		return status
+	case status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+		return status
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// upstreamRequestError 未能从厂商获得响应时的错误响应：所有目标都已熔断时返回 503，其余返回 502
+func upstreamRequestError(c echo.Context, err error) error {
+	if errors.Is(err, errProviderCircuitOpen) {
+		return proxyError(c, http.StatusServiceUnavailable, errTypeUpstream, errCodeUpstream,
+			"Upstream provider is temporarily unavailable, please retry later")
+	}
+	return proxyError(c, http.StatusBadGateway, errTypeUpstream, errCodeUpstream, "Failed to reach upstream provider: "+err.Error())
+}
+
+// upstreamError 将厂商返回的错误转换为 OpenAI 格式的错误响应
+// 厂商返回 OpenAI 格式错误时保留其 type/code，429 时透传 Retry-After
+func upstreamError(c echo.Context, upstreamStatus int, header http.Header, body []byte) error {
+	status := upstreamErrorStatus(upstreamStatus)
+
+	var parsed struct {
+		Error *struct {
+			Message string          `json:"message"`
+			Type    string          `json:"type"`
+			Param   *string         `json:"param"`
+			Code    json.RawMessage `json:"code"`
+		} `json:"error"`
+	}
+	openAIErr := OpenAIError{
+		Type: errTypeUpstream,
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error != nil && parsed.Error.Message != "" {
+		openAIErr.Message = parsed.Error.Message
+		openAIErr.Param = parsed.Error.Param
+		// 仅透传的 4xx 保留厂商的错误类型和错误码
+		if status == upstreamStatus && status < 500 {
+			if parsed.Error.Type != "" {
+				openAIErr.Type = parsed.Error.Type
+			}
+			// code 可能是字符串或数字
+			var code string
+			if err := json.Unmarshal(parsed.Error.Code, &code); err == nil && code != "" {
+				openAIErr.Code = &code
+			} else if len(parsed.Error.Code) > 0 && string(parsed.Error.Code) != "null" {
+				code = string(parsed.Error.Code)
+				openAIErr.Code = &code
+			}
+		}
+	} else {
+		text := strings.TrimSpace(string(body))
+		if len(text) > upstreamErrorMaxLen {
+			text = text[:upstreamErrorMaxLen]
+		}
+		openAIErr.Message = text
+	}
+
+	if openAIErr.Message == "" {
+		openAIErr.Message = http.StatusText(upstreamStatus)
+	}
+	openAIErr.Message = fmt.Sprintf("Upstream provider returned %d: %s", upstreamStatus, openAIErr.Message)
+
+	switch {
+	case status == http.StatusTooManyRequests:
+		openAIErr.Type = errTypeRateLimit
+		code := errCodeRateLimitExceeded
+		openAIErr.Code = &code
+		if retryAfter := header.Get("Retry-After"); retryAfter != "" {
+			c.Response().Header().Set("Retry-After", retryAfter)
+		}
+	case openAIErr.Code == nil:
+		code := errCodeUpstream
+		openAIErr.Code = &code
+	}
+
+	return writeProxyError(c, status, openAIErr)
+}
+
+// OpenAINotFound OpenAI 兼容路由分组下未匹配的路径
+// ANY /v1/*, /api/v1/*
+func (h *Handler) OpenAINotFound(c echo.Context) error {
+	return proxyError(c, http.StatusNotFound, errTypeInvalidRequest, "unknown_url",
+		"Unknown request URL: "+c.Request().Method+" "+c.Request().URL.Path)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// OpenAIModel OpenAI 格式的模型信息
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// OpenAIModelList OpenAI 格式的模型列表
+type OpenAIModelList struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+// toOpenAIModel 将缓存项转换为 OpenAI 格式的模型信息
+func toOpenAIModel(item *cache.ModelCacheItem) OpenAIModel {
+	return OpenAIModel{
+		ID:      item.CacheKey(),
+		Object:  "model",
+		Created: item.Model.CreatedAt.Unix(),
+		OwnedBy: item.ProviderName,
+	}
+}
+
+// ListOpenAIModels 列出API密钥所属用户可用的模型（不含已停用的模型）
+// GET /api/v1/models
+func (h *Handler) ListOpenAIModels(c echo.Context) error {
+	_, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "Incorrect API key provided")
+	}
+
+	items := h.modelService.GetCache().GetModelsByUser(userID)
+	list := OpenAIModelList{
+		Object: "list",
+		Data:   make([]OpenAIModel, 0, len(items)),
+	}
+	for _, item := range items {
+		if !item.Model.IsActive {
+			continue
+		}
+		list.Data = append(list.Data, toOpenAIModel(item))
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+// GetOpenAIModel 获取单个模型信息
+// GET /api/v1/models/{id}（模型名可能包含 "/"，使用通配路由）
+func (h *Handler) GetOpenAIModel(c echo.Context) error {
+	_, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "Incorrect API key provided")
+	}
+
+	modelName := c.Param("*")
+	item, err := h.findModelByName(modelName)
+	// 不属于该用户或已停用的模型按不存在处理，避免泄露其他用户的模型
+	if err != nil || item.Model.UserID != userID || !item.Model.IsActive {
+		return proxyError(c, http.StatusNotFound, errTypeInvalidRequest, errCodeModelNotFound,
+			fmt.Sprintf("The model `%s` does not exist", modelName))
+	}
+
+	return c.JSON(http.StatusOK, toOpenAIModel(item))
+}
@@ -0,0 +1,255 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/middleware"
+	"github.com/model-system/api/internal/models"
+)
+
+// providerTestTimeout 连接测试和获取厂商模型列表的超时
+const providerTestTimeout = 15 * time.Second
+
+// upstreamModel 厂商模型列表中的模型
+type upstreamModel struct {
+	ID            string `json:"id"`
+	DisplayName   string `json:"display_name"`
+	ContextLength int    `json:"context_length,omitempty"` // 上下文长度，单位k，0 表示厂商未提供
+	Imported      bool   `json:"imported"`                 // 当前用户是否已添加该模型
+}
+
+// providerTestResult 厂商连接测试结果
+type providerTestResult struct {
+	Success    bool            `json:"success"`
+	StatusCode int             `json:"status_code,omitempty"`
+	LatencyMs  int64           `json:"latency_ms"`
+	Error      string          `json:"error,omitempty"`
+	Models     []upstreamModel `json:"models"`
+}
+
+// importSkippedModel 未能导入的模型及原因
+type importSkippedModel struct {
+	ModelID string `json:"model_id"`
+	Reason  string `json:"reason"`
+}
+
+// testProvider 按代理请求的方式选择密钥请求模型列表接口，返回耗时、错误和模型列表
+func (h *Handler) testProvider(ctx context.Context, provider *models.Provider) providerTestResult {
+	ctx, cancel := context.WithTimeout(ctx, providerTestTimeout)
+	defer cancel()
+
+	result := providerTestResult{Models: []upstreamModel{}}
+	start := time.Now()
+	resp, err := h.doModelsRequest(ctx, providerTarget(provider))
+	if err != nil {
+		result.LatencyMs = time.Since(start).Milliseconds()
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = resp.StatusCode
+	if err != nil {
+		result.Error = "读取响应失败: " + err.Error()
+		return result
+	}
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("厂商返回 %d: %s", resp.StatusCode, upstreamErrorText(body))
+		return result
+	}
+
+	upstreamModels, err := adapterFor(provider.Type).parseModels(body)
+	if err != nil {
+		result.Error = "解析模型列表失败: " + err.Error()
+		return result
+	}
+	result.Success = true
+	result.Models = upstreamModels
+	return result
+}
+
+// upstreamErrorText 提取厂商错误响应中的错误消息，非 JSON 时返回截断的原文
+func upstreamErrorText(body []byte) string {
+	var parsed struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil && parsed.Error.Message != "" {
+		return parsed.Error.Message
+	}
+	text := strings.TrimSpace(string(body))
+	if len(text) > upstreamErrorMaxLen {
+		text = text[:upstreamErrorMaxLen]
+	}
+	return text
+}
+
+// markImported 标记当前用户已添加的模型
+func (h *Handler) markImported(userID, providerID uint64, upstreamModels []upstreamModel) {
+	existing := make(map[string]bool)
+	for _, model := range h.modelService.GetByUserID(userID, providerID) {
+		existing[model.ModelID] = true
+	}
+	for i := range upstreamModels {
+		upstreamModels[i].Imported = existing[upstreamModels[i].ID]
+	}
+}
+
+// TestProvider 测试厂商的接口地址和密钥是否可用，返回耗时和厂商的模型列表
+// POST /api/providers/:id/test
+func (h *Handler) TestProvider(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	provider, err := h.providerService.GetByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+	}
+
+	result := h.testProvider(c.Request().Context(), provider)
+	if !result.Success {
+		return c.JSON(http.StatusOK, Response{
+			Code:    0,
+			Message: "连接失败",
+			Data:    result,
+		})
+	}
+
+	h.markImported(userID, id, result.Models)
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "连接成功",
+		Data:    result,
+	})
+}
+
+// ImportProviderModels 从厂商的模型列表中批量添加模型，压缩等设置使用默认值
+// POST /api/providers/:id/import-models
+func (h *Handler) ImportProviderModels(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	var req struct {
+		ModelIDs []string `json:"model_ids"`
+	}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+	if len(req.ModelIDs) == 0 {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请选择要导入的模型",
+		})
+	}
+
+	provider, err := h.providerService.GetByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+	}
+	// Azure OpenAI 的模型ID是部署名，模型列表接口返回的是基础模型名，导入后无法请求
+	if provider.Type == models.ProviderTypeAzure {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Azure OpenAI 厂商不支持导入模型：模型ID需填写部署名，请在模型管理中手动添加",
+		})
+	}
+
+	result := h.testProvider(c.Request().Context(), provider)
+	if !result.Success {
+		return c.JSON(http.StatusBadGateway, Response{
+			Code:    502,
+			Message: "获取厂商模型列表失败: " + result.Error,
+		})
+	}
+	available := make(map[string]upstreamModel, len(result.Models))
+	for _, m := range result.Models {
+		available[m.ID] = m
+	}
+
+	created := []*models.Model{}
+	skipped := []importSkippedModel{}
+	seen := make(map[string]bool, len(req.ModelIDs))
+	for _, modelID := range req.ModelIDs {
+		if seen[modelID] {
+			continue
+		}
+		seen[modelID] = true
+
+		upstream, ok := available[modelID]
+		if !ok {
+			skipped = append(skipped, importSkippedModel{ModelID: modelID, Reason: "厂商模型列表中不存在该模型"})
+			continue
+		}
+		// 上下文长度为 0 时使用默认值，压缩使用默认设置
+		model, err := h.modelService.Create(userID, id, upstream.ID, upstream.DisplayName, upstream.ContextLength,
+			true, 0, 0, "", false, models.ModelPricing{}, models.ModelLifecycle{})
+		if err != nil {
+			skipped = append(skipped, importSkippedModel{ModelID: modelID, Reason: err.Error()})
+			continue
+		}
+		created = append(created, model)
+	}
+
+	if len(created) > 0 {
+		if err := h.modelService.RefreshCache(); err != nil {
+			return c.JSON(http.StatusInternalServerError, Response{
+				Code:    500,
+				Message: "模型导入成功，但缓存刷新失败: " + err.Error(),
+			})
+		}
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: fmt.Sprintf("导入 %d 个模型，跳过 %d 个", len(created), len(skipped)),
+		Data: map[string]interface{}{
+			"created": created,
+			"skipped": skipped,
+		},
+	})
+}
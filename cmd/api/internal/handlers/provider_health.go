@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// errProviderCircuitOpen 模型的所有目标厂商都已熔断
+var errProviderCircuitOpen = errors.New("厂商已熔断")
+
+const (
+	healthCheckInterval = 5 * time.Second  // 检查是否有需要探测的厂商和密钥的间隔
+	healthProbeTimeout  = 10 * time.Second // 单次探测的超时
+)
+
+var healthCheckOnce sync.Once
+
+// availableTargets 过滤掉已熔断的厂商（熔断时间已到、可以放行试探请求的厂商保留）
+func availableTargets(targets []upstreamTarget) []upstreamTarget {
+	available := make([]upstreamTarget, 0, len(targets))
+	for _, target := range targets {
+		if cache.GetCache().ProviderAvailable(target.ProviderID) {
+			available = append(available, target)
+			continue
+		}
+		log.Printf("[WARN] 厂商已熔断，跳过该目标 (provider: %s, model: %s)", target.ProviderName, target.ModelID)
+	}
+	return available
+}
+
+// reportUpstreamResult 将一次厂商请求的结果计入熔断器
+// 网络错误和 502/503/504 计入厂商和密钥，401/403/429 只计入密钥；客户端断开和构建请求失败不计
+// 其他状态码（包括单个模型或部署出错时的 500）说明厂商可以正常响应，计为成功，避免一个模型的故障熔断整个厂商
+func reportUpstreamResult(target *upstreamTarget, resp *http.Response, err error) {
+	var reason string
+	providerFault := true
+	switch {
+	case err != nil:
+		if errors.Is(err, context.Canceled) || !isNetworkError(err) {
+			return
+		}
+		reason = err.Error()
+	case resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout:
+		reason = fmt.Sprintf("厂商返回 %d", resp.StatusCode)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusTooManyRequests:
+		reason = fmt.Sprintf("厂商返回 %d", resp.StatusCode)
+		providerFault = false
+	default:
+		cache.GetCache().ReportProviderSuccess(target.ProviderID, target.KeyID)
+		return
+	}
+
+	providerOpened, keyOpened := cache.GetCache().ReportProviderFailure(target.ProviderID, target.KeyID, reason, providerFault)
+	if providerOpened {
+		log.Printf("[WARN] 厂商连续失败 %d 次，熔断 %s (provider: %s): %s",
+			cache.CircuitFailureThreshold, cache.CircuitOpenDuration, target.ProviderName, reason)
+	}
+	if keyOpened {
+		log.Printf("[WARN] 厂商密钥连续失败 %d 次，熔断 %s (provider: %s, key_id: %d): %s",
+			cache.CircuitFailureThreshold, cache.CircuitOpenDuration, target.ProviderName, target.KeyID, reason)
+	}
+}
+
+// StartHealthChecks 启动后台健康探测
+// 熔断时间已到的厂商和密钥转为探测中，用模型列表接口探测，成功后恢复，失败则重新熔断
+func (h *Handler) StartHealthChecks() {
+	healthCheckOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(healthCheckInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				for _, probe := range cache.GetCache().DueProbes() {
+					go h.runProbe(probe)
+				}
+			}
+		}()
+	})
+}
+
+// runProbe 执行一次探测并记录结果
+func (h *Handler) runProbe(probe cache.ProbeTarget) {
+	err := h.probeProvider(probe)
+	if err != nil {
+		cache.GetCache().ReportProbeResult(probe, false, err.Error())
+		log.Printf("[WARN] 厂商探测失败，继续熔断 (provider_id: %d, key_id: %d): %v", probe.ProviderID, probe.KeyID, err)
+		return
+	}
+	cache.GetCache().ReportProbeResult(probe, true, "")
+	log.Printf("[INFO] 厂商探测成功，恢复使用 (provider_id: %d, key_id: %d)", probe.ProviderID, probe.KeyID)
+}
+
+// probeProvider 请求厂商的模型列表接口
+// 探测厂商时收到非 5xx 响应即视为恢复；探测密钥时需返回 2xx
+func (h *Handler) probeProvider(probe cache.ProbeTarget) error {
+	provider, err := h.providerService.GetByID(probe.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	target := providerTarget(provider)
+	if probe.KeyID != 0 {
+		target.KeyID = probe.KeyID
+		target.APIKey = probe.APIKey
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthProbeTimeout)
+	defer cancel()
+	resp, err := h.doModelsRequest(ctx, target)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= http.StatusInternalServerError || (probe.KeyID != 0 && resp.StatusCode >= http.StatusMultipleChoices) {
+		return fmt.Errorf("厂商返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// GetProviderHealth 获取厂商及其密钥的熔断状态
+// GET /api/providers/:id/health
+func (h *Handler) GetProviderHealth(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	if _, err := h.providerService.GetByID(id); err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    cache.GetCache().GetProviderHealth(id),
+	})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/service"
+)
+
+// providerKeyRequest 厂商密钥创建/更新请求
+type providerKeyRequest struct {
+	Name            string `json:"name"`
+	APIKey          string `json:"api_key"`
+	Weight          int    `json:"weight"`
+	IsActive        *bool  `json:"is_active"`
+	CooldownSeconds int    `json:"cooldown_seconds"`
+}
+
+// providerKeyErrorStatus 根据服务层错误返回HTTP状态码
+func providerKeyErrorStatus(err error) int {
+	if errors.Is(err, service.ErrProviderNotFound) || errors.Is(err, service.ErrProviderKeyNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// GetProviderKeys 获取厂商的所有密钥
+// GET /api/providers/:id/keys
+func (h *Handler) GetProviderKeys(c echo.Context) error {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	keys, err := h.providerKeyService.List(providerID)
+	if err != nil {
+		status := providerKeyErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    keys,
+	})
+}
+
+// CreateProviderKey 为厂商添加密钥
+// POST /api/providers/:id/keys
+func (h *Handler) CreateProviderKey(c echo.Context) error {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	var req providerKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+
+	key := &models.ProviderKey{
+		ProviderID:      providerID,
+		Name:            req.Name,
+		APIKey:          req.APIKey,
+		Weight:          req.Weight,
+		IsActive:        req.IsActive == nil || *req.IsActive,
+		CooldownSeconds: req.CooldownSeconds,
+	}
+
+	if err := h.providerKeyService.Create(key); err != nil {
+		status := providerKeyErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "创建成功",
+		Data:    key,
+	})
+}
+
+// UpdateProviderKey 更新厂商密钥
+// PUT /api/providers/:id/keys/:keyId
+func (h *Handler) UpdateProviderKey(c echo.Context) error {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的密钥ID",
+		})
+	}
+
+	var req providerKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+
+	key, err := h.providerKeyService.GetByID(providerID, keyID)
+	if err != nil {
+		status := providerKeyErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	// 未传的字段保持原值
+	if req.Name != "" {
+		key.Name = req.Name
+	}
+	if req.APIKey != "" {
+		key.APIKey = req.APIKey
+	}
+	if req.Weight != 0 {
+		key.Weight = req.Weight
+	}
+	if req.IsActive != nil {
+		key.IsActive = *req.IsActive
+	}
+	if req.CooldownSeconds != 0 {
+		key.CooldownSeconds = req.CooldownSeconds
+	}
+
+	if err := h.providerKeyService.Update(key); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    key,
+	})
+}
+
+// DeleteProviderKey 删除厂商密钥
+// DELETE /api/providers/:id/keys/:keyId
+func (h *Handler) DeleteProviderKey(c echo.Context) error {
+	providerID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的密钥ID",
+		})
+	}
+
+	if err := h.providerKeyService.Delete(providerID, keyID); err != nil {
+		status := providerKeyErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "删除成功",
+	})
+}
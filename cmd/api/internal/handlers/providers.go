@@ -1,10 +1,13 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/service"
 )
 
 // CreateProvider 创建厂商
@@ -16,6 +19,9 @@ func (h *Handler) CreateProvider(c echo.Context) error {
 		BaseURL     string `json:"base_url"`
 		APIPrefix   string `json:"api_prefix"`
 		APIKey      string `json:"api_key"`
+		Type        string `json:"type"`
+		APIVersion  string `json:"api_version"`
+		models.ProviderPolicy
 	}
 
 	if err := c.Bind(&req); err != nil {
@@ -32,7 +38,19 @@ func (h *Handler) CreateProvider(c echo.Context) error {
 		})
 	}
 
-	provider, err := h.providerService.Create(req.Name, req.DisplayName, req.BaseURL, req.APIPrefix, req.APIKey)
+	// 未指定类型时按 OpenAI 兼容接口处理
+	if req.Type == "" {
+		req.Type = models.ProviderTypeOpenAI
+	}
+
+	if err := req.ProviderPolicy.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	}
+
+	provider, err := h.providerService.Create(req.Name, req.DisplayName, req.BaseURL, req.APIPrefix, req.APIKey, req.Type, req.APIVersion, req.ProviderPolicy)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, Response{
 			Code:    400,
@@ -108,9 +126,23 @@ func (h *Handler) UpdateProvider(c echo.Context) error {
 		BaseURL     string `json:"base_url"`
 		APIPrefix   string `json:"api_prefix"`
 		APIKey      string `json:"api_key"`
+		Type        string `json:"type"`
+		APIVersion  string `json:"api_version"`
 		Prompt      string `json:"prompt"`
+		models.ProviderPolicy
 	}
 
+	provider, err := h.providerService.GetByID(id)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, Response{
+			Code:    404,
+			Message: err.Error(),
+		})
+	}
+
+	// 请求中未提供的 API 版本和超时重试配置沿用原值
+	req.APIVersion = provider.APIVersion
+	req.ProviderPolicy = provider.ProviderPolicy
 	if err := c.Bind(&req); err != nil {
 		return c.JSON(http.StatusBadRequest, Response{
 			Code:    400,
@@ -118,10 +150,9 @@ func (h *Handler) UpdateProvider(c echo.Context) error {
 		})
 	}
 
-	provider, err := h.providerService.GetByID(id)
-	if err != nil {
-		return c.JSON(http.StatusNotFound, Response{
-			Code:    404,
+	if err := req.ProviderPolicy.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
 			Message: err.Error(),
 		})
 	}
@@ -131,8 +162,19 @@ func (h *Handler) UpdateProvider(c echo.Context) error {
 	provider.BaseURL = req.BaseURL
 	provider.APIPrefix = req.APIPrefix
 	provider.APIKey = req.APIKey
+	if req.Type != "" {
+		provider.Type = req.Type
+	}
+	provider.APIVersion = req.APIVersion
+	provider.ProviderPolicy = req.ProviderPolicy
 
 	if err := h.providerService.Update(provider); err != nil {
+		if errors.Is(err, service.ErrInvalidProviderType) {
+			return c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: err.Error(),
+			})
+		}
 		return c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: err.Error(),
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/middleware"
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/service"
+)
+
+// quotaError 返回 OpenAI 格式的配额用尽错误
+// token 配额返回 429，费用配额返回 402
+func quotaError(c echo.Context, err error) error {
+	var quotaErr *service.QuotaExceededError
+	if !errors.As(err, &quotaErr) {
+		return proxyError(c, http.StatusTooManyRequests, errTypeInsufficientQuota, errCodeInsufficientQuota, err.Error())
+	}
+
+	quota := quotaErr.Quota
+	status := http.StatusTooManyRequests
+	if quota.LimitType == models.QuotaLimitCost {
+		status = http.StatusPaymentRequired
+	}
+	scope := "account"
+	if quota.APIKeyID != 0 {
+		scope = "API key"
+	}
+	message := fmt.Sprintf("You exceeded your %s %s quota for this %s (limit %g). The quota resets at %s.",
+		quota.Period, quota.LimitType, scope, quota.LimitValue, quota.ResetAt.Format("2006-01-02 15:04:05 MST"))
+
+	return proxyError(c, status, errTypeInsufficientQuota, errCodeInsufficientQuota, message)
+}
+
+// quotaErrorStatus 根据服务层错误返回HTTP状态码
+func quotaErrorStatus(err error) int {
+	if errors.Is(err, service.ErrQuotaNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
+
+// GetQuotas 获取当前用户的配额（含各API密钥的配额）
+// GET /api/quotas
+func (h *Handler) GetQuotas(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	quotas, err := h.quotaService.List(userID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    quotas,
+	})
+}
+
+// CreateQuota 创建配额
+// POST /api/quotas
+func (h *Handler) CreateQuota(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	var req struct {
+		APIKeyID   uint64  `json:"api_key_id"` // 0 表示作用于用户的所有密钥
+		Period     string  `json:"period"`
+		LimitType  string  `json:"limit_type"`
+		LimitValue float64 `json:"limit_value"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+
+	if req.LimitType == "" {
+		req.LimitType = models.QuotaLimitTokens
+	}
+
+	quota, err := h.quotaService.Create(userID, req.APIKeyID, req.Period, req.LimitType, req.LimitValue)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "创建成功",
+		Data:    quota,
+	})
+}
+
+// UpdateQuota 更新配额上限
+// PUT /api/quotas/:id
+func (h *Handler) UpdateQuota(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	var req struct {
+		LimitValue float64 `json:"limit_value"`
+	}
+
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "请求参数错误",
+		})
+	}
+
+	quota, err := h.quotaService.UpdateLimit(userID, id, req.LimitValue)
+	if err != nil {
+		status := quotaErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "更新成功",
+		Data:    quota,
+	})
+}
+
+// DeleteQuota 删除配额
+// DELETE /api/quotas/:id
+func (h *Handler) DeleteQuota(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "无效的ID",
+		})
+	}
+
+	if err := h.quotaService.Delete(userID, id); err != nil {
+		status := quotaErrorStatus(err)
+		return c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "删除成功",
+	})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// formatResetDuration 格式化限额恢复时间（与 OpenAI 一致，如 "1s"、"6m0s"、"250ms"）
+func formatResetDuration(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+// setRateLimitHeaders 写入 OpenAI 格式的 x-ratelimit-* 响应头，未限制的维度不写入
+func setRateLimitHeaders(c echo.Context, status cache.RateLimitStatus) {
+	header := c.Response().Header()
+	if status.LimitRequests > 0 {
+		header.Set("x-ratelimit-limit-requests", strconv.Itoa(status.LimitRequests))
+		header.Set("x-ratelimit-remaining-requests", strconv.Itoa(status.RemainingRequests))
+		header.Set("x-ratelimit-reset-requests", formatResetDuration(status.ResetRequests))
+	}
+	if status.LimitTokens > 0 {
+		header.Set("x-ratelimit-limit-tokens", strconv.Itoa(status.LimitTokens))
+		header.Set("x-ratelimit-remaining-tokens", strconv.Itoa(status.RemainingTokens))
+		header.Set("x-ratelimit-reset-tokens", formatResetDuration(status.ResetTokens))
+	}
+}
+
+// rateLimitError 返回 OpenAI 格式的 429 限流错误，并写入 Retry-After
+func rateLimitError(c echo.Context, err error) error {
+	var limitErr *cache.RateLimitError
+	if !errors.As(err, &limitErr) {
+		return proxyError(c, http.StatusTooManyRequests, errTypeRateLimit, errCodeRateLimitExceeded, err.Error())
+	}
+
+	setRateLimitHeaders(c, limitErr.Status)
+	retryAfter := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	return proxyError(c, http.StatusTooManyRequests, errTypeRateLimit, errCodeRateLimitExceeded, limitErr.Error())
+}
@@ -0,0 +1,645 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+)
+
+// ResponsesRequest OpenAI Responses API 请求
+type ResponsesRequest struct {
+	Model              string                   `json:"model"`
+	Input              json.RawMessage          `json:"input"`
+	Instructions       string                   `json:"instructions"`
+	Tools              []map[string]interface{} `json:"tools"`
+	ToolChoice         interface{}              `json:"tool_choice"`
+	ParallelToolCalls  *bool                    `json:"parallel_tool_calls"`
+	Temperature        *float64                 `json:"temperature"`
+	TopP               *float64                 `json:"top_p"`
+	MaxOutputTokens    *int                     `json:"max_output_tokens"`
+	Stream             bool                     `json:"stream"`
+	User               string                   `json:"user"`
+	PreviousResponseID string                   `json:"previous_response_id"`
+	Text               *struct {
+		Format map[string]interface{} `json:"format"`
+	} `json:"text"`
+	Reasoning *struct {
+		Effort string `json:"effort"`
+	} `json:"reasoning"`
+}
+
+// Responses OpenAI Responses API，转换为聊天补全请求后走同一代理流程
+// POST /v1/responses
+func (h *Handler) Responses(c echo.Context) error {
+	startTime := time.Now()
+
+	// 验证API密钥并获取用户ID
+	apiKey, userID, ok := authenticateAPIKey(c)
+	if !ok {
+		return proxyError(c, http.StatusUnauthorized, errTypeAuthentication, errCodeInvalidAPIKey, "Incorrect API key provided")
+	}
+
+	apiKeyID, _ := cache.GetCache().GetAPIKeyID(apiKey)
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		log.Printf("[ERROR] 读取请求体失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Failed to read request body")
+	}
+	var responsesReq ResponsesRequest
+	if err := json.Unmarshal(body, &responsesReq); err != nil {
+		log.Printf("[ERROR] 解析请求失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", "Invalid JSON in request body: "+err.Error())
+	}
+
+	req, err := responsesReq.toChatCompletion()
+	if err != nil {
+		log.Printf("[ERROR] 转换 Responses 请求失败: %v", err)
+		return proxyError(c, http.StatusBadRequest, errTypeInvalidRequest, "", err.Error())
+	}
+	chatBody, _ := req.MarshalJSON()
+
+	return h.proxyChat(c, startTime, apiKey, apiKeyID, userID, chatBody, req, newResponsesOutput())
+}
+
+// toChatCompletion 转换为 OpenAI 格式的聊天补全请求
+// 代理不保存历史响应，多轮对话需由客户端在 input 中携带完整上下文
+func (r ResponsesRequest) toChatCompletion() (ChatCompletionRequest, error) {
+	if r.PreviousResponseID != "" {
+		return ChatCompletionRequest{}, fmt.Errorf("previous_response_id is not supported; send the full conversation in input")
+	}
+
+	var messages []ChatMessage
+	if r.Instructions != "" {
+		content, _ := json.Marshal(r.Instructions)
+		messages = append(messages, ChatMessage{Role: "system", Content: content})
+	}
+	inputMessages, err := responsesInputMessages(r.Input)
+	if err != nil {
+		return ChatCompletionRequest{}, err
+	}
+	messages = append(messages, inputMessages...)
+
+	req := ChatCompletionRequest{
+		Model:       r.Model,
+		Messages:    MarshalMessagesToJSON(messages),
+		Stream:      r.Stream,
+		Temperature: r.Temperature,
+		MaxTokens:   r.MaxOutputTokens,
+		Extra:       make(map[string]interface{}),
+	}
+	if r.Stream {
+		// 要求 OpenAI 兼容厂商在流式响应最后返回 usage
+		req.Extra["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+	if r.TopP != nil {
+		req.Extra["top_p"] = *r.TopP
+	}
+	if r.User != "" {
+		req.Extra["user"] = r.User
+	}
+	if r.ParallelToolCalls != nil {
+		req.Extra["parallel_tool_calls"] = *r.ParallelToolCalls
+	}
+	if r.Reasoning != nil && r.Reasoning.Effort != "" {
+		req.Extra["reasoning_effort"] = r.Reasoning.Effort
+	}
+	if r.Text != nil {
+		switch r.Text.Format["type"] {
+		case "json_object":
+			req.Extra["response_format"] = map[string]interface{}{"type": "json_object"}
+		case "json_schema":
+			schema := map[string]interface{}{"name": r.Text.Format["name"], "schema": r.Text.Format["schema"]}
+			if strict, ok := r.Text.Format["strict"]; ok {
+				schema["strict"] = strict
+			}
+			if description, ok := r.Text.Format["description"]; ok {
+				schema["description"] = description
+			}
+			req.Extra["response_format"] = map[string]interface{}{"type": "json_schema", "json_schema": schema}
+		}
+	}
+	if len(r.Tools) > 0 {
+		tools := make([]interface{}, 0, len(r.Tools))
+		for i, tool := range r.Tools {
+			if tool["type"] != "function" {
+				return ChatCompletionRequest{}, fmt.Errorf("tools.%d.type: tool type %v is not supported", i, tool["type"])
+			}
+			function := map[string]interface{}{"name": tool["name"]}
+			for _, key := range []string{"description", "parameters", "strict"} {
+				if value, ok := tool[key]; ok {
+					function[key] = value
+				}
+			}
+			tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+		}
+		req.Extra["tools"] = tools
+	}
+	switch choice := r.ToolChoice.(type) {
+	case string:
+		req.Extra["tool_choice"] = choice
+	case map[string]interface{}:
+		if choice["type"] == "function" {
+			req.Extra["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice["name"]},
+			}
+		}
+	}
+	return req, nil
+}
+
+// responsesInputMessages 转换 input（字符串或输入项数组）为 OpenAI 消息
+// 连续的 function_call 项合并到同一条 assistant 消息的 tool_calls 中
+func responsesInputMessages(input json.RawMessage) ([]ChatMessage, error) {
+	if len(input) == 0 || string(input) == "null" {
+		return nil, fmt.Errorf("input: field required")
+	}
+	var text string
+	if err := json.Unmarshal(input, &text); err == nil {
+		content, _ := json.Marshal(text)
+		return []ChatMessage{{Role: "user", Content: content}}, nil
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(input, &items); err != nil {
+		return nil, fmt.Errorf("input: must be a string or an array of input items")
+	}
+
+	var messages []ChatMessage
+	var toolCalls []openAIToolCall // 当前 assistant 消息的工具调用
+	flush := func() {
+		if len(toolCalls) == 0 {
+			return
+		}
+		raw, _ := json.Marshal(toolCalls)
+		messages[len(messages)-1].ToolCalls = (*json.RawMessage)(&raw)
+		toolCalls = nil
+	}
+
+	for i, item := range items {
+		switch item["type"] {
+		case nil, "message":
+			flush()
+			role, _ := item["role"].(string)
+			switch role {
+			case "user", "system", "developer", "assistant":
+			default:
+				return nil, fmt.Errorf("input.%d.role: unexpected role %q", i, role)
+			}
+			if role == "developer" {
+				// 并非所有厂商都支持 developer 角色，统一按 system 转发
+				role = "system"
+			}
+			messages = append(messages, ChatMessage{Role: role, Content: responsesContent(item["content"], role == "assistant")})
+		case "function_call":
+			// 工具调用挂在紧邻的 assistant 消息上，没有时新建一条空内容的 assistant 消息
+			if len(toolCalls) == 0 && (len(messages) == 0 || messages[len(messages)-1].Role != "assistant" || messages[len(messages)-1].ToolCalls != nil) {
+				messages = append(messages, ChatMessage{Role: "assistant", Content: json.RawMessage("null")})
+			}
+			call := openAIToolCall{Type: "function"}
+			call.ID, _ = item["call_id"].(string)
+			call.Function.Name, _ = item["name"].(string)
+			call.Function.Arguments, _ = item["arguments"].(string)
+			toolCalls = append(toolCalls, call)
+		case "function_call_output":
+			flush()
+			callID, _ := item["call_id"].(string)
+			output, ok := item["output"].(string)
+			if !ok {
+				raw, _ := json.Marshal(item["output"])
+				output = string(raw)
+			}
+			content, _ := json.Marshal(output)
+			messages = append(messages, ChatMessage{Role: "tool", ToolCallID: &callID, Content: content})
+		case "reasoning", "item_reference":
+			// 推理摘要和引用项无法转发给聊天补全接口，忽略
+		default:
+			return nil, fmt.Errorf("input.%d.type: input item type %v is not supported", i, item["type"])
+		}
+	}
+	flush()
+	return messages, nil
+}
+
+// responsesContent 转换消息内容，assistant 消息的 output_text 拼接为字符串
+func responsesContent(content interface{}, assistant bool) json.RawMessage {
+	parts, ok := content.([]interface{})
+	if !ok {
+		raw, _ := json.Marshal(content)
+		return raw
+	}
+
+	var text strings.Builder
+	converted := make([]map[string]interface{}, 0, len(parts))
+	for _, p := range parts {
+		part, _ := p.(map[string]interface{})
+		switch part["type"] {
+		case "input_text", "output_text":
+			s, _ := part["text"].(string)
+			text.WriteString(s)
+			converted = append(converted, map[string]interface{}{"type": "text", "text": s})
+		case "input_image":
+			url, _ := part["image_url"].(string)
+			if url == "" {
+				continue
+			}
+			imageURL := map[string]interface{}{"url": url}
+			if detail, ok := part["detail"]; ok {
+				imageURL["detail"] = detail
+			}
+			converted = append(converted, map[string]interface{}{"type": "image_url", "image_url": imageURL})
+		case "input_file":
+			file := map[string]interface{}{}
+			for _, key := range []string{"file_data", "file_id", "filename"} {
+				if value, ok := part[key]; ok {
+					file[key] = value
+				}
+			}
+			converted = append(converted, map[string]interface{}{"type": "file", "file": file})
+		}
+	}
+
+	var raw []byte
+	if assistant {
+		raw, _ = json.Marshal(text.String())
+	} else {
+		raw, _ = json.Marshal(converted)
+	}
+	return raw
+}
+
+// responsesUsage 将 OpenAI 聊天补全用量转换为 Responses 用量
+func responsesUsage(usage *Usage) map[string]interface{} {
+	if usage == nil {
+		return nil
+	}
+	cached := 0
+	if usage.PromptTokensDetails != nil {
+		cached = usage.PromptTokensDetails.CachedTokens
+	}
+	return map[string]interface{}{
+		"input_tokens":          usage.PromptTokens,
+		"input_tokens_details":  map[string]int{"cached_tokens": cached},
+		"output_tokens":         usage.CompletionTokens,
+		"output_tokens_details": map[string]int{"reasoning_tokens": 0},
+		"total_tokens":          usage.TotalTokens,
+	}
+}
+
+// newResponsesID 生成带前缀的随机 ID（resp_、msg_、fc_）
+func newResponsesID(prefix string) string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return prefix + hex.EncodeToString(bytes)
+}
+
+// responsesOutput Responses 客户端，将 OpenAI 响应和数据块转换为 Responses 对象和 response.* 事件
+type responsesOutput struct {
+	id         string
+	createdAt  int64
+	model      string
+	started    bool
+	finished   bool
+	sequence   int
+	items      []map[string]interface{} // 输出项
+	current    int                      // 当前打开的输出项序号，-1 表示没有
+	text       strings.Builder          // 当前 message 项的文本
+	toolItems  map[int]int              // OpenAI tool_calls 序号 -> 输出项序号
+	incomplete bool                     // 因 max_output_tokens 截断
+	failure    string                   // 厂商流中断时的错误信息
+	usage      *Usage
+}
+
+func newResponsesOutput() *responsesOutput {
+	return &responsesOutput{
+		id:        newResponsesID("resp_"),
+		createdAt: time.Now().Unix(),
+		current:   -1,
+		toolItems: make(map[int]int),
+	}
+}
+
+// response 生成 Responses 对象
+func (o *responsesOutput) response(status string) map[string]interface{} {
+	output := o.items
+	if output == nil {
+		output = []map[string]interface{}{}
+	}
+	var incompleteDetails, failure interface{}
+	if status == "incomplete" {
+		incompleteDetails = map[string]string{"reason": "max_output_tokens"}
+	}
+	if status == "failed" {
+		failure = map[string]string{"code": "server_error", "message": o.failure}
+	}
+	return map[string]interface{}{
+		"id":                 o.id,
+		"object":             "response",
+		"created_at":         o.createdAt,
+		"status":             status,
+		"model":              o.model,
+		"output":             output,
+		"error":              failure,
+		"incomplete_details": incompleteDetails,
+		"usage":              responsesUsage(o.usage),
+	}
+}
+
+// finalStatus 响应结束时的状态
+func (o *responsesOutput) finalStatus() string {
+	if o.incomplete {
+		return "incomplete"
+	}
+	return "completed"
+}
+
+// messageItem 生成 message 输出项
+func messageItem(status, text string) map[string]interface{} {
+	content := []interface{}{}
+	if status == "completed" {
+		content = append(content, outputTextPart(text))
+	}
+	return map[string]interface{}{
+		"type":    "message",
+		"id":      newResponsesID("msg_"),
+		"status":  status,
+		"role":    "assistant",
+		"content": content,
+	}
+}
+
+// outputTextPart 生成 output_text 内容
+func outputTextPart(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "output_text", "text": text, "annotations": []interface{}{}}
+}
+
+// functionCallItem 生成 function_call 输出项
+func functionCallItem(status string, call openAIToolCall) map[string]interface{} {
+	return map[string]interface{}{
+		"type":      "function_call",
+		"id":        newResponsesID("fc_"),
+		"status":    status,
+		"call_id":   call.ID,
+		"name":      call.Function.Name,
+		"arguments": call.Function.Arguments,
+	}
+}
+
+func (o *responsesOutput) writeResponse(c echo.Context, body []byte) error {
+	var resp struct {
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content   json.RawMessage  `json:"content"`
+				ToolCalls []openAIToolCall `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Choices) == 0 {
+		return proxyError(c, http.StatusBadGateway, errTypeUpstream, errCodeUpstream, "Invalid response from upstream provider")
+	}
+
+	choice := resp.Choices[0]
+	var text string
+	if err := json.Unmarshal(choice.Message.Content, &text); err != nil {
+		// 内容数组：拼接其中的文本
+		for _, block := range parseMessagesBlocks(choice.Message.Content) {
+			if s, ok := block["text"].(string); ok {
+				text += s
+			}
+		}
+	}
+	o.model = resp.Model
+	o.usage = resp.Usage
+	o.incomplete = choice.FinishReason == "length"
+	if text != "" {
+		o.items = append(o.items, messageItem("completed", text))
+	}
+	for _, call := range choice.Message.ToolCalls {
+		o.items = append(o.items, functionCallItem("completed", call))
+	}
+
+	return c.JSON(http.StatusOK, o.response(o.finalStatus()))
+}
+
+// writeEvent 写出一个 Responses SSE 事件，自动填充 type 和 sequence_number
+func (o *responsesOutput) writeEvent(c echo.Context, event string, data map[string]interface{}) error {
+	data["type"] = event
+	data["sequence_number"] = o.sequence
+	o.sequence++
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return writeSSEEvent(c, &sseEvent{Event: event, Data: string(payload)})
+}
+
+// start 首个数据块前输出 response.created 和 response.in_progress
+func (o *responsesOutput) start(c echo.Context) error {
+	if o.started {
+		return nil
+	}
+	o.started = true
+	if err := o.writeEvent(c, "response.created", map[string]interface{}{"response": o.response("in_progress")}); err != nil {
+		return err
+	}
+	return o.writeEvent(c, "response.in_progress", map[string]interface{}{"response": o.response("in_progress")})
+}
+
+// openItem 关闭当前输出项并打开新的输出项
+func (o *responsesOutput) openItem(c echo.Context, item map[string]interface{}) error {
+	if err := o.closeItem(c, "completed"); err != nil {
+		return err
+	}
+	o.items = append(o.items, item)
+	o.current = len(o.items) - 1
+	return o.writeEvent(c, "response.output_item.added", map[string]interface{}{
+		"output_index": o.current,
+		"item":         item,
+	})
+}
+
+// closeItem 输出当前输出项的完成事件，status 为输出项的最终状态
+func (o *responsesOutput) closeItem(c echo.Context, status string) error {
+	if o.current < 0 {
+		return nil
+	}
+	index := o.current
+	item := o.items[index]
+	o.current = -1
+
+	switch item["type"] {
+	case "message":
+		text := o.text.String()
+		o.text.Reset()
+		if err := o.writeEvent(c, "response.output_text.done", map[string]interface{}{
+			"item_id":       item["id"],
+			"output_index":  index,
+			"content_index": 0,
+			"text":          text,
+		}); err != nil {
+			return err
+		}
+		if err := o.writeEvent(c, "response.content_part.done", map[string]interface{}{
+			"item_id":       item["id"],
+			"output_index":  index,
+			"content_index": 0,
+			"part":          outputTextPart(text),
+		}); err != nil {
+			return err
+		}
+		item["content"] = []interface{}{outputTextPart(text)}
+	case "function_call":
+		if err := o.writeEvent(c, "response.function_call_arguments.done", map[string]interface{}{
+			"item_id":      item["id"],
+			"output_index": index,
+			"arguments":    item["arguments"],
+		}); err != nil {
+			return err
+		}
+	}
+	item["status"] = status
+	return o.writeEvent(c, "response.output_item.done", map[string]interface{}{
+		"output_index": index,
+		"item":         item,
+	})
+}
+
+func (o *responsesOutput) writeStreamEvent(c echo.Context, event *sseEvent, chunk *ChatStreamChunk) error {
+	if o.finished {
+		return nil
+	}
+	if event.Data == sseDone {
+		return o.finish(c)
+	}
+	if chunk == nil {
+		return nil
+	}
+	if o.model == "" {
+		o.model = chunk.Model
+	}
+	if chunk.Error != nil {
+		return o.failStream(c, chunk.Error.Message)
+	}
+	if err := o.start(c); err != nil {
+		return err
+	}
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		o.usage = chunk.Usage
+	}
+
+	for _, choice := range chunk.Choices {
+		if choice.Delta.Content != "" {
+			if o.current < 0 || o.items[o.current]["type"] != "message" {
+				item := messageItem("in_progress", "")
+				if err := o.openItem(c, item); err != nil {
+					return err
+				}
+				if err := o.writeEvent(c, "response.content_part.added", map[string]interface{}{
+					"item_id":       item["id"],
+					"output_index":  o.current,
+					"content_index": 0,
+					"part":          outputTextPart(""),
+				}); err != nil {
+					return err
+				}
+			}
+			o.text.WriteString(choice.Delta.Content)
+			if err := o.writeEvent(c, "response.output_text.delta", map[string]interface{}{
+				"item_id":       o.items[o.current]["id"],
+				"output_index":  o.current,
+				"content_index": 0,
+				"delta":         choice.Delta.Content,
+			}); err != nil {
+				return err
+			}
+		}
+
+		for _, call := range choice.Delta.ToolCalls {
+			index := 0
+			if call.Index != nil {
+				index = *call.Index
+			}
+			// 带 ID 的数据块表示新的工具调用
+			if call.ID != "" {
+				arguments := call.Function.Arguments
+				call.Function.Arguments = ""
+				if err := o.openItem(c, functionCallItem("in_progress", call)); err != nil {
+					return err
+				}
+				o.toolItems[index] = o.current
+				call.Function.Arguments = arguments
+			}
+			itemIndex, ok := o.toolItems[index]
+			if !ok || call.Function.Arguments == "" {
+				continue
+			}
+			item := o.items[itemIndex]
+			item["arguments"] = item["arguments"].(string) + call.Function.Arguments
+			if err := o.writeEvent(c, "response.function_call_arguments.delta", map[string]interface{}{
+				"item_id":      item["id"],
+				"output_index": itemIndex,
+				"delta":        call.Function.Arguments,
+			}); err != nil {
+				return err
+			}
+		}
+
+		if choice.FinishReason != nil && *choice.FinishReason == "length" {
+			o.incomplete = true
+		}
+	}
+	return nil
+}
+
+func (o *responsesOutput) finishStream(c echo.Context) error {
+	return o.finish(c)
+}
+
+// failStream 输出 response.failed 结束流
+func (o *responsesOutput) failStream(c echo.Context, message string) error {
+	if o.finished {
+		return nil
+	}
+	if err := o.start(c); err != nil {
+		return err
+	}
+	o.finished = true
+	o.failure = message
+	// 未完成的输出项记为 incomplete
+	if err := o.closeItem(c, "incomplete"); err != nil {
+		return err
+	}
+	return o.writeEvent(c, "response.failed", map[string]interface{}{"response": o.response("failed")})
+}
+
+// finish 关闭输出项并输出 response.completed（或 response.incomplete）
+func (o *responsesOutput) finish(c echo.Context) error {
+	if o.finished {
+		return nil
+	}
+	if err := o.start(c); err != nil {
+		return err
+	}
+	o.finished = true
+	if err := o.closeItem(c, "completed"); err != nil {
+		return err
+	}
+	status := o.finalStatus()
+	event := "response.completed"
+	if status == "incomplete" {
+		event = "response.incomplete"
+	}
+	return o.writeEvent(c, event, map[string]interface{}{"response": o.response(status)})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResponsesOutputStreamErrorChunk(t *testing.T) {
+	errorChunk := `{"error":{"message":"upstream overloaded","type":"server_error"}}`
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "首个数据块即为错误",
+			chunks: []string{errorChunk, sseDone},
+			want:   []string{"response.created", "response.in_progress", "response.failed"},
+		},
+		{
+			name: "输出文本后出错",
+			chunks: []string{
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"Hi"}}]}`,
+				errorChunk,
+				`{"id":"chatcmpl-1","model":"gpt","choices":[{"index":0,"delta":{"content":"ignored"}}]}`,
+				sseDone,
+			},
+			want: []string{
+				"response.created", "response.in_progress",
+				"response.output_item.added", "response.content_part.added", "response.output_text.delta",
+				"response.output_text.done", "response.content_part.done", "response.output_item.done",
+				"response.failed",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext()
+			output := newResponsesOutput()
+			for _, data := range tt.chunks {
+				event := &sseEvent{Data: data}
+				if err := output.writeStreamEvent(c, event, decodeStreamChunk(event)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := output.finishStream(c); err != nil {
+				t.Fatal(err)
+			}
+
+			events := readSSE(t, rec.Body.String())
+			var names []string
+			for _, event := range events {
+				names = append(names, event.Event)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("events = %v, want %v", names, tt.want)
+			}
+			last := events[len(events)-1].Data
+			if !strings.Contains(last, "upstream overloaded") || !strings.Contains(last, `"status":"failed"`) {
+				t.Errorf("response.failed = %s", last)
+			}
+			if len(events) > 3 && !strings.Contains(events[len(events)-2].Data, `"status":"incomplete"`) {
+				t.Errorf("output_item.done = %s", events[len(events)-2].Data)
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"log"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sseDone OpenAI 流式响应的结束标记
+const sseDone = "[DONE]"
+
+// sseEvent 一个 SSE 事件
+type sseEvent struct {
+	Event string // event 字段，未设置时为空
+	Data  string // data 字段，多行 data 以换行连接
+}
+
+// sseReader SSE 解析器，逐个读取事件
+type sseReader struct {
+	reader *bufio.Reader
+}
+
+func newSSEReader(r io.Reader) *sseReader {
+	return &sseReader{reader: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// next 返回下一个事件，流结束时返回 io.EOF
+// 按 SSE 规范只在空行处结束一个事件，流结束时最后一个事件缺少结尾空行也照常返回
+func (r *sseReader) next() (*sseEvent, error) {
+	event := &sseEvent{}
+	hasData := false
+
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil && line == "" {
+			if err == io.EOF && hasData {
+				return event, nil
+			}
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			if hasData {
+				return event, nil
+			}
+			event.Event = ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// 注释行（常用作心跳）
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			if hasData {
+				event.Data += "\n" + value
+			} else {
+				event.Data = value
+			}
+			hasData = true
+		}
+	}
+}
+
+// writeSSEEvent 写出一个 SSE 事件并立即发送
+func writeSSEEvent(c echo.Context, event *sseEvent) error {
+	var b strings.Builder
+	if event.Event != "" {
+		b.WriteString("event: " + event.Event + "\n")
+	}
+	for _, line := range strings.Split(event.Data, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(c.Response().Writer, b.String()); err != nil {
+		return err
+	}
+	c.Response().Flush() // 强制立即发送
+	return nil
+}
+
+// decodeStreamChunk 解码 OpenAI 格式的数据块，[DONE] 或无法解码时返回 nil
+func decodeStreamChunk(event *sseEvent) *ChatStreamChunk {
+	if event.Data == sseDone {
+		return nil
+	}
+	var chunk ChatStreamChunk
+	if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+		return nil
+	}
+	return &chunk
+}
+
+// streamAccumulator 累计流式响应，得到完整的 assistant 消息、结束原因和最终 usage
+type streamAccumulator struct {
+	content      strings.Builder
+	toolCalls    []openAIToolCall
+	toolIndex    map[int]int // 数据块中的工具调用序号 -> toolCalls 下标
+	finishReason string
+	usage        *Usage
+}
+
+// add 累计一个数据块
+func (a *streamAccumulator) add(chunk *ChatStreamChunk) {
+	// 最后一个数据块通常携带完整 usage
+	if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+		a.usage = chunk.Usage
+	}
+	for _, choice := range chunk.Choices {
+		a.content.WriteString(choice.Delta.Content)
+		a.content.WriteString(choice.Text)
+		for _, call := range choice.Delta.ToolCalls {
+			a.addToolCall(call)
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			a.finishReason = *choice.FinishReason
+		}
+	}
+}
+
+// addToolCall 按序号合并工具调用的增量，带 ID 的增量表示新的工具调用
+func (a *streamAccumulator) addToolCall(call openAIToolCall) {
+	index := 0
+	if call.Index != nil {
+		index = *call.Index
+	}
+	if a.toolIndex == nil {
+		a.toolIndex = make(map[int]int)
+	}
+	i, ok := a.toolIndex[index]
+	if !ok || call.ID != "" {
+		a.toolCalls = append(a.toolCalls, openAIToolCall{ID: call.ID, Type: "function"})
+		i = len(a.toolCalls) - 1
+		a.toolIndex[index] = i
+	}
+	a.toolCalls[i].Function.Name += call.Function.Name
+	a.toolCalls[i].Function.Arguments += call.Function.Arguments
+}
+
+// text 回复的全部文本（内容、工具名和参数），用于估算 completion tokens
+func (a *streamAccumulator) text() string {
+	var b strings.Builder
+	b.WriteString(a.content.String())
+	for _, call := range a.toolCalls {
+		b.WriteString(call.Function.Name)
+		b.WriteString(call.Function.Arguments)
+	}
+	return b.String()
+}
+
+// streamResult 转发流式响应的结束方式
+type streamResult int
+
+const (
+	streamCompleted      streamResult = iota // 厂商流正常结束
+	streamIntercepted                        // intercept 要求停止转发，由调用方接管
+	streamUpstreamFailed                     // 读取厂商响应出错
+	streamClientGone                         // 客户端断开连接
+)
+
+// relayStream 逐个解析厂商的 SSE 事件，累计到 tracker 后经 output 转发给客户端
+// intercept 不为 nil 时在转发每个事件前调用，返回 true 则停止转发
+func (h *Handler) relayStream(c echo.Context, body io.Reader, tracker *usageTracker, output chatOutput, intercept func(event *sseEvent) bool) streamResult {
+	reader := newSSEReader(body)
+	for {
+		event, err := reader.next()
+		if err != nil {
+			if c.Request().Context().Err() != nil {
+				// 客户端断开后上游请求随之取消
+				clientCancelled(c, tracker)
+				return streamClientGone
+			}
+			if err != io.EOF {
+				// 状态码已经发出，只能以协议对应的错误事件结束流；已转发的内容照常计入用量
+				log.Printf("[WARN] 读取厂商流式响应失败: %v", err)
+				tracker.failed = true
+				output.failStream(c, "Upstream provider stream was interrupted before completion")
+				return streamUpstreamFailed
+			}
+			break
+		}
+		if intercept != nil && intercept(event) {
+			return streamIntercepted
+		}
+
+		chunk := decodeStreamChunk(event)
+		if chunk != nil {
+			tracker.observeStreamChunk(chunk)
+			// 数据块中的上游模型ID改写回客户端请求的别名
+			event.Data = string(rewriteModelField([]byte(event.Data), tracker.record.ModelName))
+			chunk.Model = tracker.record.ModelName
+		}
+		if err := output.writeStreamEvent(c, event, chunk); err != nil {
+			clientCancelled(c, tracker)
+			return streamClientGone
+		}
+	}
+
+	if h.cfg.Debug {
+		log.Printf("[DEBUG] 流式回复 (finish_reason: %s, tool_calls: %d): %s",
+			tracker.stream.finishReason, len(tracker.stream.toolCalls), tracker.stream.content.String())
+	}
+	return streamCompleted
+}
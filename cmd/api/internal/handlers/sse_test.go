@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/model-system/api/internal/config"
+	"github.com/model-system/api/internal/models"
+)
+
+func TestSSEReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []sseEvent
+	}{
+		{"标准事件", "data: {\"a\":1}\n\ndata: [DONE]\n\n", []sseEvent{{Data: `{"a":1}`}, {Data: "[DONE]"}}},
+		{"事件名", "event: message_start\ndata: {}\n\n", []sseEvent{{Event: "message_start", Data: "{}"}}},
+		{"CRLF 和注释行", ": ping\r\ndata: {}\r\n\r\n", []sseEvent{{Data: "{}"}}},
+		{"多行 data", "data: a\ndata: b\n\n", []sseEvent{{Data: "a\nb"}}},
+		{"首行是完整 JSON 的多行 data", "data: {\"a\":1}\ndata: {\"a\":2}\n\ndata: 1\ndata: 2\n\n", []sseEvent{{Data: "{\"a\":1}\n{\"a\":2}"}, {Data: "1\n2"}}},
+		{"只在空行处结束事件", "event: a\ndata: {}\nevent: b\ndata: {}\n\n", []sseEvent{{Event: "b", Data: "{}\n{}"}}},
+		{"没有 data 的事件被忽略", "event: ping\n\ndata: {}\n\n", []sseEvent{{Data: "{}"}}},
+		{"结尾没有换行", "data: {}", []sseEvent{{Data: "{}"}}},
+		{"空输入", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := readSSE(t, tt.input)
+			if len(events) != len(tt.want) {
+				t.Fatalf("got %d events %+v, want %d", len(events), events, len(tt.want))
+			}
+			for i, event := range events {
+				if *event != tt.want[i] {
+					t.Errorf("event %d = %+v, want %+v", i, *event, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRelayStreamUpstreamFailure(t *testing.T) {
+	tests := []struct {
+		name      string
+		output    chatOutput
+		lastEvent string
+		lastData  string
+	}{
+		{"OpenAI", openAIOutput{}, "", `"type":"upstream_error"`},
+		{"Anthropic", &anthropicOutput{}, "error", `"type":"api_error"`},
+		{"Responses", newResponsesOutput(), "response.failed", `"status":"failed"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newTestContext()
+			h := &Handler{cfg: &config.Config{}}
+			tracker := &usageTracker{start: time.Now(), record: models.UsageRecord{ModelName: "alias"}}
+			body := io.MultiReader(
+				strings.NewReader("data: {\"id\":\"1\",\"model\":\"gpt\",\"choices\":[{\"index\":0,\"delta\":{\"content\":\"Hello world\"}}]}\n\n"),
+				iotest.ErrReader(errors.New("connection reset")),
+			)
+
+			if result := h.relayStream(c, body, tracker, tt.output, nil); result != streamUpstreamFailed {
+				t.Fatalf("result = %v, want streamUpstreamFailed", result)
+			}
+			events := readSSE(t, rec.Body.String())
+			last := events[len(events)-1]
+			if last.Event != tt.lastEvent || !strings.Contains(last.Data, tt.lastData) {
+				t.Errorf("last event = %+v", last)
+			}
+
+			record := tracker.finish(http.StatusOK)
+			if record.Outcome != models.UsageOutcomeFailed {
+				t.Errorf("outcome = %s, want failed", record.Outcome)
+			}
+			if record.CompletionTokens == 0 {
+				t.Error("已转发的内容未计入用量")
+			}
+		})
+	}
+}
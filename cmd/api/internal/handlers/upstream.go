@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/models"
+)
+
+// upstreamTarget 上游请求目标（厂商 + 厂商内部模型ID）
+type upstreamTarget struct {
+	Index        int // 0为主目标，1起为备用目标
+	ProviderID   uint64
+	ProviderName string
+	ProviderType string // 接口协议类型，决定使用的适配器
+	APIVersion   string // Azure OpenAI 的 api-version
+	BaseURL      string
+	APIKey       string // 本次请求使用的密钥
+	KeyID        uint64 // 密钥池中的密钥ID，0表示使用厂商默认密钥
+	DefaultKey   string // 厂商默认密钥（providers.api_key）
+	ModelID      string
+	Policy       models.ProviderPolicy // 厂商的超时和重试配置
+}
+
+// upstreamTargets 返回模型的主目标和备用目标（按尝试顺序）
+func upstreamTargets(item *cache.ModelCacheItem) []upstreamTarget {
+	targets := make([]upstreamTarget, 0, len(item.Fallbacks)+1)
+	targets = append(targets, upstreamTarget{
+		Index:        0,
+		ProviderID:   item.Model.ProviderID,
+		ProviderName: item.ProviderName,
+		ProviderType: item.ProviderType,
+		APIVersion:   item.ProviderAPIVersion,
+		BaseURL:      item.ProviderBaseURL,
+		DefaultKey:   item.ProviderKey,
+		ModelID:      item.Model.ModelID,
+		Policy:       cache.GetCache().GetProviderPolicy(item.Model.ProviderID),
+	})
+	for i, fallback := range item.Fallbacks {
+		targets = append(targets, upstreamTarget{
+			Index:        i + 1,
+			ProviderID:   fallback.ProviderID,
+			ProviderName: fallback.ProviderName,
+			ProviderType: fallback.ProviderType,
+			APIVersion:   fallback.ProviderAPIVersion,
+			BaseURL:      fallback.ProviderBaseURL,
+			DefaultKey:   fallback.ProviderKey,
+			ModelID:      fallback.TargetModelID,
+			Policy:       cache.GetCache().GetProviderPolicy(fallback.ProviderID),
+		})
+	}
+	return targets
+}
+
+// providerTarget 返回直接请求厂商的目标（不经过模型），用于连接测试和健康探测
+// 和代理请求一样从密钥池中选择密钥，厂商默认密钥可以为空
+func providerTarget(provider *models.Provider) *upstreamTarget {
+	target := &upstreamTarget{
+		ProviderID:   provider.ID,
+		ProviderName: provider.Name,
+		ProviderType: provider.Type,
+		APIVersion:   provider.APIVersion,
+		BaseURL:      provider.BaseURL,
+		DefaultKey:   provider.APIKey,
+		Policy:       provider.ProviderPolicy.Parsed(),
+	}
+	selectProviderKey(target)
+	return target
+}
+
+// isFallbackStatus 判断厂商状态码是否需要切换到下一个目标
+func isFallbackStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// isKeyRejectedStatus 判断厂商状态码是否表示当前密钥不可用（无效或被限流）
+func isKeyRejectedStatus(status int) bool {
+	return status == http.StatusUnauthorized || status == http.StatusTooManyRequests
+}
+
+// parseRetryAfter 解析 Retry-After 响应头（秒数），无法解析时返回 0
+func parseRetryAfter(header http.Header) time.Duration {
+	seconds, err := strconv.Atoi(header.Get("Retry-After"))
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// selectProviderKey 从厂商密钥池中按权重选择密钥，密钥池为空或全部冷却时使用厂商默认密钥
+func selectProviderKey(target *upstreamTarget) {
+	if keyID, apiKey, ok := cache.GetCache().NextProviderKey(target.ProviderID); ok {
+		target.KeyID = keyID
+		target.APIKey = apiKey
+		return
+	}
+	target.KeyID = 0
+	target.APIKey = target.DefaultKey
+}
+
+// upstreamFunc 向单个目标发送一次请求
+type upstreamFunc func(target *upstreamTarget) (*http.Response, error)
+
+// sendUpstream 依次尝试各目标发送聊天补全请求，ctx 取消（客户端断开）时中止上游请求
+func (h *Handler) sendUpstream(ctx context.Context, req ChatCompletionRequest, targets []upstreamTarget) (*http.Response, *upstreamTarget, error) {
+	return h.sendWithFallback(ctx, targets, func(target *upstreamTarget) (*http.Response, error) {
+		return h.doUpstreamRequest(ctx, req, target)
+	})
+}
+
+// sendWithFallback 依次尝试各目标发送请求
+// 连接错误、429 和 5xx 时切换到下一个目标，此时尚未向客户端写入任何数据；
+// 返回第一个可用的响应，或最后一个目标的失败响应；全部连接失败时返回最后一次错误，ctx 取消后不再尝试后续目标
+// 重试和切换共用 proxy.retry_budget 总时长，超出后返回当前目标的结果
+func (h *Handler) sendWithFallback(ctx context.Context, targets []upstreamTarget, do upstreamFunc) (*http.Response, *upstreamTarget, error) {
+	// 跳过已熔断的厂商，全部熔断时直接返回，不再等待连接超时
+	targets = availableTargets(targets)
+	if len(targets) == 0 {
+		return nil, nil, errProviderCircuitOpen
+	}
+
+	deadline := time.Now().Add(h.cfg.Proxy.RetryBudgetDuration())
+	var lastErr error
+	for i := range targets {
+		target := &targets[i]
+		isLast := i == len(targets)-1
+		if i > 0 && time.Now().After(deadline) {
+			log.Printf("[WARN] 超出重试总时长 %s，不再切换到下一个目标 (provider: %s, model: %s)",
+				h.cfg.Proxy.RetryBudgetDuration(), target.ProviderName, target.ModelID)
+			break
+		}
+
+		// 熔断时间已到的厂商只放行一个试探请求，已被其他请求占用时跳过
+		if !cache.GetCache().AcquireProvider(target.ProviderID) {
+			log.Printf("[WARN] 厂商探测中，跳过该目标 (provider: %s, model: %s)", target.ProviderName, target.ModelID)
+			lastErr = errProviderCircuitOpen
+			continue
+		}
+
+		resp, err := h.sendWithRetry(ctx, target, deadline, do)
+		if err != nil && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			log.Printf("[WARN] 请求厂商失败 (provider: %s, model: %s): %v", target.ProviderName, target.ModelID, err)
+			lastErr = err
+			continue
+		}
+
+		if isFallbackStatus(resp.StatusCode) && !isLast && time.Now().Before(deadline) {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			log.Printf("[WARN] 厂商返回错误 (provider: %s, model: %s, status: %d)，切换到下一个目标: %s",
+				target.ProviderName, target.ModelID, resp.StatusCode, string(respBody))
+			continue
+		}
+
+		return resp, target, nil
+	}
+
+	return nil, nil, lastErr
+}
+
+// sendWithRetry 向单个目标发送请求，按厂商配置重试建立连接失败和可重试的状态码
+// 重试前按指数退避等待，厂商返回 Retry-After 时取两者中较大的值（不超过 MaxRetryDelay）；等待后将超过 deadline 时不再重试
+func (h *Handler) sendWithRetry(ctx context.Context, target *upstreamTarget, deadline time.Time, do upstreamFunc) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := h.sendToTarget(target, do)
+		if ctx.Err() != nil || attempt >= target.Policy.MaxRetries {
+			return resp, err
+		}
+		if err != nil && !isRetryableError(err) {
+			return resp, err
+		}
+		if err == nil && !target.Policy.IsRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		delay := target.Policy.RetryDelay(attempt)
+		if err == nil {
+			if retryAfter := parseRetryAfter(resp.Header); retryAfter > delay {
+				delay = min(retryAfter, models.MaxRetryDelay)
+			}
+		}
+		if time.Now().Add(delay).After(deadline) {
+			log.Printf("[WARN] 超出重试总时长，不再重试 (provider: %s, model: %s)", target.ProviderName, target.ModelID)
+			return resp, err
+		}
+
+		if err != nil {
+			log.Printf("[WARN] 请求厂商失败 (provider: %s, model: %s): %v，%s 后第 %d 次重试",
+				target.ProviderName, target.ModelID, err, delay.Round(time.Millisecond), attempt+1)
+		} else {
+			respBody, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			log.Printf("[WARN] 厂商返回错误 (provider: %s, model: %s, status: %d)，%s 后第 %d 次重试: %s",
+				target.ProviderName, target.ModelID, resp.StatusCode, delay.Round(time.Millisecond), attempt+1, string(respBody))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// isRetryableError 判断请求错误是否可以重试：只重试建立连接失败（拨号失败或超时、TLS 握手失败），此时请求尚未发给厂商
+// 请求发出后的超时和连接中断可能已被厂商处理，重试会重复生成和计费；证书校验失败和构建请求失败重试也不会成功
+func isRetryableError(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return true
+	}
+	var alertErr tls.AlertError
+	var recordErr tls.RecordHeaderError
+	return errors.As(err, &alertErr) || errors.As(err, &recordErr)
+}
+
+// isNetworkError 判断请求错误是否发生在请求厂商的过程中（网络和 TLS 错误、厂商响应超时），构建请求失败等不算
+// http.Client 返回的 *url.Error 和 upstreamTimeoutError 都实现了 net.Error
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// sendToTarget 向单个目标发送请求，密钥被拒绝（401/429）时暂停该密钥并换用同厂商的其他密钥重试
+func (h *Handler) sendToTarget(target *upstreamTarget, do upstreamFunc) (*http.Response, error) {
+	for {
+		selectProviderKey(target)
+
+		resp, err := do(target)
+		reportUpstreamResult(target, resp, err)
+		if err != nil || target.KeyID == 0 || !isKeyRejectedStatus(resp.StatusCode) {
+			return resp, err
+		}
+
+		until := cache.GetCache().CooldownProviderKey(target.ProviderID, target.KeyID, parseRetryAfter(resp.Header))
+		if cache.GetCache().GetAvailableProviderKeyCount(target.ProviderID) == 0 {
+			return resp, nil
+		}
+
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		log.Printf("[WARN] 厂商密钥被拒绝 (provider: %s, key_id: %d, status: %d)，暂停使用至 %s，换用其他密钥: %s",
+			target.ProviderName, target.KeyID, resp.StatusCode, until.Format("15:04:05"), string(respBody))
+	}
+}
+
+// doUpstreamRequest 向单个目标发送聊天补全请求，按厂商接口协议转换请求，成功响应转换回 OpenAI 格式
+func (h *Handler) doUpstreamRequest(ctx context.Context, req ChatCompletionRequest, target *upstreamTarget) (*http.Response, error) {
+	// 更新 model 字段为厂商实际的模型ID
+	req.Model = target.ModelID
+
+	adapter := adapterFor(target.ProviderType)
+	endpoint, providerReqBody, err := adapter.buildRequest(req, target)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	if h.cfg.Debug {
+		if err := writeDynamicFile("providerReqBody.json", providerReqBody); err != nil {
+			log.Printf("[WARN] 写入调试文件失败: %v", err)
+		} else {
+			log.Printf("[DEBUG] 序列化请求体: providerReqBody.json")
+		}
+	}
+
+	providerReq, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(providerReqBody))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	// 设置请求头
+	providerReq.Header.Set("Content-Type", "application/json")
+	adapter.setHeaders(providerReq.Header, target)
+
+	resp, err := sendHTTP(providerReq, target.Policy)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		// 错误响应原样返回，由 upstreamError 统一转换
+		return resp, err
+	}
+	return adapter.convertResponse(resp, req.Stream)
+}
+
+// doModelsRequest 请求厂商的模型列表接口
+func (h *Handler) doModelsRequest(ctx context.Context, target *upstreamTarget) (*http.Response, error) {
+	adapter := adapterFor(target.ProviderType)
+	providerReq, err := http.NewRequestWithContext(ctx, "GET", adapter.modelsURL(target), nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	adapter.setHeaders(providerReq.Header, target)
+	return sendHTTP(providerReq, target.Policy)
+}
+
+// endpointTargets 返回支持透传接口的目标（OpenAI 兼容和 Azure 厂商），其余厂商类型的目标被跳过
+func endpointTargets(targets []upstreamTarget) []upstreamTarget {
+	supported := make([]upstreamTarget, 0, len(targets))
+	for _, target := range targets {
+		if _, ok := adapterFor(target.ProviderType).(endpointAdapter); ok {
+			supported = append(supported, target)
+		}
+	}
+	return supported
+}
+
+// doEndpointRequest 向单个目标发送聊天补全以外的 OpenAI 接口请求（如 /embeddings）
+// 请求体的 model 替换为厂商实际的模型ID，其余字段和响应均原样透传
+func (h *Handler) doEndpointRequest(ctx context.Context, path string, body endpointBody, target *upstreamTarget) (*http.Response, error) {
+	adapter, ok := adapterFor(target.ProviderType).(endpointAdapter)
+	if !ok {
+		return nil, fmt.Errorf("厂商接口协议 %s 不支持 %s", target.ProviderType, path)
+	}
+
+	providerReqBody, contentType, err := body.build(target.ModelID)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %w", err)
+	}
+
+	providerReq, err := http.NewRequestWithContext(ctx, "POST", adapter.endpointURL(path, target), providerReqBody)
+	if err != nil {
+		// 请求体未交给 HTTP 客户端，需自行关闭
+		providerReqBody.Close()
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	providerReq.Header.Set("Content-Type", contentType)
+	adapter.setHeaders(providerReq.Header, target)
+
+	return sendHTTP(providerReq, target.Policy)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/config"
+	"github.com/model-system/api/internal/models"
+)
+
+// requestError 模拟 http.Client 返回的错误
+func requestError(err error) error {
+	return &url.Error{Op: "Post", URL: "https://upstream/v1/chat/completions", Err: err}
+}
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		retryable bool
+		network   bool // 是否为请求厂商时的错误
+	}{
+		{"连接被拒绝", requestError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}), true, true},
+		{"连接超时", requestError(&net.OpError{Op: "dial", Net: "tcp", Err: context.DeadlineExceeded}), true, true},
+		{"TLS 握手告警", requestError(tls.AlertError(40)), true, true},
+		{"非 TLS 响应", requestError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), true, true},
+		{"证书校验失败", requestError(&tls.CertificateVerificationError{Err: errors.New("x509: unknown authority")}), false, true},
+		{"请求发出后连接中断", requestError(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}), false, true},
+		{"首字节超时", &upstreamTimeoutError{phase: "等待厂商响应头", timeout: time.Second}, false, true},
+		{"客户端断开", requestError(context.Canceled), false, true},
+		{"构建请求失败", errors.New("序列化请求失败"), false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableError(tt.err); got != tt.retryable {
+				t.Errorf("isRetryableError = %v, want %v", got, tt.retryable)
+			}
+			if got := isNetworkError(tt.err); got != tt.network {
+				t.Errorf("isNetworkError = %v, want %v", got, tt.network)
+			}
+		})
+	}
+}
+
+// fakeResponse 构造厂商响应
+func fakeResponse(status int) *http.Response {
+	return &http.Response{StatusCode: status, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("{}"))}
+}
+
+func TestSendWithFallbackRetryBudget(t *testing.T) {
+	reset := requestError(&net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET})
+	refused := requestError(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	tests := []struct {
+		name       string
+		budget     int // proxy.retry_budget，单位秒
+		policy     models.ProviderPolicy
+		targets    int
+		do         func(calls int) (*http.Response, error) // calls 为该目标的第几次请求，从 1 开始
+		wantCalls  []int                                   // 各目标的请求次数
+		wantStatus int                                     // 0 表示期望返回错误
+	}{
+		{
+			name:    "预算内按状态码重试",
+			policy:  models.ProviderPolicy{MaxRetries: 2, RetryBackoffMs: 1},
+			targets: 1,
+			do: func(calls int) (*http.Response, error) {
+				if calls == 1 {
+					return fakeResponse(http.StatusServiceUnavailable), nil
+				}
+				return fakeResponse(http.StatusOK), nil
+			},
+			wantCalls:  []int{2},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:    "建立连接失败重试",
+			policy:  models.ProviderPolicy{MaxRetries: 2, RetryBackoffMs: 1},
+			targets: 2,
+			do: func(calls int) (*http.Response, error) {
+				return nil, refused
+			},
+			wantCalls: []int{3, 3},
+		},
+		{
+			name:    "请求发出后的错误不重试但切换目标",
+			policy:  models.ProviderPolicy{MaxRetries: 3, RetryBackoffMs: 1},
+			targets: 2,
+			do: func(calls int) (*http.Response, error) {
+				return nil, reset
+			},
+			wantCalls: []int{1, 1},
+		},
+		{
+			name:    "重试等待超出总时长",
+			budget:  1,
+			policy:  models.ProviderPolicy{MaxRetries: 3, RetryBackoffMs: 5000},
+			targets: 1,
+			do: func(calls int) (*http.Response, error) {
+				return fakeResponse(http.StatusServiceUnavailable), nil
+			},
+			wantCalls:  []int{1},
+			wantStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "超出总时长不再切换目标",
+			budget:  1,
+			policy:  models.ProviderPolicy{MaxRetries: 3, RetryBackoffMs: 1},
+			targets: 2,
+			do: func(calls int) (*http.Response, error) {
+				time.Sleep(1100 * time.Millisecond)
+				return nil, reset
+			},
+			wantCalls: []int{1, 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache.InitCache()
+			h := &Handler{cfg: &config.Config{Proxy: config.ProxyConfig{RetryBudget: tt.budget}}}
+			targets := make([]upstreamTarget, tt.targets)
+			for i := range targets {
+				targets[i] = upstreamTarget{Index: i, ProviderID: uint64(i + 1), ProviderName: "p", Policy: tt.policy}
+			}
+
+			calls := make([]int, tt.targets)
+			resp, _, err := h.sendWithFallback(context.Background(), targets, func(target *upstreamTarget) (*http.Response, error) {
+				calls[target.Index]++
+				return tt.do(calls[target.Index])
+			})
+
+			for i := range calls {
+				if calls[i] != tt.wantCalls[i] {
+					t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+					break
+				}
+			}
+			switch {
+			case tt.wantStatus == 0 && err == nil:
+				t.Errorf("status = %d, want error", resp.StatusCode)
+			case tt.wantStatus != 0 && (err != nil || resp.StatusCode != tt.wantStatus):
+				t.Errorf("resp = %v, err = %v, want status %d", resp, err, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// dialTimeoutKey 请求 context 中保存建立连接超时的键
+type dialTimeoutKey struct{}
+
+// dialContext 按请求 context 中的厂商配置设置建立连接超时，全局连接池由所有厂商共用
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	timeout, _ := ctx.Value(dialTimeoutKey{}).(time.Duration)
+	if timeout <= 0 {
+		timeout = models.DefaultConnectTimeout
+	}
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	return dialer.DialContext(ctx, network, addr)
+}
+
+// upstreamTimeoutError 厂商响应超时，实现 net.Error 以便按网络错误重试
+type upstreamTimeoutError struct {
+	phase   string
+	timeout time.Duration
+}
+
+func (e *upstreamTimeoutError) Error() string {
+	return fmt.Sprintf("%s超时 (%s)", e.phase, e.timeout)
+}
+
+func (e *upstreamTimeoutError) Timeout() bool   { return true }
+func (e *upstreamTimeoutError) Temporary() bool { return true }
+
+// responseDeadline 厂商请求的计时器，超时后取消请求 context
+type responseDeadline struct {
+	mu     sync.Mutex
+	timer  *time.Timer
+	cancel context.CancelFunc
+	err    *upstreamTimeoutError // 已触发的超时
+}
+
+// arm 开始计时，timeout 为 0 时不计时
+func (d *responseDeadline) arm(phase string, timeout time.Duration) {
+	if timeout <= 0 {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(timeout, func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if d.timer != timer {
+			// 已停止计时或开始了新的计时
+			return
+		}
+		d.err = &upstreamTimeoutError{phase: phase, timeout: timeout}
+		d.cancel()
+	})
+	d.timer = timer
+}
+
+// disarm 停止计时，返回已触发的超时
+func (d *responseDeadline) disarm() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	if d.err != nil {
+		return d.err
+	}
+	return nil
+}
+
+// deadlineBody 读取响应体时按空闲超时计时，关闭时释放请求 context
+type deadlineBody struct {
+	io.ReadCloser
+	deadline *responseDeadline
+	idle     time.Duration
+}
+
+func (b *deadlineBody) Read(p []byte) (int, error) {
+	b.deadline.arm("等待厂商响应数据", b.idle)
+	n, err := b.ReadCloser.Read(p)
+	if timeoutErr := b.deadline.disarm(); timeoutErr != nil && err != nil {
+		err = timeoutErr
+	}
+	return n, err
+}
+
+func (b *deadlineBody) Close() error {
+	b.deadline.disarm()
+	err := b.ReadCloser.Close()
+	b.deadline.cancel()
+	return err
+}
+
+// sendHTTP 按厂商的超时配置发送请求
+// 首字节超时覆盖从发出请求到收到响应头，空闲超时覆盖读取响应体时两次数据之间的间隔（主要用于流式响应）
+func sendHTTP(req *http.Request, policy models.ProviderPolicy) (*http.Response, error) {
+	ctx := context.WithValue(req.Context(), dialTimeoutKey{}, policy.ConnectTimeoutDuration())
+	ctx, cancel := context.WithCancel(ctx)
+	deadline := &responseDeadline{cancel: cancel}
+
+	deadline.arm("等待厂商响应头", policy.FirstByteTimeoutDuration())
+	resp, err := globalHTTPClient.Do(req.WithContext(ctx))
+	timeoutErr := deadline.disarm()
+	if err != nil {
+		cancel()
+		if timeoutErr != nil {
+			return nil, timeoutErr
+		}
+		return nil, err
+	}
+	if timeoutErr != nil {
+		// 收到响应头的同时触发了超时，请求 context 已取消
+		resp.Body.Close()
+		return nil, timeoutErr
+	}
+
+	resp.Body = &deadlineBody{ReadCloser: resp.Body, deadline: deadline, idle: policy.StreamIdleTimeoutDuration()}
+	return resp, nil
+}
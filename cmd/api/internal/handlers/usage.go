@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/middleware"
+	"github.com/model-system/api/internal/models"
+)
+
+// usageTracker 单次代理请求的用量统计
+// 优先使用厂商返回的 usage，缺失时用 tokenizer 估算
+type usageTracker struct {
+	record  models.UsageRecord
+	start   time.Time
+	usage   *Usage                 // 厂商返回的 usage
+	content strings.Builder        // 非流式响应的回复内容，用于估算 completion tokens
+	stream  streamAccumulator      // 流式响应累计的完整回复
+	limit   *cache.APIKeyLimit     // API密钥限额，请求结束后扣除实际消耗的 token
+	quota   cache.QuotaReservation // 预占的用量配额，请求结束后按实际用量结算
+	pricing models.ModelPricing
+
+	responded bool // 已收到厂商响应
+	cancelled bool // 客户端在响应完成前断开
+	failed    bool // 厂商流在结束前中断
+}
+
+// statusClientClosedRequest 客户端在收到响应前断开时记录的状态码（沿用 nginx 的约定）
+const statusClientClosedRequest = 499
+
+// newUsageTracker 创建用量统计，start 为请求开始时间
+func newUsageTracker(start time.Time, userID, apiKeyID uint64, modelName string, modelItem *cache.ModelCacheItem, stream bool) *usageTracker {
+	return &usageTracker{
+		start:   start,
+		pricing: modelItem.Model.ModelPricing,
+		record: models.UsageRecord{
+			UserID:        userID,
+			APIKeyID:      apiKeyID,
+			ModelID:       modelItem.Model.ID,
+			ModelName:     modelName,
+			UpstreamModel: modelItem.Model.ModelID,
+			ProviderID:    modelItem.Model.ProviderID,
+			IsStream:      stream,
+		},
+	}
+}
+
+// setTokens 设置请求侧的 token 数
+// original 为压缩前的消息 token 数，compressed 为压缩后的消息 token 数，prompt 为最终发送给厂商的消息 token 数
+func (t *usageTracker) setTokens(original, compressed, prompt int) {
+	t.record.OriginalTokens = original
+	t.record.CompressedTokens = compressed
+	if original > compressed {
+		t.record.SavedTokens = original - compressed
+	}
+	t.record.PromptTokens = prompt
+}
+
+// setTarget 记录实际服务的上游目标
+func (t *usageTracker) setTarget(target *upstreamTarget) {
+	t.record.ProviderID = target.ProviderID
+	t.record.UpstreamModel = target.ModelID
+	t.record.FallbackIndex = target.Index
+	t.responded = true
+}
+
+// clientCancelled 客户端已断开，停止转发并将本次请求记为 client_cancelled
+// 尚未写出响应时状态码记为 499；已转发的内容和厂商已处理的 prompt 照常计入用量
+func clientCancelled(c echo.Context, tracker *usageTracker) error {
+	tracker.cancelled = true
+	if !c.Response().Committed {
+		c.Response().Status = statusClientClosedRequest
+	}
+	log.Printf("[INFO] 客户端已断开，停止读取厂商响应 (model: %s, api_key_id: %d)", tracker.record.ModelName, tracker.record.APIKeyID)
+	return nil
+}
+
+// observeResponse 从非流式响应体中提取 usage 和回复内容
+func (t *usageTracker) observeResponse(body []byte) {
+	var resp struct {
+		Choices []struct {
+			Message struct {
+				Content   json.RawMessage `json:"content"`
+				ToolCalls json.RawMessage `json:"tool_calls"`
+			} `json:"message"`
+			Text string `json:"text"` // 旧版文本补全
+		} `json:"choices"`
+		Usage *Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return
+	}
+
+	if resp.Usage != nil && resp.Usage.PromptTokens == 0 && resp.Usage.CompletionTokens == 0 {
+		// 图片和音频接口的 usage 使用 input_tokens/output_tokens
+		var media struct {
+			Usage struct {
+				InputTokens  int `json:"input_tokens"`
+				OutputTokens int `json:"output_tokens"`
+			} `json:"usage"`
+		}
+		if err := json.Unmarshal(body, &media); err == nil {
+			resp.Usage.PromptTokens = media.Usage.InputTokens
+			resp.Usage.CompletionTokens = media.Usage.OutputTokens
+		}
+	}
+	if resp.Usage != nil && resp.Usage.TotalTokens > 0 {
+		t.usage = resp.Usage
+	}
+	for _, choice := range resp.Choices {
+		t.content.WriteString(choice.Text)
+		var text string
+		if err := json.Unmarshal(choice.Message.Content, &text); err == nil {
+			t.content.WriteString(text)
+		} else if len(choice.Message.Content) > 0 && string(choice.Message.Content) != "null" {
+			t.content.Write(choice.Message.Content)
+		}
+		if len(choice.Message.ToolCalls) > 0 && string(choice.Message.ToolCalls) != "null" {
+			t.content.Write(choice.Message.ToolCalls)
+		}
+	}
+}
+
+// observeStreamChunk 累计流式数据块中的回复内容和 usage
+func (t *usageTracker) observeStreamChunk(chunk *ChatStreamChunk) {
+	t.stream.add(chunk)
+	if t.stream.usage != nil {
+		t.usage = t.stream.usage
+	}
+}
+
+// finish 根据最终状态码生成用量记录
+func (t *usageTracker) finish(statusCode int) *models.UsageRecord {
+	record := t.record
+	record.StatusCode = statusCode
+	record.LatencyMs = time.Since(t.start).Milliseconds()
+
+	switch {
+	case t.usage != nil:
+		record.PromptTokens = t.usage.PromptTokens
+		record.CompletionTokens = t.usage.CompletionTokens
+		record.TotalTokens = t.usage.TotalTokens
+		if t.usage.PromptTokensDetails != nil {
+			record.CachedTokens = t.usage.PromptTokensDetails.CachedTokens
+		}
+	case statusCode == http.StatusOK, t.cancelled && t.responded:
+		// 厂商未返回 usage（或客户端提前断开未收到最终 usage），使用 tokenizer 估算
+		record.CompletionTokens = countTextTokens(t.content.String() + t.stream.text())
+		record.TotalTokens = record.PromptTokens + record.CompletionTokens
+		record.UsageEstimated = true
+	default:
+		// 请求失败，不计 token
+		record.PromptTokens = 0
+	}
+
+	// 按模型单价计费，备用目标沿用主模型的单价
+	record.Cost = t.pricing.Cost(record.PromptTokens, record.CachedTokens, record.CompletionTokens)
+	if statusCode == http.StatusOK {
+		record.SavedCost = t.pricing.Cost(record.SavedTokens, 0, 0)
+	}
+
+	switch {
+	case t.cancelled:
+		record.Outcome = models.UsageOutcomeClientCancelled
+	case t.failed:
+		record.Outcome = models.UsageOutcomeFailed
+	case statusCode == http.StatusOK:
+		record.Outcome = models.UsageOutcomeCompleted
+	default:
+		record.Outcome = models.UsageOutcomeFailed
+	}
+
+	return &record
+}
+
+// recordUsage 写入本次请求的用量记录，并扣除API密钥的每分钟token限额和用量配额
+func (h *Handler) recordUsage(c echo.Context, tracker *usageTracker) {
+	record := tracker.finish(c.Response().Status)
+	tracker.limit.ConsumeTokens(record.TotalTokens)
+	h.quotaService.Consume(record, tracker.quota)
+	h.usageService.Record(record)
+}
+
+// parseUsageQuery 解析用量查询参数
+// start_date、end_date 格式为 2006-01-02，均包含当天；默认最近30天
+func parseUsageQuery(c echo.Context, userID uint64) (*models.UsageQuery, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+
+	q := &models.UsageQuery{
+		UserID:    userID,
+		StartTime: today.AddDate(0, 0, -29),
+		EndTime:   today.AddDate(0, 0, 1),
+	}
+
+	if startDate := c.QueryParam("start_date"); startDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", startDate, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		q.StartTime = t
+	}
+	if endDate := c.QueryParam("end_date"); endDate != "" {
+		t, err := time.ParseInLocation("2006-01-02", endDate, time.Local)
+		if err != nil {
+			return nil, err
+		}
+		q.EndTime = t.AddDate(0, 0, 1)
+	}
+
+	if apiKeyIDStr := c.QueryParam("api_key_id"); apiKeyIDStr != "" {
+		if parsed, err := strconv.ParseUint(apiKeyIDStr, 10, 64); err == nil {
+			q.APIKeyID = parsed
+		}
+	}
+	if modelIDStr := c.QueryParam("model_id"); modelIDStr != "" {
+		if parsed, err := strconv.ParseUint(modelIDStr, 10, 64); err == nil {
+			q.ModelID = parsed
+		}
+	}
+	if providerIDStr := c.QueryParam("provider_id"); providerIDStr != "" {
+		if parsed, err := strconv.ParseUint(providerIDStr, 10, 64); err == nil {
+			q.ProviderID = parsed
+		}
+	}
+
+	return q, nil
+}
+
+// GetUsage 获取当前用户的用量统计（按维度聚合）
+// GET /api/usage?group_by=day|model|api_key|provider&start_date=&end_date=
+func (h *Handler) GetUsage(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	q, err := parseUsageQuery(c, userID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "日期格式错误，应为 YYYY-MM-DD",
+		})
+	}
+
+	groupBy := c.QueryParam("group_by")
+	if groupBy == "" {
+		groupBy = "day"
+	}
+
+	result, err := h.usageService.Aggregate(q, groupBy)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    result,
+	})
+}
+
+// GetUsageSummary 获取当前用户的用量汇总（含压缩前后 token 对比）
+// GET /api/usage/summary?start_date=&end_date=
+func (h *Handler) GetUsageSummary(c echo.Context) error {
+	userID, ok := middleware.GetUserID(c)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, Response{
+			Code:    401,
+			Message: "未授权",
+		})
+	}
+
+	q, err := parseUsageQuery(c, userID)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "日期格式错误，应为 YYYY-MM-DD",
+		})
+	}
+
+	summary, err := h.usageService.Summary(q)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+	}
+
+	return c.JSON(http.StatusOK, Response{
+		Code:    0,
+		Message: "获取成功",
+		Data:    summary,
+	})
+}
@@ -3,6 +3,9 @@ package models
 import (
 	"database/sql"
 	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
@@ -66,6 +69,9 @@ func InitTables() error {
 		key_name VARCHAR(64) NOT NULL,
 		api_key VARCHAR(255) NOT NULL UNIQUE,
 		prompt TEXT NULL COMMENT 'API密钥默认提示词',
+		rpm_limit INT DEFAULT 0 COMMENT '每分钟请求数上限，0为不限制',
+		tpm_limit INT DEFAULT 0 COMMENT '每分钟token数上限，0为不限制',
+		max_concurrent_streams INT DEFAULT 0 COMMENT '同时进行的流式请求数上限，0为不限制',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		INDEX idx_user_id (user_id),
@@ -83,6 +89,14 @@ func InitTables() error {
 		base_url VARCHAR(512) NOT NULL COMMENT 'OpenAI格式的接口地址',
 		api_prefix VARCHAR(64) NOT NULL COMMENT 'API请求前缀',
 		api_key VARCHAR(255) NOT NULL COMMENT '厂商API密钥',
+		type VARCHAR(32) NOT NULL DEFAULT 'openai' COMMENT '接口协议类型：openai/anthropic/gemini/azure',
+		api_version VARCHAR(32) DEFAULT '' COMMENT 'Azure OpenAI 的 api-version',
+		connect_timeout INT DEFAULT 0 COMMENT '建立连接超时，单位秒，0为默认30秒',
+		first_byte_timeout INT DEFAULT 0 COMMENT '发出请求到收到响应头的超时，单位秒，0为默认300秒',
+		stream_idle_timeout INT DEFAULT 0 COMMENT '读取响应时两次数据之间的最长间隔，单位秒，0为不限制',
+		max_retries INT DEFAULT 0 COMMENT '同一目标失败后的最大重试次数，0为不重试',
+		retry_backoff_ms INT DEFAULT 0 COMMENT '首次重试前的等待时间，单位毫秒，之后按指数增长，0为默认500毫秒',
+		retry_status_codes VARCHAR(128) DEFAULT '' COMMENT '可重试的状态码，逗号分隔，留空为 429,503',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		INDEX idx_name (name)
@@ -103,6 +117,13 @@ func InitTables() error {
 		compress_truncate_len INT DEFAULT 500 COMMENT '截断过长消息的长度阈值',
 		compress_user_count INT DEFAULT 3 COMMENT '压缩的user消息倒数数量',
 		compress_role_types VARCHAR(128) DEFAULT '' COMMENT '角色类型，多个用逗号分开',
+		input_price DECIMAL(20,6) DEFAULT 0 COMMENT '输入单价，每百万token',
+		output_price DECIMAL(20,6) DEFAULT 0 COMMENT '输出单价，每百万token',
+		cached_input_price DECIMAL(20,6) DEFAULT 0 COMMENT '缓存命中的输入单价，每百万token，0为按输入单价计',
+		availability VARCHAR(255) DEFAULT '' COMMENT '可用时间段，如 mon-fri 09:00-20:00，留空为全天可用',
+		deprecated TINYINT DEFAULT 0 COMMENT '是否已弃用',
+		redirect_to VARCHAR(255) DEFAULT '' COMMENT '弃用后重定向到的模型（厂商前缀-模型别名）',
+		embeddings_enabled TINYINT DEFAULT 0 COMMENT '是否支持 embeddings 接口',
 		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
 		INDEX idx_user_id (user_id),
@@ -129,12 +150,100 @@ func InitTables() error {
 	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
 	`
 
+	// 用量记录表（每次代理请求一条，不设外键，删除模型/密钥后保留账单数据）
+	usageRecordsTable := `
+	CREATE TABLE IF NOT EXISTS usage_records (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		api_key_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+		model_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '关联models表',
+		model_name VARCHAR(255) NOT NULL DEFAULT '' COMMENT '客户端请求的模型名（厂商前缀-模型别名）',
+		upstream_model VARCHAR(128) NOT NULL DEFAULT '' COMMENT '厂商内部的模型ID',
+		provider_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+		is_stream TINYINT DEFAULT 0,
+		prompt_tokens INT DEFAULT 0,
+		completion_tokens INT DEFAULT 0,
+		total_tokens INT DEFAULT 0,
+		original_tokens INT DEFAULT 0 COMMENT '压缩前的消息token数',
+		compressed_tokens INT DEFAULT 0 COMMENT '压缩后的消息token数',
+		saved_tokens INT DEFAULT 0 COMMENT '压缩节省的token数',
+		usage_estimated TINYINT DEFAULT 0 COMMENT '用量是否由tokenizer估算',
+		latency_ms INT DEFAULT 0 COMMENT '请求耗时，单位毫秒',
+		status_code INT DEFAULT 0 COMMENT '返回给客户端的HTTP状态码',
+		fallback_index INT DEFAULT 0 COMMENT '实际服务的目标序号，0为主目标，1起为备用目标',
+		cached_tokens INT DEFAULT 0 COMMENT '命中厂商缓存的输入token数',
+		cost DECIMAL(20,8) DEFAULT 0 COMMENT '按模型单价计算的费用',
+		saved_cost DECIMAL(20,8) DEFAULT 0 COMMENT '压缩节省的费用',
+		outcome VARCHAR(32) NOT NULL DEFAULT '' COMMENT '请求结果：completed/failed/client_cancelled',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		INDEX idx_user_created (user_id, created_at),
+		INDEX idx_api_key_id (api_key_id),
+		INDEX idx_model_id (model_id),
+		INDEX idx_provider_id (provider_id)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// 模型备用目标表（主厂商失败时按优先级依次尝试）
+	modelFallbacksTable := `
+	CREATE TABLE IF NOT EXISTS model_fallbacks (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		model_id BIGINT UNSIGNED NOT NULL COMMENT '关联models表',
+		provider_id BIGINT UNSIGNED NOT NULL,
+		target_model_id VARCHAR(128) NOT NULL COMMENT '备用厂商内部的模型ID',
+		priority INT DEFAULT 0 COMMENT '优先级，越小越先尝试',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_model_id (model_id),
+		FOREIGN KEY (model_id) REFERENCES models(id) ON DELETE CASCADE,
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// 厂商密钥表（同一厂商多个密钥，按权重轮询）
+	providerKeysTable := `
+	CREATE TABLE IF NOT EXISTS provider_keys (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		provider_id BIGINT UNSIGNED NOT NULL,
+		name VARCHAR(128) NOT NULL DEFAULT '' COMMENT '密钥备注名',
+		api_key VARCHAR(255) NOT NULL COMMENT '厂商API密钥',
+		weight INT DEFAULT 1 COMMENT '权重，越大分配的请求越多',
+		is_active TINYINT DEFAULT 1,
+		cooldown_seconds INT DEFAULT 60 COMMENT '返回401/429后暂停使用的秒数',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		INDEX idx_provider_id (provider_id),
+		FOREIGN KEY (provider_id) REFERENCES providers(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
+	// 用量配额表（按用户或API密钥限制每日/每月用量）
+	quotasTable := `
+	CREATE TABLE IF NOT EXISTS quotas (
+		id BIGINT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+		user_id BIGINT UNSIGNED NOT NULL,
+		api_key_id BIGINT UNSIGNED NOT NULL DEFAULT 0 COMMENT '0表示作用于用户的所有密钥',
+		period VARCHAR(16) NOT NULL COMMENT '统计周期：daily、monthly',
+		limit_type VARCHAR(16) NOT NULL DEFAULT 'tokens' COMMENT '限额类型：tokens、cost',
+		limit_value DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '周期内的用量上限',
+		used_value DECIMAL(20,6) NOT NULL DEFAULT 0 COMMENT '当前周期已用量',
+		period_start DATE NOT NULL COMMENT '当前周期开始日期',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+		UNIQUE KEY uk_scope (user_id, api_key_id, period, limit_type),
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+	`
+
 	tables := []string{
 		userTable,
 		apiKeysTable,
 		providersTable,
 		modelsTable,
 		apiKeyPromptsTable,
+		usageRecordsTable,
+		modelFallbacksTable,
+		providerKeysTable,
+		quotasTable,
 	}
 
 	for _, table := range tables {
@@ -143,6 +252,63 @@ func InitTables() error {
 		}
 	}
 
+	// 为已存在的表补充后续新增的字段
+	columns := []struct {
+		table      string
+		column     string
+		definition string
+	}{
+		{"usage_records", "fallback_index", "INT DEFAULT 0 COMMENT '实际服务的目标序号，0为主目标，1起为备用目标'"},
+		{"api_keys", "rpm_limit", "INT DEFAULT 0 COMMENT '每分钟请求数上限，0为不限制'"},
+		{"api_keys", "tpm_limit", "INT DEFAULT 0 COMMENT '每分钟token数上限，0为不限制'"},
+		{"api_keys", "max_concurrent_streams", "INT DEFAULT 0 COMMENT '同时进行的流式请求数上限，0为不限制'"},
+		{"models", "input_price", "DECIMAL(20,6) DEFAULT 0 COMMENT '输入单价，每百万token'"},
+		{"models", "output_price", "DECIMAL(20,6) DEFAULT 0 COMMENT '输出单价，每百万token'"},
+		{"models", "cached_input_price", "DECIMAL(20,6) DEFAULT 0 COMMENT '缓存命中的输入单价，每百万token，0为按输入单价计'"},
+		{"models", "availability", "VARCHAR(255) DEFAULT '' COMMENT '可用时间段，如 mon-fri 09:00-20:00，留空为全天可用'"},
+		{"models", "deprecated", "TINYINT DEFAULT 0 COMMENT '是否已弃用'"},
+		{"models", "redirect_to", "VARCHAR(255) DEFAULT '' COMMENT '弃用后重定向到的模型（厂商前缀-模型别名）'"},
+		{"models", "embeddings_enabled", "TINYINT DEFAULT 0 COMMENT '是否支持 embeddings 接口'"},
+		{"usage_records", "cached_tokens", "INT DEFAULT 0 COMMENT '命中厂商缓存的输入token数'"},
+		{"usage_records", "cost", "DECIMAL(20,8) DEFAULT 0 COMMENT '按模型单价计算的费用'"},
+		{"usage_records", "saved_cost", "DECIMAL(20,8) DEFAULT 0 COMMENT '压缩节省的费用'"},
+		{"providers", "type", "VARCHAR(32) NOT NULL DEFAULT 'openai' COMMENT '接口协议类型：openai/anthropic/gemini/azure'"},
+		{"providers", "api_version", "VARCHAR(32) DEFAULT '' COMMENT 'Azure OpenAI 的 api-version'"},
+		{"providers", "connect_timeout", "INT DEFAULT 0 COMMENT '建立连接超时，单位秒，0为默认30秒'"},
+		{"providers", "first_byte_timeout", "INT DEFAULT 0 COMMENT '发出请求到收到响应头的超时，单位秒，0为默认300秒'"},
+		{"providers", "stream_idle_timeout", "INT DEFAULT 0 COMMENT '读取响应时两次数据之间的最长间隔，单位秒，0为不限制'"},
+		{"providers", "max_retries", "INT DEFAULT 0 COMMENT '同一目标失败后的最大重试次数，0为不重试'"},
+		{"providers", "retry_backoff_ms", "INT DEFAULT 0 COMMENT '首次重试前的等待时间，单位毫秒，之后按指数增长，0为默认500毫秒'"},
+		{"providers", "retry_status_codes", "VARCHAR(128) DEFAULT '' COMMENT '可重试的状态码，逗号分隔，留空为 429,503'"},
+		{"usage_records", "outcome", "VARCHAR(32) NOT NULL DEFAULT '' COMMENT '请求结果：completed/failed/client_cancelled'"},
+	}
+
+	for _, col := range columns {
+		if err := addColumnIfNotExists(col.table, col.column, col.definition); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addColumnIfNotExists 字段不存在时添加字段
+func addColumnIfNotExists(table, column, definition string) error {
+	var count int
+	err := DB.QueryRow(`
+		SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = ?
+	`, table, column).Scan(&count)
+	if err != nil {
+		return fmt.Errorf("检查字段 %s.%s 失败: %w", table, column, err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	if _, err := DB.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return fmt.Errorf("添加字段 %s.%s 失败: %w", table, column, err)
+	}
 	return nil
 }
 
@@ -186,6 +352,13 @@ type User struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// APIKeyLimits API密钥限流配置，0 表示不限制
+type APIKeyLimits struct {
+	RPMLimit             int `json:"rpm_limit"`              // 每分钟请求数
+	TPMLimit             int `json:"tpm_limit"`              // 每分钟token数
+	MaxConcurrentStreams int `json:"max_concurrent_streams"` // 同时进行的流式请求数
+}
+
 // APIKey 密钥模型
 type APIKey struct {
 	ID        uint64    `json:"id"`
@@ -195,6 +368,7 @@ type APIKey struct {
 	Prompt    string    `json:"prompt"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	APIKeyLimits
 }
 
 // Provider 模型厂商模型（包含API密钥）
@@ -205,8 +379,197 @@ type Provider struct {
 	BaseURL     string    `json:"base_url"`
 	APIPrefix   string    `json:"api_prefix"`
 	APIKey      string    `json:"api_key"`
+	Type        string    `json:"type"`        // 接口协议类型
+	APIVersion  string    `json:"api_version"` // Azure OpenAI 的 api-version，留空使用默认版本
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	ProviderPolicy
+}
+
+// 厂商接口协议类型
+const (
+	ProviderTypeOpenAI    = "openai"    // OpenAI 兼容接口（/chat/completions）
+	ProviderTypeAnthropic = "anthropic" // Anthropic Messages API（/messages）
+	ProviderTypeGemini    = "gemini"    // Google Gemini API（/models/{model}:generateContent）
+	ProviderTypeAzure     = "azure"     // Azure OpenAI（/openai/deployments/{deployment}/chat/completions），模型ID即部署名
+)
+
+// IsValidProviderType 判断厂商接口协议类型是否受支持
+func IsValidProviderType(providerType string) bool {
+	switch providerType {
+	case ProviderTypeOpenAI, ProviderTypeAnthropic, ProviderTypeGemini, ProviderTypeAzure:
+		return true
+	}
+	return false
+}
+
+// ProviderPolicy 厂商请求的超时和重试配置，各字段为 0 时使用默认值
+type ProviderPolicy struct {
+	ConnectTimeout    int    `json:"connect_timeout"`     // 建立连接超时，单位秒
+	FirstByteTimeout  int    `json:"first_byte_timeout"`  // 发出请求到收到响应头的超时，单位秒
+	StreamIdleTimeout int    `json:"stream_idle_timeout"` // 读取响应时两次数据之间的最长间隔，单位秒，0为不限制
+	MaxRetries        int    `json:"max_retries"`         // 同一目标失败后的最大重试次数，0为不重试
+	RetryBackoffMs    int    `json:"retry_backoff_ms"`    // 首次重试前的等待时间，单位毫秒，之后按指数增长
+	RetryStatusCodes  string `json:"retry_status_codes"`  // 可重试的状态码，逗号分隔，留空使用默认列表
+
+	retryStatuses []int // 解析后的可重试状态码，由 Parsed 填充
+}
+
+// 厂商请求的默认超时和重试配置
+const (
+	DefaultConnectTimeout   = 30 * time.Second
+	DefaultFirstByteTimeout = 300 * time.Second
+	DefaultRetryBackoff     = 500 * time.Millisecond
+	DefaultRetryStatusCodes = "429,503"        // 聊天请求不是幂等的，其他 5xx 可能已被厂商处理，需显式配置才重试
+	MaxProviderRetries      = 10               // 重试次数上限
+	MaxRetryDelay           = 30 * time.Second // 单次重试等待时间上限
+)
+
+// ConnectTimeoutDuration 建立连接超时
+func (p ProviderPolicy) ConnectTimeoutDuration() time.Duration {
+	if p.ConnectTimeout <= 0 {
+		return DefaultConnectTimeout
+	}
+	return time.Duration(p.ConnectTimeout) * time.Second
+}
+
+// FirstByteTimeoutDuration 发出请求到收到响应头的超时
+func (p ProviderPolicy) FirstByteTimeoutDuration() time.Duration {
+	if p.FirstByteTimeout <= 0 {
+		return DefaultFirstByteTimeout
+	}
+	return time.Duration(p.FirstByteTimeout) * time.Second
+}
+
+// StreamIdleTimeoutDuration 读取响应时两次数据之间的最长间隔，0 表示不限制
+func (p ProviderPolicy) StreamIdleTimeoutDuration() time.Duration {
+	if p.StreamIdleTimeout <= 0 {
+		return 0
+	}
+	return time.Duration(p.StreamIdleTimeout) * time.Second
+}
+
+// RetryDelay 第 attempt 次重试（从 0 开始）前的等待时间
+// 按指数增长并加入随机抖动（取 [d/2, d) 之间的随机值），避免多个请求同时重试
+func (p ProviderPolicy) RetryDelay(attempt int) time.Duration {
+	delay := DefaultRetryBackoff
+	if p.RetryBackoffMs > 0 {
+		delay = time.Duration(p.RetryBackoffMs) * time.Millisecond
+	}
+	for i := 0; i < attempt && delay < MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxRetryDelay {
+		delay = MaxRetryDelay
+	}
+	half := delay / 2
+	return half + rand.N(delay-half)
+}
+
+// defaultRetryStatuses 解析后的默认可重试状态码
+var defaultRetryStatuses, _ = ParseStatusCodes(DefaultRetryStatusCodes)
+
+// Parsed 返回解析好可重试状态码的配置，加载到缓存时调用一次，避免每次判断状态码时重新解析
+// 状态码列表无效时使用默认列表（保存前已由 Validate 校验）
+func (p ProviderPolicy) Parsed() ProviderPolicy {
+	p.retryStatuses, _ = ParseStatusCodes(p.RetryStatusCodes)
+	return p
+}
+
+// IsRetryableStatus 判断厂商状态码是否可重试，未经 Parsed 解析或未配置时使用默认列表
+func (p ProviderPolicy) IsRetryableStatus(status int) bool {
+	codes := p.retryStatuses
+	if len(codes) == 0 {
+		codes = defaultRetryStatuses
+	}
+	for _, code := range codes {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate 检查超时和重试配置是否合法
+func (p ProviderPolicy) Validate() error {
+	if p.ConnectTimeout < 0 || p.FirstByteTimeout < 0 || p.StreamIdleTimeout < 0 || p.MaxRetries < 0 || p.RetryBackoffMs < 0 {
+		return fmt.Errorf("超时和重试参数不能为负数")
+	}
+	if p.MaxRetries > MaxProviderRetries {
+		return fmt.Errorf("重试次数不能超过 %d", MaxProviderRetries)
+	}
+	if _, err := ParseStatusCodes(p.RetryStatusCodes); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseStatusCodes 解析逗号分隔的 HTTP 状态码列表，空字符串返回 nil
+func ParseStatusCodes(s string) ([]int, error) {
+	var codes []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("无效的状态码: %s", part)
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// ProviderKey 厂商密钥（同一厂商可配置多个）
+type ProviderKey struct {
+	ID              uint64    `json:"id"`
+	ProviderID      uint64    `json:"provider_id"`
+	Name            string    `json:"name"`
+	APIKey          string    `json:"api_key"`
+	Weight          int       `json:"weight"`
+	IsActive        bool      `json:"is_active"`
+	CooldownSeconds int       `json:"cooldown_seconds"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProviderKeyWithStatus 厂商密钥（含负载均衡运行时状态）
+type ProviderKeyWithStatus struct {
+	ProviderKey
+	CoolingDown   bool       `json:"cooling_down"`
+	CooldownUntil *time.Time `json:"cooldown_until,omitempty"`
+}
+
+// 熔断器状态
+const (
+	CircuitClosed   = "closed"    // 正常
+	CircuitOpen     = "open"      // 连续失败后熔断，请求直接跳过
+	CircuitHalfOpen = "half_open" // 熔断时间已到，正在探测是否恢复
+)
+
+// CircuitStatus 熔断器状态
+type CircuitStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	NextProbeAt         *time.Time `json:"next_probe_at,omitempty"` // 熔断中时下次探测的时间
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+	LastSuccessAt       *time.Time `json:"last_success_at,omitempty"`
+}
+
+// ProviderHealth 厂商及其密钥的熔断状态
+type ProviderHealth struct {
+	ProviderID uint64 `json:"provider_id"`
+	CircuitStatus
+	Keys []ProviderKeyHealth `json:"keys"`
+}
+
+// ProviderKeyHealth 厂商密钥的熔断状态
+type ProviderKeyHealth struct {
+	KeyID uint64 `json:"key_id"`
+	CircuitStatus
 }
 
 // Model 模型表（关联用户和厂商）
@@ -217,13 +580,204 @@ type Model struct {
 	ModelID             string    `json:"model_id"`
 	DisplayName         string    `json:"display_name"`
 	IsActive            bool      `json:"is_active"`
-	ContextLength       int       `json:"context_length"` // 上下文长度，单位k
+	ContextLength       int       `json:"context_length"` // 上下文长度，单位k（1k 按 1000 token 计）
 	CompressEnabled     bool      `json:"compress_enabled"`
 	CompressTruncateLen int       `json:"compress_truncate_len"`
 	CompressUserCount   int       `json:"compress_user_count"`
 	CompressRoleTypes   string    `json:"compress_role_types"`
+	EmbeddingsEnabled   bool      `json:"embeddings_enabled"` // 是否支持 embeddings 接口，未开启的模型只能用于补全
 	CreatedAt           time.Time `json:"created_at"`
 	UpdatedAt           time.Time `json:"updated_at"`
+	ModelPricing
+	ModelLifecycle
+}
+
+// DefaultContextLength 未设置上下文长度时的默认值，单位k
+const DefaultContextLength = 128
+
+// ContextTokens 返回模型的上下文长度（token 数），未设置时使用默认值
+func (m *Model) ContextTokens() int {
+	length := m.ContextLength
+	if length <= 0 {
+		length = DefaultContextLength
+	}
+	return length * 1000
+}
+
+// ModelPricing 模型单价（每百万token，币种由使用方自行约定）
+type ModelPricing struct {
+	InputPrice       float64 `json:"input_price"`
+	OutputPrice      float64 `json:"output_price"`
+	CachedInputPrice float64 `json:"cached_input_price"` // 0 表示按输入单价计
+}
+
+// Cost 计算一次请求的费用，cachedTokens 为 promptTokens 中命中缓存的部分
+func (p ModelPricing) Cost(promptTokens, cachedTokens, completionTokens int) float64 {
+	if cachedTokens > promptTokens {
+		cachedTokens = promptTokens
+	}
+	cachedPrice := p.CachedInputPrice
+	if cachedPrice <= 0 {
+		cachedPrice = p.InputPrice
+	}
+	cost := float64(promptTokens-cachedTokens)*p.InputPrice +
+		float64(cachedTokens)*cachedPrice +
+		float64(completionTokens)*p.OutputPrice
+	return cost / 1e6
+}
+
+// ModelLifecycle 模型上下线配置
+type ModelLifecycle struct {
+	Availability string `json:"availability"` // 可用时间段，留空为全天可用
+	Deprecated   bool   `json:"deprecated"`
+	RedirectTo   string `json:"redirect_to"` // 弃用后重定向到的模型，留空则继续由本模型服务
+}
+
+// AvailabilityWindow 可用时间段，Start、End 为当天的分钟数
+// End 不大于 Start 时表示跨越午夜到次日
+type AvailabilityWindow struct {
+	Days  [7]bool // 按 time.Weekday 索引
+	Start int
+	End   int
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseClock 解析 HH:MM，允许 24:00
+func parseClock(s string) (int, error) {
+	hour, minute, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	h, err1 := strconv.Atoi(hour)
+	m, err2 := strconv.Atoi(minute)
+	if err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("时间格式错误: %s", s)
+	}
+	return h*60 + m, nil
+}
+
+// parseWeekdays 解析星期，如 mon-fri、sat,sun、*
+func parseWeekdays(s string) ([7]bool, error) {
+	var days [7]bool
+	if s == "*" || s == "daily" {
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	}
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := weekdayNames[from]
+		if !ok {
+			return days, fmt.Errorf("星期格式错误: %s", part)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdayNames[to]; !ok {
+				return days, fmt.Errorf("星期格式错误: %s", part)
+			}
+		}
+		// 支持 fri-mon 这类跨周末的范围
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// ParseAvailability 解析可用时间段，多个时间段用分号分隔
+// 每段格式为 "[星期] HH:MM-HH:MM"，如 "mon-fri 09:00-20:00; sat 10:00-14:00"，省略星期表示每天
+// 时间按服务器本地时区计算，空字符串表示全天可用（返回 nil）
+func ParseAvailability(schedule string) ([]AvailabilityWindow, error) {
+	var windows []AvailabilityWindow
+	for _, part := range strings.Split(strings.ToLower(schedule), ";") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("可用时间段格式错误: %s", strings.TrimSpace(part))
+		}
+
+		days := "*"
+		clock := fields[0]
+		if len(fields) == 2 {
+			days, clock = fields[0], fields[1]
+		}
+
+		window := AvailabilityWindow{}
+		var err error
+		if window.Days, err = parseWeekdays(days); err != nil {
+			return nil, err
+		}
+		from, to, ok := strings.Cut(clock, "-")
+		if !ok {
+			return nil, fmt.Errorf("可用时间段格式错误: %s", strings.TrimSpace(part))
+		}
+		if window.Start, err = parseClock(from); err != nil {
+			return nil, err
+		}
+		if window.End, err = parseClock(to); err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// AvailableAt 判断 t 是否处于任一可用时间段内，windows 为空时始终可用
+func AvailableAt(windows []AvailabilityWindow, t time.Time) bool {
+	if len(windows) == 0 {
+		return true
+	}
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+	for _, w := range windows {
+		if w.End > w.Start {
+			if w.Days[today] && minute >= w.Start && minute < w.End {
+				return true
+			}
+			continue
+		}
+		// 跨午夜：当天开始后的部分，或前一天开始延续到今天的部分
+		if (w.Days[today] && minute >= w.Start) || (w.Days[yesterday] && minute < w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextAvailable 返回 t 之后最近的可用开始时间，windows 为空或已可用时返回 t
+func NextAvailable(windows []AvailabilityWindow, t time.Time) time.Time {
+	if AvailableAt(windows, t) {
+		return t
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	var next time.Time
+	for offset := 0; offset <= 7; offset++ {
+		day := midnight.AddDate(0, 0, offset)
+		for _, w := range windows {
+			if !w.Days[day.Weekday()] {
+				continue
+			}
+			start := day.Add(time.Duration(w.Start) * time.Minute)
+			if start.After(t) && (next.IsZero() || start.Before(next)) {
+				next = start
+			}
+		}
+		if !next.IsZero() {
+			return next
+		}
+	}
+	return t
 }
 
 // ModelWithDetails 模型详情（含厂商和用户信息）
@@ -233,8 +787,174 @@ type ModelWithDetails struct {
 	ProviderDisplayName string `json:"provider_display_name"`
 	ProviderBaseURL     string `json:"provider_base_url"`
 	ProviderAPIPrefix   string `json:"provider_api_prefix"`
+	ProviderType        string `json:"provider_type"`
+	ProviderAPIVersion  string `json:"provider_api_version"`
 	Username            string `json:"username"`
 	ProviderKey         string `json:"provider_key,omitempty"`
+	// 备用目标（按优先级排序）
+	Fallbacks []ModelFallbackWithProvider `json:"fallbacks,omitempty"`
+}
+
+// ModelFallback 模型备用目标
+type ModelFallback struct {
+	ID            uint64    `json:"id"`
+	ModelID       uint64    `json:"model_id"` // 关联models表
+	ProviderID    uint64    `json:"provider_id"`
+	TargetModelID string    `json:"target_model_id"` // 备用厂商内部的模型ID
+	Priority      int       `json:"priority"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ModelFallbackWithProvider 模型备用目标（含厂商信息）
+type ModelFallbackWithProvider struct {
+	ModelFallback
+	ProviderName        string `json:"provider_name"`
+	ProviderDisplayName string `json:"provider_display_name"`
+	ProviderBaseURL     string `json:"provider_base_url"`
+	ProviderType        string `json:"provider_type"`
+	ProviderAPIVersion  string `json:"provider_api_version"`
+	ProviderKey         string `json:"-"`
+}
+
+// UsageRecord 用量记录（每次代理请求一条）
+type UsageRecord struct {
+	ID               uint64    `json:"id"`
+	UserID           uint64    `json:"user_id"`
+	APIKeyID         uint64    `json:"api_key_id"`
+	ModelID          uint64    `json:"model_id"`
+	ModelName        string    `json:"model_name"`
+	UpstreamModel    string    `json:"upstream_model"`
+	ProviderID       uint64    `json:"provider_id"`
+	IsStream         bool      `json:"is_stream"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	OriginalTokens   int       `json:"original_tokens"`   // 压缩前的消息token数
+	CompressedTokens int       `json:"compressed_tokens"` // 压缩后的消息token数
+	SavedTokens      int       `json:"saved_tokens"`
+	UsageEstimated   bool      `json:"usage_estimated"` // 厂商未返回usage时由tokenizer估算
+	LatencyMs        int64     `json:"latency_ms"`
+	StatusCode       int       `json:"status_code"`
+	FallbackIndex    int       `json:"fallback_index"` // 0为主目标，1起为备用目标
+	CachedTokens     int       `json:"cached_tokens"`  // 命中厂商缓存的输入token数
+	Cost             float64   `json:"cost"`
+	SavedCost        float64   `json:"saved_cost"` // 压缩节省的费用（按输入单价计）
+	Outcome          string    `json:"outcome"`    // 请求结果，见 UsageOutcome* 常量
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// 用量记录的请求结果
+const (
+	UsageOutcomeCompleted       = "completed"        // 厂商正常返回
+	UsageOutcomeFailed          = "failed"           // 请求失败
+	UsageOutcomeClientCancelled = "client_cancelled" // 客户端在响应完成前断开，已消耗的 token 照常计入
+)
+
+// UsageQuery 用量查询条件
+// APIKeyID、ModelID、ProviderID 为 0 时不过滤
+type UsageQuery struct {
+	UserID     uint64
+	StartTime  time.Time
+	EndTime    time.Time // 不包含
+	APIKeyID   uint64
+	ModelID    uint64
+	ProviderID uint64
+}
+
+// UsageAggregate 用量聚合结果（按天/模型/密钥/厂商分组）
+type UsageAggregate struct {
+	Key              string  `json:"key"`
+	Label            string  `json:"label"`
+	Requests         int64   `json:"requests"`
+	FailedRequests   int64   `json:"failed_requests"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	OriginalTokens   int64   `json:"original_tokens"`
+	CompressedTokens int64   `json:"compressed_tokens"`
+	SavedTokens      int64   `json:"saved_tokens"`
+	Cost             float64 `json:"cost"`
+	SavedCost        float64 `json:"saved_cost"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
+
+// UsageSummary 用量汇总（含压缩前后对比）
+type UsageSummary struct {
+	StartTime        time.Time `json:"start_time"`
+	EndTime          time.Time `json:"end_time"`
+	Requests         int64     `json:"requests"`
+	FailedRequests   int64     `json:"failed_requests"`
+	PromptTokens     int64     `json:"prompt_tokens"`
+	CompletionTokens int64     `json:"completion_tokens"`
+	TotalTokens      int64     `json:"total_tokens"`
+	OriginalTokens   int64     `json:"original_tokens"`   // 压缩前的消息token数
+	CompressedTokens int64     `json:"compressed_tokens"` // 压缩后的消息token数
+	SavedTokens      int64     `json:"saved_tokens"`
+	SavedPercent     float64   `json:"saved_percent"` // 节省比例（0-100）
+	Cost             float64   `json:"cost"`
+	SavedCost        float64   `json:"saved_cost"`
+	AvgLatencyMs     float64   `json:"avg_latency_ms"`
+}
+
+// 配额统计周期
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// 配额限额类型
+const (
+	QuotaLimitTokens = "tokens"
+	QuotaLimitCost   = "cost" // 按模型单价计算的费用
+)
+
+// Quota 用量配额（APIKeyID 为 0 时作用于用户的所有密钥）
+type Quota struct {
+	ID          uint64    `json:"id"`
+	UserID      uint64    `json:"user_id"`
+	APIKeyID    uint64    `json:"api_key_id"`
+	Period      string    `json:"period"`
+	LimitType   string    `json:"limit_type"`
+	LimitValue  float64   `json:"limit_value"`
+	UsedValue   float64   `json:"used_value"`
+	PeriodStart time.Time `json:"period_start"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Remaining   float64   `json:"remaining"` // 计算字段：当前周期剩余用量
+	ResetAt     time.Time `json:"reset_at"`  // 计算字段：下个周期开始时间
+	Reserved    float64   `json:"-"`         // 进行中请求预占的用量，只保存在缓存中
+}
+
+// QuotaPeriodStart 返回 t 所在统计周期的开始时间（本地时区）
+func QuotaPeriodStart(period string, t time.Time) time.Time {
+	if period == QuotaPeriodMonthly {
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// QuotaPeriodEnd 返回 t 所在统计周期的结束时间（即下个周期开始时间）
+func QuotaPeriodEnd(period string, t time.Time) time.Time {
+	start := QuotaPeriodStart(period, t)
+	if period == QuotaPeriodMonthly {
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// Refresh 按当前时间滚动统计周期并计算剩余用量
+func (q *Quota) Refresh(now time.Time) {
+	start := QuotaPeriodStart(q.Period, now)
+	if q.PeriodStart.Before(start) {
+		q.PeriodStart = start
+		q.UsedValue = 0
+	}
+	q.Remaining = q.LimitValue - q.UsedValue
+	if q.Remaining < 0 {
+		q.Remaining = 0
+	}
+	q.ResetAt = QuotaPeriodEnd(q.Period, now)
 }
 
 // APIKeyWithUser 密钥与用户关联
@@ -246,12 +966,13 @@ type APIKeyWithUser struct {
 	Prompt    string    `json:"prompt,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	APIKeyLimits
 }
 
 // GetAllAPIKeysWithUsers 获取所有API密钥（包含用户ID）
 func GetAllAPIKeysWithUsers() ([]APIKeyWithUser, error) {
 	query := `
-		SELECT id, user_id, key_name, api_key, prompt, created_at, updated_at
+		SELECT id, user_id, key_name, api_key, prompt, rpm_limit, tpm_limit, max_concurrent_streams, created_at, updated_at
 		FROM api_keys
 	`
 	rows, err := DB.Query(query)
@@ -271,6 +992,9 @@ func GetAllAPIKeysWithUsers() ([]APIKeyWithUser, error) {
 			&apiKey.KeyName,
 			&apiKeyBytes,
 			&promptBytes,
+			&apiKey.RPMLimit,
+			&apiKey.TPMLimit,
+			&apiKey.MaxConcurrentStreams,
 			&apiKey.CreatedAt,
 			&apiKey.UpdatedAt,
 		); err != nil {
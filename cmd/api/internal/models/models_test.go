@@ -0,0 +1,186 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+// at 返回 2024-01-01（周一）起第 day 天的 hh:mm
+func at(day, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+day, hour, minute, 0, 0, time.Local)
+}
+
+func TestParseAvailability(t *testing.T) {
+	tests := []struct {
+		schedule string
+		want     []AvailabilityWindow
+		wantErr  bool
+	}{
+		{"", nil, false},
+		{"09:00-18:00", []AvailabilityWindow{{Days: [7]bool{true, true, true, true, true, true, true}, Start: 540, End: 1080}}, false},
+		{"mon-fri 09:00-20:00; sat 10:00-14:00", []AvailabilityWindow{
+			{Days: [7]bool{false, true, true, true, true, true, false}, Start: 540, End: 1200},
+			{Days: [7]bool{false, false, false, false, false, false, true}, Start: 600, End: 840},
+		}, false},
+		{"fri-mon 22:00-06:00", []AvailabilityWindow{{Days: [7]bool{true, true, false, false, false, true, true}, Start: 1320, End: 360}}, false},
+		{"SAT,Sun 00:00-24:00", []AvailabilityWindow{{Days: [7]bool{true, false, false, false, false, false, true}, Start: 0, End: 1440}}, false},
+		{"mon 09:00", nil, true},
+		{"xyz 09:00-10:00", nil, true},
+		{"25:00-26:00", nil, true},
+		{"09:60-10:00", nil, true},
+		{"mon tue 09:00-10:00", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			got, err := ParseAvailability(tt.schedule)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d windows, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("window %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestAvailableAt(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		t        time.Time
+		want     bool
+	}{
+		{"未设置", "", at(0, 3, 0), true},
+		{"时间段内", "mon-fri 09:00-18:00", at(0, 9, 0), true},
+		{"结束时刻不可用", "mon-fri 09:00-18:00", at(0, 18, 0), false},
+		{"周末", "mon-fri 09:00-18:00", at(5, 10, 0), false},
+		{"跨午夜当天部分", "mon 22:00-06:00", at(0, 23, 0), true},
+		{"跨午夜次日部分", "mon 22:00-06:00", at(1, 5, 59), true},
+		{"跨午夜次日结束后", "mon 22:00-06:00", at(1, 6, 0), false},
+		{"跨午夜前一天未启用", "mon 22:00-06:00", at(0, 5, 0), false},
+		{"跨周日到周一", "sun 20:00-02:00", at(7, 1, 0), true},
+		{"多个时间段", "mon 09:00-10:00; mon 14:00-15:00", at(0, 14, 30), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := ParseAvailability(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := AvailableAt(windows, tt.t); got != tt.want {
+				t.Errorf("AvailableAt(%s) = %v, want %v", tt.t.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextAvailable(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule string
+		t        time.Time
+		want     time.Time
+	}{
+		{"已可用", "mon 09:00-18:00", at(0, 10, 0), at(0, 10, 0)},
+		{"当天稍后", "mon 09:00-18:00", at(0, 8, 0), at(0, 9, 0)},
+		{"下周", "mon 09:00-18:00", at(0, 19, 0), at(7, 9, 0)},
+		{"最近的时间段", "wed 09:00-10:00; tue 15:00-16:00", at(0, 12, 0), at(1, 15, 0)},
+		{"跨午夜", "fri 22:00-02:00", at(5, 3, 0), at(11, 22, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := ParseAvailability(tt.schedule)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := NextAvailable(windows, tt.t); !got.Equal(tt.want) {
+				t.Errorf("NextAvailable = %s, want %s", got.Format("Mon 01-02 15:04"), tt.want.Format("Mon 01-02 15:04"))
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		backoff int // retry_backoff_ms
+		attempt int
+		want    time.Duration // 抖动前的等待时间，实际取值 [want/2, want)
+	}{
+		{"默认首次", 0, 0, DefaultRetryBackoff},
+		{"默认第三次", 0, 2, 4 * DefaultRetryBackoff},
+		{"自定义", 100, 1, 200 * time.Millisecond},
+		{"不超过上限", 1000, 10, MaxRetryDelay},
+		{"首次即超过上限", 60000, 0, MaxRetryDelay},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := ProviderPolicy{RetryBackoffMs: tt.backoff}
+			for i := 0; i < 20; i++ {
+				if got := policy.RetryDelay(tt.attempt); got < tt.want/2 || got >= tt.want {
+					t.Fatalf("RetryDelay(%d) = %s, want [%s, %s)", tt.attempt, got, tt.want/2, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestParseStatusCodes(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []int
+		wantErr bool
+	}{
+		{"", nil, false},
+		{"429", []int{429}, false},
+		{" 429, 500 ,,503", []int{429, 500, 503}, false},
+		{"abc", nil, true},
+		{"99", nil, true},
+		{"600", nil, true},
+		{"429,5xx", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseStatusCodes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestIsRetryableStatus(t *testing.T) {
+	tests := []struct {
+		codes  string
+		status int
+		want   bool
+	}{
+		{"", 429, true},
+		{"", 503, true},
+		{"", 500, false},
+		{"", 502, false},
+		{"", 504, false},
+		{"", 400, false},
+		{"408,529", 529, true},
+		{"408,529", 503, false},
+		{"429,500,502,503,504", 502, true},
+	}
+	for _, tt := range tests {
+		if got := (ProviderPolicy{RetryStatusCodes: tt.codes}).Parsed().IsRetryableStatus(tt.status); got != tt.want {
+			t.Errorf("IsRetryableStatus(%q, %d) = %v, want %v", tt.codes, tt.status, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// ModelFallbackRepository 模型备用目标仓库
+type ModelFallbackRepository struct{}
+
+// NewModelFallbackRepository 创建模型备用目标仓库
+func NewModelFallbackRepository() *ModelFallbackRepository {
+	return &ModelFallbackRepository{}
+}
+
+// fallbackWithProviderQuery 查询备用目标及厂商信息
+const fallbackWithProviderQuery = `
+	SELECT
+		f.id, f.model_id, f.provider_id, f.target_model_id, f.priority, f.created_at, f.updated_at,
+		p.name as provider_name, p.display_name as provider_display_name,
+		p.base_url as provider_base_url, p.api_key as provider_api_key, p.type as provider_type,
+		p.api_version as provider_api_version
+	FROM model_fallbacks f
+	INNER JOIN providers p ON f.provider_id = p.id
+`
+
+// scanFallbacks 扫描备用目标查询结果
+func scanFallbacks(rows *sql.Rows) ([]models.ModelFallbackWithProvider, error) {
+	var fallbacks []models.ModelFallbackWithProvider
+	for rows.Next() {
+		fallback := models.ModelFallbackWithProvider{}
+		if err := rows.Scan(
+			&fallback.ID,
+			&fallback.ModelID,
+			&fallback.ProviderID,
+			&fallback.TargetModelID,
+			&fallback.Priority,
+			&fallback.CreatedAt,
+			&fallback.UpdatedAt,
+			&fallback.ProviderName,
+			&fallback.ProviderDisplayName,
+			&fallback.ProviderBaseURL,
+			&fallback.ProviderKey,
+			&fallback.ProviderType,
+			&fallback.ProviderAPIVersion,
+		); err != nil {
+			return nil, fmt.Errorf("扫描备用目标失败: %w", err)
+		}
+		fallbacks = append(fallbacks, fallback)
+	}
+
+	return fallbacks, nil
+}
+
+// GetAllWithProviders 获取所有备用目标（按模型和优先级排序）
+func (r *ModelFallbackRepository) GetAllWithProviders() ([]models.ModelFallbackWithProvider, error) {
+	query := fallbackWithProviderQuery + ` ORDER BY f.model_id ASC, f.priority ASC, f.id ASC`
+
+	rows, err := models.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("查询备用目标列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFallbacks(rows)
+}
+
+// GetByModelIDWithProviders 获取模型的备用目标（按优先级排序）
+func (r *ModelFallbackRepository) GetByModelIDWithProviders(modelID uint64) ([]models.ModelFallbackWithProvider, error) {
+	query := fallbackWithProviderQuery + ` WHERE f.model_id = ? ORDER BY f.priority ASC, f.id ASC`
+
+	rows, err := models.DB.Query(query, modelID)
+	if err != nil {
+		return nil, fmt.Errorf("查询备用目标列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanFallbacks(rows)
+}
+
+// ReplaceByModelID 替换模型的全部备用目标
+func (r *ModelFallbackRepository) ReplaceByModelID(modelID uint64, fallbacks []models.ModelFallback) error {
+	return models.WithTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`DELETE FROM model_fallbacks WHERE model_id = ?`, modelID); err != nil {
+			return fmt.Errorf("删除备用目标失败: %w", err)
+		}
+
+		query := `
+			INSERT INTO model_fallbacks (model_id, provider_id, target_model_id, priority)
+			VALUES (?, ?, ?, ?)
+		`
+		for _, fallback := range fallbacks {
+			if _, err := tx.Exec(query, modelID, fallback.ProviderID, fallback.TargetModelID, fallback.Priority); err != nil {
+				return fmt.Errorf("创建备用目标失败: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
@@ -18,13 +18,15 @@ func NewModelRepository() *ModelRepository {
 // Create 创建模型
 func (r *ModelRepository) Create(model *models.Model) error {
 	query := `
-		INSERT INTO models (user_id, provider_id, model_id, display_name, is_active, context_length, compress_enabled, compress_truncate_len, compress_user_count, compress_role_types)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO models (user_id, provider_id, model_id, display_name, is_active, context_length, compress_enabled, compress_truncate_len, compress_user_count, compress_role_types,
+			input_price, output_price, cached_input_price, availability, deprecated, redirect_to, embeddings_enabled)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := models.DB.Exec(query,
 		model.UserID, model.ProviderID, model.ModelID, model.DisplayName, model.IsActive, model.ContextLength,
-		model.CompressEnabled, model.CompressTruncateLen, model.CompressUserCount, model.CompressRoleTypes)
+		model.CompressEnabled, model.CompressTruncateLen, model.CompressUserCount, model.CompressRoleTypes,
+		model.InputPrice, model.OutputPrice, model.CachedInputPrice, model.Availability, model.Deprecated, model.RedirectTo, model.EmbeddingsEnabled)
 	if err != nil {
 		return fmt.Errorf("创建模型失败: %w", err)
 	}
@@ -74,10 +76,11 @@ func (r *ModelRepository) GetByIDWithDetails(id uint64) (*models.ModelWithDetail
 		SELECT
 			m.id, m.user_id, m.provider_id, m.model_id, m.display_name, m.is_active, m.context_length,
 			m.compress_enabled, m.compress_truncate_len, m.compress_user_count, m.compress_role_types,
+			m.input_price, m.output_price, m.cached_input_price, m.availability, m.deprecated, m.redirect_to, m.embeddings_enabled,
 			m.created_at, m.updated_at,
 			p.name as provider_name, p.display_name as provider_display_name,
 			p.base_url as provider_base_url, p.api_prefix as provider_api_prefix,
-			p.api_key as provider_api_key,
+			p.api_key as provider_api_key, p.type as provider_type, p.api_version as provider_api_version,
 			u.username
 		FROM models m
 		LEFT JOIN providers p ON m.provider_id = p.id
@@ -98,6 +101,13 @@ func (r *ModelRepository) GetByIDWithDetails(id uint64) (*models.ModelWithDetail
 		&model.CompressTruncateLen,
 		&model.CompressUserCount,
 		&model.CompressRoleTypes,
+		&model.InputPrice,
+		&model.OutputPrice,
+		&model.CachedInputPrice,
+		&model.Availability,
+		&model.Deprecated,
+		&model.RedirectTo,
+		&model.EmbeddingsEnabled,
 		&model.CreatedAt,
 		&model.UpdatedAt,
 		&model.ProviderName,
@@ -105,6 +115,8 @@ func (r *ModelRepository) GetByIDWithDetails(id uint64) (*models.ModelWithDetail
 		&model.ProviderBaseURL,
 		&model.ProviderAPIPrefix,
 		&model.ProviderKey,
+		&model.ProviderType,
+		&model.ProviderAPIVersion,
 		&model.Username,
 	)
 	if err != nil {
@@ -124,10 +136,11 @@ func (r *ModelRepository) GetAllWithDetails(providerID uint64) ([]models.ModelWi
 		SELECT
 			m.id, m.user_id, m.provider_id, m.model_id, m.display_name, m.is_active, m.context_length,
 			m.compress_enabled, m.compress_truncate_len, m.compress_user_count, m.compress_role_types,
+			m.input_price, m.output_price, m.cached_input_price, m.availability, m.deprecated, m.redirect_to, m.embeddings_enabled,
 			m.created_at, m.updated_at,
 			p.name as provider_name, p.display_name as provider_display_name,
 			p.base_url as provider_base_url, p.api_prefix as provider_api_prefix,
-			p.api_key as provider_api_key,
+			p.api_key as provider_api_key, p.type as provider_type, p.api_version as provider_api_version,
 			u.username
 		FROM models m
 		LEFT JOIN providers p ON m.provider_id = p.id
@@ -163,6 +176,13 @@ func (r *ModelRepository) GetAllWithDetails(providerID uint64) ([]models.ModelWi
 			&model.CompressTruncateLen,
 			&model.CompressUserCount,
 			&model.CompressRoleTypes,
+			&model.InputPrice,
+			&model.OutputPrice,
+			&model.CachedInputPrice,
+			&model.Availability,
+			&model.Deprecated,
+			&model.RedirectTo,
+			&model.EmbeddingsEnabled,
 			&model.CreatedAt,
 			&model.UpdatedAt,
 			&model.ProviderName,
@@ -170,6 +190,8 @@ func (r *ModelRepository) GetAllWithDetails(providerID uint64) ([]models.ModelWi
 			&model.ProviderBaseURL,
 			&model.ProviderAPIPrefix,
 			&model.ProviderKey,
+			&model.ProviderType,
+			&model.ProviderAPIVersion,
 			&model.Username,
 		); err != nil {
 			return nil, fmt.Errorf("扫描模型失败: %w", err)
@@ -187,10 +209,11 @@ func (r *ModelRepository) GetByUserIDWithDetails(userID, providerID uint64) ([]m
 		SELECT
 			m.id, m.user_id, m.provider_id, m.model_id, m.display_name, m.is_active, m.context_length,
 			m.compress_enabled, m.compress_truncate_len, m.compress_user_count, m.compress_role_types,
+			m.input_price, m.output_price, m.cached_input_price, m.availability, m.deprecated, m.redirect_to, m.embeddings_enabled,
 			m.created_at, m.updated_at,
 			p.name as provider_name, p.display_name as provider_display_name,
 			p.base_url as provider_base_url, p.api_prefix as provider_api_prefix,
-			p.api_key as provider_api_key,
+			p.api_key as provider_api_key, p.type as provider_type, p.api_version as provider_api_version,
 			u.username
 		FROM models m
 		LEFT JOIN providers p ON m.provider_id = p.id
@@ -227,6 +250,13 @@ func (r *ModelRepository) GetByUserIDWithDetails(userID, providerID uint64) ([]m
 			&model.CompressTruncateLen,
 			&model.CompressUserCount,
 			&model.CompressRoleTypes,
+			&model.InputPrice,
+			&model.OutputPrice,
+			&model.CachedInputPrice,
+			&model.Availability,
+			&model.Deprecated,
+			&model.RedirectTo,
+			&model.EmbeddingsEnabled,
 			&model.CreatedAt,
 			&model.UpdatedAt,
 			&model.ProviderName,
@@ -234,6 +264,8 @@ func (r *ModelRepository) GetByUserIDWithDetails(userID, providerID uint64) ([]m
 			&model.ProviderBaseURL,
 			&model.ProviderAPIPrefix,
 			&model.ProviderKey,
+			&model.ProviderType,
+			&model.ProviderAPIVersion,
 			&model.Username,
 		); err != nil {
 			return nil, fmt.Errorf("扫描模型失败: %w", err)
@@ -249,13 +281,15 @@ func (r *ModelRepository) Update(model *models.Model) error {
 	query := `
 		UPDATE models
 		SET user_id = ?, provider_id = ?, model_id = ?, display_name = ?, is_active = ?, context_length = ?,
-			compress_enabled = ?, compress_truncate_len = ?, compress_user_count = ?, compress_role_types = ?
+			compress_enabled = ?, compress_truncate_len = ?, compress_user_count = ?, compress_role_types = ?,
+			input_price = ?, output_price = ?, cached_input_price = ?, availability = ?, deprecated = ?, redirect_to = ?, embeddings_enabled = ?
 		WHERE id = ?
 	`
 
 	_, err := models.DB.Exec(query,
 		model.UserID, model.ProviderID, model.ModelID, model.DisplayName, model.IsActive, model.ContextLength,
 		model.CompressEnabled, model.CompressTruncateLen, model.CompressUserCount, model.CompressRoleTypes,
+		model.InputPrice, model.OutputPrice, model.CachedInputPrice, model.Availability, model.Deprecated, model.RedirectTo, model.EmbeddingsEnabled,
 		model.ID)
 	if err != nil {
 		return fmt.Errorf("更新模型失败: %w", err)
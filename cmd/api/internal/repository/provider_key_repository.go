@@ -0,0 +1,144 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// ProviderKeyRepository 厂商密钥仓库
+type ProviderKeyRepository struct{}
+
+// NewProviderKeyRepository 创建厂商密钥仓库
+func NewProviderKeyRepository() *ProviderKeyRepository {
+	return &ProviderKeyRepository{}
+}
+
+// providerKeyColumns 厂商密钥查询字段
+const providerKeyColumns = `id, provider_id, name, api_key, weight, is_active, cooldown_seconds, created_at, updated_at`
+
+// scanProviderKeys 扫描厂商密钥查询结果
+func scanProviderKeys(rows *sql.Rows) ([]*models.ProviderKey, error) {
+	var keys []*models.ProviderKey
+	for rows.Next() {
+		key := &models.ProviderKey{}
+		if err := rows.Scan(
+			&key.ID,
+			&key.ProviderID,
+			&key.Name,
+			&key.APIKey,
+			&key.Weight,
+			&key.IsActive,
+			&key.CooldownSeconds,
+			&key.CreatedAt,
+			&key.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("扫描厂商密钥失败: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Create 创建厂商密钥
+func (r *ProviderKeyRepository) Create(key *models.ProviderKey) error {
+	query := `
+		INSERT INTO provider_keys (provider_id, name, api_key, weight, is_active, cooldown_seconds)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := models.DB.Exec(query, key.ProviderID, key.Name, key.APIKey, key.Weight, key.IsActive, key.CooldownSeconds)
+	if err != nil {
+		return fmt.Errorf("创建厂商密钥失败: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取厂商密钥ID失败: %w", err)
+	}
+
+	key.ID = uint64(id)
+	return nil
+}
+
+// GetByID 根据ID获取厂商密钥
+func (r *ProviderKeyRepository) GetByID(id uint64) (*models.ProviderKey, error) {
+	query := `SELECT ` + providerKeyColumns + ` FROM provider_keys WHERE id = ?`
+
+	key := &models.ProviderKey{}
+	err := models.DB.QueryRow(query, id).Scan(
+		&key.ID,
+		&key.ProviderID,
+		&key.Name,
+		&key.APIKey,
+		&key.Weight,
+		&key.IsActive,
+		&key.CooldownSeconds,
+		&key.CreatedAt,
+		&key.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询厂商密钥失败: %w", err)
+	}
+
+	return key, nil
+}
+
+// GetByProviderID 获取厂商的所有密钥
+func (r *ProviderKeyRepository) GetByProviderID(providerID uint64) ([]*models.ProviderKey, error) {
+	query := `SELECT ` + providerKeyColumns + ` FROM provider_keys WHERE provider_id = ? ORDER BY id ASC`
+
+	rows, err := models.DB.Query(query, providerID)
+	if err != nil {
+		return nil, fmt.Errorf("查询厂商密钥列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProviderKeys(rows)
+}
+
+// GetAll 获取所有厂商密钥
+func (r *ProviderKeyRepository) GetAll() ([]*models.ProviderKey, error) {
+	query := `SELECT ` + providerKeyColumns + ` FROM provider_keys ORDER BY provider_id ASC, id ASC`
+
+	rows, err := models.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("查询厂商密钥列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanProviderKeys(rows)
+}
+
+// Update 更新厂商密钥
+func (r *ProviderKeyRepository) Update(key *models.ProviderKey) error {
+	query := `
+		UPDATE provider_keys
+		SET name = ?, api_key = ?, weight = ?, is_active = ?, cooldown_seconds = ?
+		WHERE id = ?
+	`
+
+	_, err := models.DB.Exec(query, key.Name, key.APIKey, key.Weight, key.IsActive, key.CooldownSeconds, key.ID)
+	if err != nil {
+		return fmt.Errorf("更新厂商密钥失败: %w", err)
+	}
+
+	return nil
+}
+
+// Delete 删除厂商密钥
+func (r *ProviderKeyRepository) Delete(id uint64) error {
+	query := `DELETE FROM provider_keys WHERE id = ?`
+
+	_, err := models.DB.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("删除厂商密钥失败: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// QuotaRepository 用量配额仓库
+type QuotaRepository struct{}
+
+// NewQuotaRepository 创建用量配额仓库
+func NewQuotaRepository() *QuotaRepository {
+	return &QuotaRepository{}
+}
+
+// quotaColumns 用量配额查询字段
+const quotaColumns = `id, user_id, api_key_id, period, limit_type, limit_value, used_value, period_start, created_at, updated_at`
+
+// scanQuota 扫描单条用量配额
+func scanQuota(scanner interface{ Scan(...any) error }) (*models.Quota, error) {
+	quota := &models.Quota{}
+	err := scanner.Scan(
+		&quota.ID,
+		&quota.UserID,
+		&quota.APIKeyID,
+		&quota.Period,
+		&quota.LimitType,
+		&quota.LimitValue,
+		&quota.UsedValue,
+		&quota.PeriodStart,
+		&quota.CreatedAt,
+		&quota.UpdatedAt,
+	)
+	return quota, err
+}
+
+// scanQuotas 扫描用量配额查询结果
+func scanQuotas(rows *sql.Rows) ([]*models.Quota, error) {
+	var quotas []*models.Quota
+	for rows.Next() {
+		quota, err := scanQuota(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描用量配额失败: %w", err)
+		}
+		quotas = append(quotas, quota)
+	}
+
+	return quotas, nil
+}
+
+// Create 创建用量配额
+func (r *QuotaRepository) Create(quota *models.Quota) error {
+	query := `
+		INSERT INTO quotas (user_id, api_key_id, period, limit_type, limit_value, used_value, period_start)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := models.DB.Exec(query, quota.UserID, quota.APIKeyID, quota.Period, quota.LimitType,
+		quota.LimitValue, quota.UsedValue, quota.PeriodStart.Format("2006-01-02"))
+	if err != nil {
+		return fmt.Errorf("创建用量配额失败: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取用量配额ID失败: %w", err)
+	}
+
+	quota.ID = uint64(id)
+	return nil
+}
+
+// GetByID 根据ID获取用量配额
+func (r *QuotaRepository) GetByID(id uint64) (*models.Quota, error) {
+	query := `SELECT ` + quotaColumns + ` FROM quotas WHERE id = ?`
+
+	quota, err := scanQuota(models.DB.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("查询用量配额失败: %w", err)
+	}
+
+	return quota, nil
+}
+
+// GetByUserID 获取用户的所有用量配额（含该用户各API密钥的配额）
+func (r *QuotaRepository) GetByUserID(userID uint64) ([]*models.Quota, error) {
+	query := `SELECT ` + quotaColumns + ` FROM quotas WHERE user_id = ? ORDER BY api_key_id ASC, id ASC`
+
+	rows, err := models.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量配额列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotas(rows)
+}
+
+// GetAll 获取所有用量配额
+func (r *QuotaRepository) GetAll() ([]*models.Quota, error) {
+	query := `SELECT ` + quotaColumns + ` FROM quotas ORDER BY id ASC`
+
+	rows, err := models.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量配额列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	return scanQuotas(rows)
+}
+
+// UpdateLimit 更新用量配额上限
+func (r *QuotaRepository) UpdateLimit(id uint64, limitValue float64) error {
+	query := `UPDATE quotas SET limit_value = ? WHERE id = ?`
+
+	_, err := models.DB.Exec(query, limitValue, id)
+	if err != nil {
+		return fmt.Errorf("更新用量配额失败: %w", err)
+	}
+
+	return nil
+}
+
+// AddUsage 累加当前周期的已用量，周期变化时从本次用量重新计数
+// 异步写入可能乱序到达，早于已记录周期的用量直接忽略，不会重置新周期的计数
+func (r *QuotaRepository) AddUsage(id uint64, periodStart time.Time, amount float64) error {
+	query := `
+		UPDATE quotas
+		SET used_value = IF(period_start = ?, used_value + ?, ?), period_start = ?
+		WHERE id = ? AND period_start <= ?
+	`
+
+	day := periodStart.Format("2006-01-02")
+	_, err := models.DB.Exec(query, day, amount, amount, day, id, day)
+	if err != nil {
+		return fmt.Errorf("更新配额用量失败: %w", err)
+	}
+
+	return nil
+}
+
+// Delete 删除用量配额
+func (r *QuotaRepository) Delete(id uint64) error {
+	query := `DELETE FROM quotas WHERE id = ?`
+
+	_, err := models.DB.Exec(query, id)
+	if err != nil {
+		return fmt.Errorf("删除用量配额失败: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteByAPIKeyID 删除API密钥的所有配额
+func (r *QuotaRepository) DeleteByAPIKeyID(apiKeyID uint64) error {
+	query := `DELETE FROM quotas WHERE api_key_id = ?`
+
+	_, err := models.DB.Exec(query, apiKeyID)
+	if err != nil {
+		return fmt.Errorf("删除用量配额失败: %w", err)
+	}
+
+	return nil
+}
@@ -156,11 +156,12 @@ func NewAPIKeyRepository() *APIKeyRepository {
 // Create 创建API密钥
 func (r *APIKeyRepository) Create(apiKey *models.APIKey) error {
 	query := `
-		INSERT INTO api_keys (user_id, key_name, api_key, prompt)
-		VALUES (?, ?, ?, ?)
+		INSERT INTO api_keys (user_id, key_name, api_key, prompt, rpm_limit, tpm_limit, max_concurrent_streams)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := models.DB.Exec(query, apiKey.UserID, apiKey.KeyName, apiKey.APIKey, apiKey.Prompt)
+	result, err := models.DB.Exec(query, apiKey.UserID, apiKey.KeyName, apiKey.APIKey, apiKey.Prompt,
+		apiKey.RPMLimit, apiKey.TPMLimit, apiKey.MaxConcurrentStreams)
 	if err != nil {
 		return fmt.Errorf("创建API密钥失败: %w", err)
 	}
@@ -177,7 +178,7 @@ func (r *APIKeyRepository) Create(apiKey *models.APIKey) error {
 // GetByID 根据ID获取API密钥
 func (r *APIKeyRepository) GetByID(id uint64) (*models.APIKey, error) {
 	query := `
-		SELECT id, user_id, key_name, api_key, prompt, created_at, updated_at
+		SELECT id, user_id, key_name, api_key, prompt, rpm_limit, tpm_limit, max_concurrent_streams, created_at, updated_at
 		FROM api_keys
 		WHERE id = ?
 	`
@@ -190,6 +191,9 @@ func (r *APIKeyRepository) GetByID(id uint64) (*models.APIKey, error) {
 		&apiKey.KeyName,
 		&apiKey.APIKey,
 		&promptBytes,
+		&apiKey.RPMLimit,
+		&apiKey.TPMLimit,
+		&apiKey.MaxConcurrentStreams,
 		&apiKey.CreatedAt,
 		&apiKey.UpdatedAt,
 	)
@@ -250,7 +254,7 @@ func (r *APIKeyRepository) GetByAPIKey(apiKeyValue string) (*models.APIKey, erro
 // GetByUserID 获取用户的所有API密钥
 func (r *APIKeyRepository) GetByUserID(userID uint64) ([]*models.APIKey, error) {
 	query := `
-		SELECT id, user_id, key_name, api_key, prompt, created_at, updated_at
+		SELECT id, user_id, key_name, api_key, prompt, rpm_limit, tpm_limit, max_concurrent_streams, created_at, updated_at
 		FROM api_keys
 		WHERE user_id = ?
 		ORDER BY created_at DESC
@@ -272,6 +276,9 @@ func (r *APIKeyRepository) GetByUserID(userID uint64) ([]*models.APIKey, error)
 			&apiKey.KeyName,
 			&apiKey.APIKey,
 			&promptBytes,
+			&apiKey.RPMLimit,
+			&apiKey.TPMLimit,
+			&apiKey.MaxConcurrentStreams,
 			&apiKey.CreatedAt,
 			&apiKey.UpdatedAt,
 		); err != nil {
@@ -297,14 +304,14 @@ func (r *APIKeyRepository) Delete(id uint64) error {
 }
 
 // UpdateAPIKey 更新API密钥基本信息
-func (r *APIKeyRepository) UpdateAPIKey(id uint64, keyName string, prompt string) error {
+func (r *APIKeyRepository) UpdateAPIKey(id uint64, keyName string, prompt string, limits models.APIKeyLimits) error {
 	query := `
 		UPDATE api_keys
-		SET key_name = ?, prompt = ?
+		SET key_name = ?, prompt = ?, rpm_limit = ?, tpm_limit = ?, max_concurrent_streams = ?
 		WHERE id = ?
 	`
 
-	_, err := models.DB.Exec(query, keyName, prompt, id)
+	_, err := models.DB.Exec(query, keyName, prompt, limits.RPMLimit, limits.TPMLimit, limits.MaxConcurrentStreams, id)
 	if err != nil {
 		return fmt.Errorf("更新API密钥失败: %w", err)
 	}
@@ -323,11 +330,13 @@ func NewProviderRepository() *ProviderRepository {
 // Create 创建厂商
 func (r *ProviderRepository) Create(provider *models.Provider) error {
 	query := `
-		INSERT INTO providers (name, display_name, base_url, api_prefix, api_key)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO providers (name, display_name, base_url, api_prefix, api_key, type, api_version,
+			connect_timeout, first_byte_timeout, stream_idle_timeout, max_retries, retry_backoff_ms, retry_status_codes)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
-	result, err := models.DB.Exec(query, provider.Name, provider.DisplayName, provider.BaseURL, provider.APIPrefix, provider.APIKey)
+	result, err := models.DB.Exec(query, provider.Name, provider.DisplayName, provider.BaseURL, provider.APIPrefix, provider.APIKey, provider.Type, provider.APIVersion,
+		provider.ConnectTimeout, provider.FirstByteTimeout, provider.StreamIdleTimeout, provider.MaxRetries, provider.RetryBackoffMs, provider.RetryStatusCodes)
 	if err != nil {
 		return fmt.Errorf("创建厂商失败: %w", err)
 	}
@@ -344,7 +353,9 @@ func (r *ProviderRepository) Create(provider *models.Provider) error {
 // GetByID 根据ID获取厂商
 func (r *ProviderRepository) GetByID(id uint64) (*models.Provider, error) {
 	query := `
-		SELECT id, name, display_name, base_url, api_prefix, api_key, created_at, updated_at
+		SELECT id, name, display_name, base_url, api_prefix, api_key, type, api_version,
+			connect_timeout, first_byte_timeout, stream_idle_timeout, max_retries, retry_backoff_ms, retry_status_codes,
+			created_at, updated_at
 		FROM providers
 		WHERE id = ?
 	`
@@ -357,6 +368,14 @@ func (r *ProviderRepository) GetByID(id uint64) (*models.Provider, error) {
 		&provider.BaseURL,
 		&provider.APIPrefix,
 		&provider.APIKey,
+		&provider.Type,
+		&provider.APIVersion,
+		&provider.ConnectTimeout,
+		&provider.FirstByteTimeout,
+		&provider.StreamIdleTimeout,
+		&provider.MaxRetries,
+		&provider.RetryBackoffMs,
+		&provider.RetryStatusCodes,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -373,7 +392,9 @@ func (r *ProviderRepository) GetByID(id uint64) (*models.Provider, error) {
 // GetByName 根据名称获取厂商
 func (r *ProviderRepository) GetByName(name string) (*models.Provider, error) {
 	query := `
-		SELECT id, name, display_name, base_url, api_prefix, api_key, created_at, updated_at
+		SELECT id, name, display_name, base_url, api_prefix, api_key, type, api_version,
+			connect_timeout, first_byte_timeout, stream_idle_timeout, max_retries, retry_backoff_ms, retry_status_codes,
+			created_at, updated_at
 		FROM providers
 		WHERE name = ?
 	`
@@ -386,6 +407,14 @@ func (r *ProviderRepository) GetByName(name string) (*models.Provider, error) {
 		&provider.BaseURL,
 		&provider.APIPrefix,
 		&provider.APIKey,
+		&provider.Type,
+		&provider.APIVersion,
+		&provider.ConnectTimeout,
+		&provider.FirstByteTimeout,
+		&provider.StreamIdleTimeout,
+		&provider.MaxRetries,
+		&provider.RetryBackoffMs,
+		&provider.RetryStatusCodes,
 		&provider.CreatedAt,
 		&provider.UpdatedAt,
 	)
@@ -402,7 +431,9 @@ func (r *ProviderRepository) GetByName(name string) (*models.Provider, error) {
 // GetAll 获取所有厂商
 func (r *ProviderRepository) GetAll() ([]*models.Provider, error) {
 	query := `
-		SELECT id, name, display_name, base_url, api_prefix, api_key, created_at, updated_at
+		SELECT id, name, display_name, base_url, api_prefix, api_key, type, api_version,
+			connect_timeout, first_byte_timeout, stream_idle_timeout, max_retries, retry_backoff_ms, retry_status_codes,
+			created_at, updated_at
 		FROM providers
 		ORDER BY name ASC
 	`
@@ -424,6 +455,14 @@ func (r *ProviderRepository) GetAll() ([]*models.Provider, error) {
 			&provider.BaseURL,
 			&provider.APIPrefix,
 			&provider.APIKey,
+			&provider.Type,
+			&provider.APIVersion,
+			&provider.ConnectTimeout,
+			&provider.FirstByteTimeout,
+			&provider.StreamIdleTimeout,
+			&provider.MaxRetries,
+			&provider.RetryBackoffMs,
+			&provider.RetryStatusCodes,
 			&provider.CreatedAt,
 			&provider.UpdatedAt,
 		); err != nil {
@@ -439,11 +478,13 @@ func (r *ProviderRepository) GetAll() ([]*models.Provider, error) {
 func (r *ProviderRepository) Update(provider *models.Provider) error {
 	query := `
 		UPDATE providers
-		SET name = ?, display_name = ?, base_url = ?, api_prefix = ?, api_key = ?
+		SET name = ?, display_name = ?, base_url = ?, api_prefix = ?, api_key = ?, type = ?, api_version = ?,
+			connect_timeout = ?, first_byte_timeout = ?, stream_idle_timeout = ?, max_retries = ?, retry_backoff_ms = ?, retry_status_codes = ?
 		WHERE id = ?
 	`
 
-	_, err := models.DB.Exec(query, provider.Name, provider.DisplayName, provider.BaseURL, provider.APIPrefix, provider.APIKey, provider.ID)
+	_, err := models.DB.Exec(query, provider.Name, provider.DisplayName, provider.BaseURL, provider.APIPrefix, provider.APIKey, provider.Type, provider.APIVersion,
+		provider.ConnectTimeout, provider.FirstByteTimeout, provider.StreamIdleTimeout, provider.MaxRetries, provider.RetryBackoffMs, provider.RetryStatusCodes, provider.ID)
 	if err != nil {
 		return fmt.Errorf("更新厂商失败: %w", err)
 	}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"fmt"
+
+	"github.com/model-system/api/internal/models"
+)
+
+// UsageRepository 用量记录仓库
+type UsageRepository struct{}
+
+// NewUsageRepository 创建用量记录仓库
+func NewUsageRepository() *UsageRepository {
+	return &UsageRepository{}
+}
+
+// Create 创建用量记录
+func (r *UsageRepository) Create(record *models.UsageRecord) error {
+	query := `
+		INSERT INTO usage_records (user_id, api_key_id, model_id, model_name, upstream_model, provider_id, is_stream,
+			prompt_tokens, completion_tokens, total_tokens, original_tokens, compressed_tokens, saved_tokens,
+			usage_estimated, latency_ms, status_code, fallback_index, cached_tokens, cost, saved_cost, outcome)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+	result, err := models.DB.Exec(query,
+		record.UserID, record.APIKeyID, record.ModelID, record.ModelName, record.UpstreamModel, record.ProviderID, record.IsStream,
+		record.PromptTokens, record.CompletionTokens, record.TotalTokens, record.OriginalTokens, record.CompressedTokens, record.SavedTokens,
+		record.UsageEstimated, record.LatencyMs, record.StatusCode, record.FallbackIndex, record.CachedTokens, record.Cost, record.SavedCost, record.Outcome)
+	if err != nil {
+		return fmt.Errorf("创建用量记录失败: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("获取用量记录ID失败: %w", err)
+	}
+
+	record.ID = uint64(id)
+	return nil
+}
+
+// usageGroupColumns 聚合维度 -> (分组键, 显示名)
+var usageGroupColumns = map[string][2]string{
+	"day":      {"DATE_FORMAT(u.created_at, '%Y-%m-%d')", "DATE_FORMAT(u.created_at, '%Y-%m-%d')"},
+	"model":    {"u.model_name", "u.model_name"},
+	"api_key":  {"CAST(u.api_key_id AS CHAR)", "COALESCE(k.key_name, '')"},
+	"provider": {"CAST(u.provider_id AS CHAR)", "COALESCE(p.display_name, '')"},
+}
+
+// IsValidGroupBy 检查聚合维度是否支持
+func IsValidGroupBy(groupBy string) bool {
+	_, ok := usageGroupColumns[groupBy]
+	return ok
+}
+
+// buildUsageWhere 根据查询条件构建 WHERE 子句
+func buildUsageWhere(q *models.UsageQuery) (string, []interface{}) {
+	where := ` WHERE u.user_id = ? AND u.created_at >= ? AND u.created_at < ?`
+	args := []interface{}{q.UserID, q.StartTime, q.EndTime}
+
+	if q.APIKeyID > 0 {
+		where += ` AND u.api_key_id = ?`
+		args = append(args, q.APIKeyID)
+	}
+	if q.ModelID > 0 {
+		where += ` AND u.model_id = ?`
+		args = append(args, q.ModelID)
+	}
+	if q.ProviderID > 0 {
+		where += ` AND u.provider_id = ?`
+		args = append(args, q.ProviderID)
+	}
+
+	return where, args
+}
+
+// Aggregate 按指定维度聚合用量
+// groupBy 取值：day、model、api_key、provider
+func (r *UsageRepository) Aggregate(q *models.UsageQuery, groupBy string) ([]models.UsageAggregate, error) {
+	columns, ok := usageGroupColumns[groupBy]
+	if !ok {
+		return nil, fmt.Errorf("不支持的聚合维度: %s", groupBy)
+	}
+
+	where, args := buildUsageWhere(q)
+	query := `
+		SELECT
+			` + columns[0] + ` AS group_key,
+			` + columns[1] + ` AS group_label,
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN u.status_code <> 200 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(u.prompt_tokens), 0),
+			COALESCE(SUM(u.completion_tokens), 0),
+			COALESCE(SUM(u.total_tokens), 0),
+			COALESCE(SUM(u.original_tokens), 0),
+			COALESCE(SUM(u.compressed_tokens), 0),
+			COALESCE(SUM(u.saved_tokens), 0),
+			COALESCE(SUM(u.cost), 0),
+			COALESCE(SUM(u.saved_cost), 0),
+			COALESCE(AVG(u.latency_ms), 0)
+		FROM usage_records u
+		LEFT JOIN api_keys k ON u.api_key_id = k.id
+		LEFT JOIN providers p ON u.provider_id = p.id
+	` + where + `
+		GROUP BY group_key, group_label
+		ORDER BY group_key ASC
+	`
+
+	rows, err := models.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量统计失败: %w", err)
+	}
+	defer rows.Close()
+
+	result := []models.UsageAggregate{}
+	for rows.Next() {
+		item := models.UsageAggregate{}
+		if err := rows.Scan(
+			&item.Key,
+			&item.Label,
+			&item.Requests,
+			&item.FailedRequests,
+			&item.PromptTokens,
+			&item.CompletionTokens,
+			&item.TotalTokens,
+			&item.OriginalTokens,
+			&item.CompressedTokens,
+			&item.SavedTokens,
+			&item.Cost,
+			&item.SavedCost,
+			&item.AvgLatencyMs,
+		); err != nil {
+			return nil, fmt.Errorf("扫描用量统计失败: %w", err)
+		}
+		result = append(result, item)
+	}
+
+	return result, nil
+}
+
+// Summary 汇总用量
+func (r *UsageRepository) Summary(q *models.UsageQuery) (*models.UsageSummary, error) {
+	where, args := buildUsageWhere(q)
+	query := `
+		SELECT
+			COUNT(*),
+			COALESCE(SUM(CASE WHEN u.status_code <> 200 THEN 1 ELSE 0 END), 0),
+			COALESCE(SUM(u.prompt_tokens), 0),
+			COALESCE(SUM(u.completion_tokens), 0),
+			COALESCE(SUM(u.total_tokens), 0),
+			COALESCE(SUM(u.original_tokens), 0),
+			COALESCE(SUM(u.compressed_tokens), 0),
+			COALESCE(SUM(u.saved_tokens), 0),
+			COALESCE(SUM(u.cost), 0),
+			COALESCE(SUM(u.saved_cost), 0),
+			COALESCE(AVG(u.latency_ms), 0)
+		FROM usage_records u
+	` + where
+
+	summary := &models.UsageSummary{
+		StartTime: q.StartTime,
+		EndTime:   q.EndTime,
+	}
+	err := models.DB.QueryRow(query, args...).Scan(
+		&summary.Requests,
+		&summary.FailedRequests,
+		&summary.PromptTokens,
+		&summary.CompletionTokens,
+		&summary.TotalTokens,
+		&summary.OriginalTokens,
+		&summary.CompressedTokens,
+		&summary.SavedTokens,
+		&summary.Cost,
+		&summary.SavedCost,
+		&summary.AvgLatencyMs,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("查询用量汇总失败: %w", err)
+	}
+
+	if summary.OriginalTokens > 0 {
+		summary.SavedPercent = float64(summary.SavedTokens) * 100 / float64(summary.OriginalTokens)
+	}
+
+	return summary, nil
+}
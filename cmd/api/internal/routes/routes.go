@@ -28,6 +28,9 @@ func SetupRoutes(e *echo.Echo, cfg *config.Config, jwtExpiration time.Duration)
 	// 创建处理器
 	h := handlers.NewHandler(cfg)
 
+	// 启动熔断厂商的后台健康探测
+	h.StartHealthChecks()
+
 	// 路由分组
 	api := e.Group("/api")
 
@@ -66,6 +69,13 @@ func SetupRoutes(e *echo.Echo, cfg *config.Config, jwtExpiration time.Duration)
 	providers.GET("/:id", h.GetProvider)
 	providers.PUT("/:id", h.UpdateProvider)
 	providers.DELETE("/:id", h.DeleteProvider)
+	providers.GET("/:id/health", h.GetProviderHealth)
+	providers.POST("/:id/test", h.TestProvider)
+	providers.POST("/:id/import-models", h.ImportProviderModels)
+	providers.GET("/:id/keys", h.GetProviderKeys)
+	providers.POST("/:id/keys", h.CreateProviderKey)
+	providers.PUT("/:id/keys/:keyId", h.UpdateProviderKey)
+	providers.DELETE("/:id/keys/:keyId", h.DeleteProviderKey)
 
 	// ========== 模型管理 ==========
 	models := api.Group("/models")
@@ -75,6 +85,22 @@ func SetupRoutes(e *echo.Echo, cfg *config.Config, jwtExpiration time.Duration)
 	models.GET("/:id", h.GetModel)
 	models.PUT("/:id", h.UpdateModel)
 	models.DELETE("/:id", h.DeleteModel)
+	models.GET("/:id/fallbacks", h.GetModelFallbacks)
+	models.PUT("/:id/fallbacks", h.UpdateModelFallbacks)
+
+	// ========== 用量统计 ==========
+	usage := api.Group("/usage")
+	usage.Use(middleware.JWTMiddleware(cfg.JWT.Secret, jwtExpiration))
+	usage.GET("", h.GetUsage)
+	usage.GET("/summary", h.GetUsageSummary)
+
+	// 用量配额路由（需要JWT认证）
+	quotas := api.Group("/quotas")
+	quotas.Use(middleware.JWTMiddleware(cfg.JWT.Secret, jwtExpiration))
+	quotas.GET("", h.GetQuotas)
+	quotas.POST("", h.CreateQuota)
+	quotas.PUT("/:id", h.UpdateQuota)
+	quotas.DELETE("/:id", h.DeleteQuota)
 
 	// ========== 管理员路由 ==========
 	admin := api.Group("/admin")
@@ -82,9 +108,12 @@ func SetupRoutes(e *echo.Echo, cfg *config.Config, jwtExpiration time.Duration)
 	admin.GET("/models", h.GetAllModels)
 	admin.POST("/models/refresh", h.RefreshModelCache)
 
-	// ========== Chat Completion 路由（无需认证，通过API密钥验证）==========
-	chat := api.Group("/v1/chat")
-	chat.POST("/completions", h.ChatCompletion)
+	// ========== OpenAI 兼容路由（无需认证，通过API密钥验证）==========
+	// 兼容旧路径 /api/v1
+	setupOpenAIRoutes(api.Group("/v1"), h)
+
+	// 标准路径（默认 /v1），SDK 可直接使用 base_url=http://host:port/v1
+	setupOpenAIRoutes(e.Group(cfg.Proxy.BasePath), h)
 
 	// ========== 用户页面路由 ==========
 	user := e.Group("/user")
@@ -101,3 +130,21 @@ func SetupRoutes(e *echo.Echo, cfg *config.Config, jwtExpiration time.Duration)
 	// ========== 任意路径路由（调试用）==========
 	e.GET("/*", h.DebugPath)
 }
+
+// setupOpenAIRoutes 注册 OpenAI 兼容接口
+func setupOpenAIRoutes(g *echo.Group, h *handlers.Handler) {
+	g.POST("/chat/completions", h.ChatCompletion)
+	// Anthropic 兼容接口，与聊天补全共用代理流程
+	g.POST("/messages", h.Messages)
+	g.POST("/responses", h.Responses)
+	g.POST("/completions", h.Completions)
+	g.POST("/embeddings", h.Embeddings)
+	g.POST("/images/generations", h.ImageGenerations)
+	g.POST("/audio/speech", h.AudioSpeech)
+	g.POST("/audio/transcriptions", h.AudioTranscriptions)
+	g.POST("/moderations", h.Moderations)
+	g.GET("/models", h.ListOpenAIModels)
+	g.GET("/models/*", h.GetOpenAIModel)
+	// 未匹配的路径返回 OpenAI 格式的 404
+	g.Any("/*", h.OpenAINotFound)
+}
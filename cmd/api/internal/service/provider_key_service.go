@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/repository"
+)
+
+// ErrProviderKeyNotFound 厂商密钥不存在
+var ErrProviderKeyNotFound = errors.New("厂商密钥不存在")
+
+// 厂商密钥默认配置
+const (
+	defaultProviderKeyWeight   = 1
+	defaultProviderKeyCooldown = 60
+)
+
+// ProviderKeyService 厂商密钥服务
+type ProviderKeyService struct {
+	keyRepo      *repository.ProviderKeyRepository
+	providerRepo *repository.ProviderRepository
+	cache        *cache.MemoryCache
+}
+
+// NewProviderKeyService 创建厂商密钥服务
+func NewProviderKeyService() *ProviderKeyService {
+	return &ProviderKeyService{
+		keyRepo:      repository.NewProviderKeyRepository(),
+		providerRepo: repository.NewProviderRepository(),
+		cache:        cache.GetCache(),
+	}
+}
+
+// InitCache 加载所有厂商密钥到缓存
+func (s *ProviderKeyService) InitCache() (int, error) {
+	keys, err := s.keyRepo.GetAll()
+	if err != nil {
+		return 0, err
+	}
+	s.cache.LoadProviderKeys(keys)
+	return len(keys), nil
+}
+
+// refreshProvider 重新加载厂商的密钥池
+func (s *ProviderKeyService) refreshProvider(providerID uint64) error {
+	keys, err := s.keyRepo.GetByProviderID(providerID)
+	if err != nil {
+		return err
+	}
+	s.cache.SetProviderKeys(providerID, keys)
+	return nil
+}
+
+// checkProvider 检查厂商是否存在
+func (s *ProviderKeyService) checkProvider(providerID uint64) error {
+	provider, err := s.providerRepo.GetByID(providerID)
+	if err != nil {
+		return fmt.Errorf("查询厂商失败: %w", err)
+	}
+	if provider == nil {
+		return ErrProviderNotFound
+	}
+	return nil
+}
+
+// normalize 校验并补全密钥配置
+func (s *ProviderKeyService) normalize(key *models.ProviderKey) error {
+	if key.APIKey == "" {
+		return errors.New("API密钥不能为空")
+	}
+	if key.Weight < 0 || key.CooldownSeconds < 0 {
+		return errors.New("权重和冷却时间不能为负数")
+	}
+	if key.Weight == 0 {
+		key.Weight = defaultProviderKeyWeight
+	}
+	if key.CooldownSeconds == 0 {
+		key.CooldownSeconds = defaultProviderKeyCooldown
+	}
+	return nil
+}
+
+// List 获取厂商的所有密钥（含冷却状态）
+func (s *ProviderKeyService) List(providerID uint64) ([]models.ProviderKeyWithStatus, error) {
+	if err := s.checkProvider(providerID); err != nil {
+		return nil, err
+	}
+
+	keys, err := s.keyRepo.GetByProviderID(providerID)
+	if err != nil {
+		return nil, err
+	}
+
+	cooldowns := s.cache.GetProviderKeyCooldowns(providerID)
+	result := make([]models.ProviderKeyWithStatus, 0, len(keys))
+	for _, key := range keys {
+		item := models.ProviderKeyWithStatus{ProviderKey: *key}
+		if until, ok := cooldowns[key.ID]; ok {
+			item.CoolingDown = true
+			item.CooldownUntil = &until
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// GetByID 获取厂商下的单个密钥
+func (s *ProviderKeyService) GetByID(providerID, keyID uint64) (*models.ProviderKey, error) {
+	key, err := s.keyRepo.GetByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || key.ProviderID != providerID {
+		return nil, ErrProviderKeyNotFound
+	}
+	return key, nil
+}
+
+// Create 创建厂商密钥
+func (s *ProviderKeyService) Create(key *models.ProviderKey) error {
+	if err := s.checkProvider(key.ProviderID); err != nil {
+		return err
+	}
+	if err := s.normalize(key); err != nil {
+		return err
+	}
+
+	if err := s.keyRepo.Create(key); err != nil {
+		return err
+	}
+	return s.refreshProvider(key.ProviderID)
+}
+
+// Update 更新厂商密钥
+func (s *ProviderKeyService) Update(key *models.ProviderKey) error {
+	if err := s.normalize(key); err != nil {
+		return err
+	}
+
+	if err := s.keyRepo.Update(key); err != nil {
+		return err
+	}
+	return s.refreshProvider(key.ProviderID)
+}
+
+// Delete 删除厂商密钥
+func (s *ProviderKeyService) Delete(providerID, keyID uint64) error {
+	if _, err := s.GetByID(providerID, keyID); err != nil {
+		return err
+	}
+
+	if err := s.keyRepo.Delete(keyID); err != nil {
+		return err
+	}
+	return s.refreshProvider(providerID)
+}
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/model-system/api/internal/cache"
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/repository"
+)
+
+// ErrQuotaNotFound 用量配额不存在
+var ErrQuotaNotFound = errors.New("用量配额不存在")
+
+// QuotaExceededError 配额已用尽
+type QuotaExceededError struct {
+	Quota models.Quota
+}
+
+// Error 返回配额用尽的描述
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("配额已用尽 (quota_id: %d, period: %s, limit_type: %s, limit: %g, used: %g)",
+		e.Quota.ID, e.Quota.Period, e.Quota.LimitType, e.Quota.LimitValue, e.Quota.UsedValue)
+}
+
+// QuotaService 用量配额服务
+type QuotaService struct {
+	quotaRepo  *repository.QuotaRepository
+	apiKeyRepo *repository.APIKeyRepository
+	cache      *cache.MemoryCache
+}
+
+// NewQuotaService 创建用量配额服务
+func NewQuotaService() *QuotaService {
+	return &QuotaService{
+		quotaRepo:  repository.NewQuotaRepository(),
+		apiKeyRepo: repository.NewAPIKeyRepository(),
+		cache:      cache.GetCache(),
+	}
+}
+
+// InitCache 加载所有用量配额到缓存
+func (s *QuotaService) InitCache() (int, error) {
+	quotas, err := s.quotaRepo.GetAll()
+	if err != nil {
+		return 0, err
+	}
+	s.cache.LoadQuotas(quotas)
+	return len(quotas), nil
+}
+
+// List 获取用户的所有配额（含各API密钥的配额），已用量以缓存为准
+func (s *QuotaService) List(userID uint64) ([]models.Quota, error) {
+	quotas, err := s.quotaRepo.GetByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cached := make(map[uint64]models.Quota)
+	for _, quota := range s.cache.GetUserQuotas(userID) {
+		cached[quota.ID] = quota
+	}
+
+	now := time.Now()
+	result := make([]models.Quota, 0, len(quotas))
+	for _, quota := range quotas {
+		if item, ok := cached[quota.ID]; ok {
+			result = append(result, item)
+			continue
+		}
+		quota.Refresh(now)
+		result = append(result, *quota)
+	}
+	return result, nil
+}
+
+// GetAPIKeyQuotas 获取作用于API密钥的配额（含用户级配额）
+func (s *QuotaService) GetAPIKeyQuotas(userID, apiKeyID uint64) []models.Quota {
+	return s.cache.GetQuotas(userID, apiKeyID)
+}
+
+// validate 校验配额参数
+func (s *QuotaService) validate(period, limitType string, limitValue float64) error {
+	if period != models.QuotaPeriodDaily && period != models.QuotaPeriodMonthly {
+		return fmt.Errorf("不支持的统计周期: %s", period)
+	}
+	if limitType != models.QuotaLimitTokens && limitType != models.QuotaLimitCost {
+		return fmt.Errorf("不支持的限额类型: %s", limitType)
+	}
+	if limitValue <= 0 {
+		return errors.New("配额上限必须大于0")
+	}
+	return nil
+}
+
+// Create 创建用量配额，apiKeyID 为 0 时作用于用户的所有密钥
+func (s *QuotaService) Create(userID, apiKeyID uint64, period, limitType string, limitValue float64) (*models.Quota, error) {
+	if err := s.validate(period, limitType, limitValue); err != nil {
+		return nil, err
+	}
+
+	if apiKeyID != 0 {
+		apiKey, err := s.apiKeyRepo.GetByID(apiKeyID)
+		if err != nil {
+			return nil, fmt.Errorf("查找API密钥失败: %w", err)
+		}
+		if apiKey == nil || apiKey.UserID != userID {
+			return nil, errors.New("API密钥不存在")
+		}
+	}
+
+	for _, existing := range s.cache.GetUserQuotas(userID) {
+		if existing.APIKeyID == apiKeyID && existing.Period == period && existing.LimitType == limitType {
+			return nil, errors.New("相同范围和周期的配额已存在")
+		}
+	}
+
+	now := time.Now()
+	quota := &models.Quota{
+		UserID:      userID,
+		APIKeyID:    apiKeyID,
+		Period:      period,
+		LimitType:   limitType,
+		LimitValue:  limitValue,
+		PeriodStart: models.QuotaPeriodStart(period, now),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.quotaRepo.Create(quota); err != nil {
+		return nil, err
+	}
+
+	s.cache.SetQuota(quota)
+	quota.Refresh(now)
+	return quota, nil
+}
+
+// getOwned 获取属于用户的配额
+func (s *QuotaService) getOwned(userID, quotaID uint64) (*models.Quota, error) {
+	quota, err := s.quotaRepo.GetByID(quotaID)
+	if err != nil {
+		return nil, err
+	}
+	if quota == nil || quota.UserID != userID {
+		return nil, ErrQuotaNotFound
+	}
+	return quota, nil
+}
+
+// UpdateLimit 更新配额上限
+func (s *QuotaService) UpdateLimit(userID, quotaID uint64, limitValue float64) (*models.Quota, error) {
+	quota, err := s.getOwned(userID, quotaID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(quota.Period, quota.LimitType, limitValue); err != nil {
+		return nil, err
+	}
+
+	if err := s.quotaRepo.UpdateLimit(quotaID, limitValue); err != nil {
+		return nil, err
+	}
+
+	// 保留缓存中尚未持久化的已用量和进行中请求的预占
+	for _, cached := range s.cache.GetUserQuotas(userID) {
+		if cached.ID == quotaID {
+			quota.UsedValue = cached.UsedValue
+			quota.PeriodStart = cached.PeriodStart
+			quota.Reserved = cached.Reserved
+		}
+	}
+	quota.LimitValue = limitValue
+	s.cache.SetQuota(quota)
+	quota.Refresh(time.Now())
+	return quota, nil
+}
+
+// Delete 删除配额
+func (s *QuotaService) Delete(userID, quotaID uint64) error {
+	if _, err := s.getOwned(userID, quotaID); err != nil {
+		return err
+	}
+
+	if err := s.quotaRepo.Delete(quotaID); err != nil {
+		return err
+	}
+
+	s.cache.DeleteQuota(quotaID)
+	return nil
+}
+
+// DeleteByAPIKey 删除API密钥的所有配额（API密钥删除时调用）
+func (s *QuotaService) DeleteByAPIKey(apiKeyID uint64) error {
+	if apiKeyID == 0 {
+		return nil
+	}
+	if err := s.quotaRepo.DeleteByAPIKeyID(apiKeyID); err != nil {
+		return err
+	}
+
+	s.cache.DeleteAPIKeyQuotas(apiKeyID)
+	return nil
+}
+
+// Reserve 检查用户和API密钥的配额并预占本次请求的预估 token 数和费用
+// 任一配额扣除进行中请求的预占后不足以容纳本次请求时返回 *QuotaExceededError
+// 返回的预占需在请求结束后传给 Consume 结算
+func (s *QuotaService) Reserve(userID, apiKeyID uint64, tokens int, cost float64) (cache.QuotaReservation, error) {
+	amounts := map[string]float64{
+		models.QuotaLimitTokens: float64(tokens),
+		models.QuotaLimitCost:   cost,
+	}
+
+	reservation, exceeded := s.cache.ReserveQuotas(userID, apiKeyID, amounts)
+	if exceeded != nil {
+		return nil, &QuotaExceededError{Quota: *exceeded}
+	}
+	return reservation, nil
+}
+
+// Consume 释放请求的预占，按用量记录扣减配额，并异步持久化已用量
+func (s *QuotaService) Consume(record *models.UsageRecord, reservation cache.QuotaReservation) {
+	amounts := map[string]float64{
+		models.QuotaLimitTokens: float64(record.TotalTokens),
+		models.QuotaLimitCost:   record.Cost,
+	}
+
+	updated := s.cache.AddQuotaUsage(record.UserID, record.APIKeyID, amounts, reservation)
+	if len(updated) == 0 {
+		return
+	}
+
+	go func() {
+		for _, quota := range updated {
+			if err := s.quotaRepo.AddUsage(quota.ID, quota.PeriodStart, amounts[quota.LimitType]); err != nil {
+				log.Printf("[WARN] 更新配额用量失败 (quota_id: %d): %v", quota.ID, err)
+			}
+		}
+	}()
+}
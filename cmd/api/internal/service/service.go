@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/model-system/api/internal/cache"
 	"github.com/model-system/api/internal/models"
@@ -18,6 +19,7 @@ var (
 	ErrUserAlreadyExist = errors.New("用户已存在")
 	ErrModelNotFound    = errors.New("模型不存在")
 	ErrProviderNotFound = errors.New("厂商不存在")
+	ErrInvalidProviderType = errors.New("不支持的厂商类型")
 )
 
 // UserService 用户服务
@@ -114,7 +116,7 @@ func NewAPIKeyService() *APIKeyService {
 }
 
 // GenerateAPIKey 生成API密钥
-func (s *APIKeyService) GenerateAPIKey(userID uint64, keyName string, prompt string) (*models.APIKey, error) {
+func (s *APIKeyService) GenerateAPIKey(userID uint64, keyName string, prompt string, limits models.APIKeyLimits) (*models.APIKey, error) {
 	var apiKeyValue string
 
 	// 生成随机密钥，直到在缓存中不存在
@@ -133,10 +135,11 @@ func (s *APIKeyService) GenerateAPIKey(userID uint64, keyName string, prompt str
 	}
 
 	apiKey := &models.APIKey{
-		UserID:  userID,
-		KeyName: keyName,
-		APIKey:  apiKeyValue,
-		Prompt:  prompt,
+		UserID:       userID,
+		KeyName:      keyName,
+		APIKey:       apiKeyValue,
+		Prompt:       prompt,
+		APIKeyLimits: limits,
 	}
 
 	if err := s.apiKeyRepo.Create(apiKey); err != nil {
@@ -144,7 +147,7 @@ func (s *APIKeyService) GenerateAPIKey(userID uint64, keyName string, prompt str
 	}
 
 	// 添加到缓存
-	cache.GetCache().AddAPIKey(apiKeyValue, userID, prompt)
+	cache.GetCache().AddAPIKey(apiKey.ID, apiKeyValue, userID, prompt, limits)
 
 	return apiKey, nil
 }
@@ -203,14 +206,13 @@ func (s *APIKeyService) UpdatePrompt(id uint64, prompt string) error {
 	}
 
 	// 更新缓存
-	cache.GetCache().DeleteAPIKey(existingKey.APIKey)
-	cache.GetCache().AddAPIKey(existingKey.APIKey, existingKey.UserID, prompt)
+	cache.GetCache().UpdateAPIKey(existingKey.ID, existingKey.APIKey, existingKey.UserID, prompt, existingKey.APIKeyLimits)
 
 	return nil
 }
 
 // UpdateAPIKey 更新API密钥基本信息
-func (s *APIKeyService) UpdateAPIKey(id uint64, userID uint64, keyName string, prompt string) (*models.APIKey, error) {
+func (s *APIKeyService) UpdateAPIKey(id uint64, userID uint64, keyName string, prompt string, limits models.APIKeyLimits) (*models.APIKey, error) {
 	// 先获取密钥信息
 	existingKey, err := s.apiKeyRepo.GetByID(id)
 	if err != nil {
@@ -226,13 +228,12 @@ func (s *APIKeyService) UpdateAPIKey(id uint64, userID uint64, keyName string, p
 	}
 
 	// 更新数据库
-	if err := s.apiKeyRepo.UpdateAPIKey(id, keyName, prompt); err != nil {
+	if err := s.apiKeyRepo.UpdateAPIKey(id, keyName, prompt, limits); err != nil {
 		return nil, err
 	}
 
 	// 更新缓存
-	cache.GetCache().DeleteAPIKey(existingKey.APIKey)
-	cache.GetCache().AddAPIKey(existingKey.APIKey, existingKey.UserID, prompt)
+	cache.GetCache().UpdateAPIKey(existingKey.ID, existingKey.APIKey, existingKey.UserID, prompt, limits)
 
 	// 返回更新后的密钥
 	return s.apiKeyRepo.GetByID(id)
@@ -241,17 +242,33 @@ func (s *APIKeyService) UpdateAPIKey(id uint64, userID uint64, keyName string, p
 // ProviderService 厂商服务
 type ProviderService struct {
 	providerRepo *repository.ProviderRepository
+	cache        *cache.MemoryCache
 }
 
 // NewProviderService 创建厂商服务
 func NewProviderService() *ProviderService {
 	return &ProviderService{
 		providerRepo: repository.NewProviderRepository(),
+		cache:        cache.GetCache(),
+	}
+}
+
+// InitCache 加载所有厂商的超时和重试配置到缓存
+func (s *ProviderService) InitCache() (int, error) {
+	providers, err := s.providerRepo.GetAll()
+	if err != nil {
+		return 0, err
 	}
+	s.cache.LoadProviderPolicies(providers)
+	return len(providers), nil
 }
 
 // Create 创建厂商
-func (s *ProviderService) Create(name, displayName, baseURL, apiPrefix, apiKey string) (*models.Provider, error) {
+func (s *ProviderService) Create(name, displayName, baseURL, apiPrefix, apiKey, providerType, apiVersion string, policy models.ProviderPolicy) (*models.Provider, error) {
+	if !models.IsValidProviderType(providerType) {
+		return nil, ErrInvalidProviderType
+	}
+
 	// 检查厂商名是否已存在
 	existing, err := s.providerRepo.GetByName(name)
 	if err != nil {
@@ -267,12 +284,16 @@ func (s *ProviderService) Create(name, displayName, baseURL, apiPrefix, apiKey s
 		BaseURL:      baseURL,
 		APIPrefix:    apiPrefix,
 		APIKey:       apiKey,
+		Type:         providerType,
+		APIVersion:   apiVersion,
+		ProviderPolicy: policy,
 	}
 
 	if err := s.providerRepo.Create(provider); err != nil {
 		return nil, fmt.Errorf("创建厂商失败: %w", err)
 	}
 
+	s.cache.SetProviderPolicy(provider.ID, provider.ProviderPolicy)
 	return provider, nil
 }
 
@@ -295,31 +316,47 @@ func (s *ProviderService) GetByID(id uint64) (*models.Provider, error) {
 
 // Update 更新厂商
 func (s *ProviderService) Update(provider *models.Provider) error {
-	return s.providerRepo.Update(provider)
+	if !models.IsValidProviderType(provider.Type) {
+		return ErrInvalidProviderType
+	}
+	if err := s.providerRepo.Update(provider); err != nil {
+		return err
+	}
+	s.cache.SetProviderPolicy(provider.ID, provider.ProviderPolicy)
+	return nil
 }
 
 // Delete 删除厂商
 func (s *ProviderService) Delete(id uint64) error {
-	return s.providerRepo.Delete(id)
+	if err := s.providerRepo.Delete(id); err != nil {
+		return err
+	}
+	s.cache.DeleteProviderPolicy(id)
+	s.cache.DeleteProviderBreaker(id)
+	return nil
 }
 
 // ModelService 模型服务
 type ModelService struct {
-	modelRepo *repository.ModelRepository
-	cache     *cache.MemoryCache
+	modelRepo    *repository.ModelRepository
+	fallbackRepo *repository.ModelFallbackRepository
+	providerRepo *repository.ProviderRepository
+	cache        *cache.MemoryCache
 }
 
 // NewModelService 创建模型服务
 func NewModelService() *ModelService {
 	return &ModelService{
-		modelRepo: repository.NewModelRepository(),
-		cache:     cache.GetCache(),
+		modelRepo:    repository.NewModelRepository(),
+		fallbackRepo: repository.NewModelFallbackRepository(),
+		providerRepo: repository.NewProviderRepository(),
+		cache:        cache.GetCache(),
 	}
 }
 
 // InitCache 初始化缓存
 func (s *ModelService) InitCache() error {
-	models, err := s.modelRepo.GetAllWithDetails(0)
+	models, err := s.loadAllWithDetails()
 	if err != nil {
 		return fmt.Errorf("加载模型缓存失败: %w", err)
 	}
@@ -328,9 +365,48 @@ func (s *ModelService) InitCache() error {
 	return nil
 }
 
+// loadAllWithDetails 从数据库加载所有模型详情（含备用目标）
+func (s *ModelService) loadAllWithDetails() ([]models.ModelWithDetails, error) {
+	modelsList, err := s.modelRepo.GetAllWithDetails(0)
+	if err != nil {
+		return nil, err
+	}
+
+	fallbacks, err := s.fallbackRepo.GetAllWithProviders()
+	if err != nil {
+		return nil, err
+	}
+
+	// 按模型ID分组备用目标
+	fallbacksByModel := make(map[uint64][]models.ModelFallbackWithProvider)
+	for _, fallback := range fallbacks {
+		fallbacksByModel[fallback.ModelID] = append(fallbacksByModel[fallback.ModelID], fallback)
+	}
+	for i := range modelsList {
+		modelsList[i].Fallbacks = fallbacksByModel[modelsList[i].ID]
+	}
+
+	return modelsList, nil
+}
+
+// getByIDWithDetails 从数据库获取模型详情（含备用目标）
+func (s *ModelService) getByIDWithDetails(id uint64) (*models.ModelWithDetails, error) {
+	model, err := s.modelRepo.GetByIDWithDetails(id)
+	if err != nil || model == nil {
+		return model, err
+	}
+
+	model.Fallbacks, err = s.fallbackRepo.GetByModelIDWithProviders(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return model, nil
+}
+
 // Create 创建模型
 func (s *ModelService) Create(userID, providerID uint64, modelID, displayName string, contextLength int,
-	compressEnabled bool, compressTruncateLen, compressUserCount int, compressRoleTypes string) (*models.Model, error) {
+	compressEnabled bool, compressTruncateLen, compressUserCount int, compressRoleTypes string, embeddingsEnabled bool, pricing models.ModelPricing, lifecycle models.ModelLifecycle) (*models.Model, error) {
 	// 检查是否已存在
 	exists, err := s.modelRepo.Exists(userID, providerID, modelID)
 	if err != nil {
@@ -340,9 +416,13 @@ func (s *ModelService) Create(userID, providerID uint64, modelID, displayName st
 		return nil, errors.New("模型已存在")
 	}
 
+	if err := s.validateLifecycle(userID, 0, &lifecycle); err != nil {
+		return nil, err
+	}
+
 	// 默认上下文长度
 	if contextLength == 0 {
-		contextLength = 128
+		contextLength = models.DefaultContextLength
 	}
 
 	// 设置压缩默认值
@@ -364,6 +444,9 @@ func (s *ModelService) Create(userID, providerID uint64, modelID, displayName st
 		CompressTruncateLen: compressTruncateLen,
 		CompressUserCount:   compressUserCount,
 		CompressRoleTypes:   compressRoleTypes,
+		EmbeddingsEnabled:   embeddingsEnabled,
+		ModelPricing:        pricing,
+		ModelLifecycle:      lifecycle,
 	}
 
 	if err := s.modelRepo.Create(model); err != nil {
@@ -371,7 +454,7 @@ func (s *ModelService) Create(userID, providerID uint64, modelID, displayName st
 	}
 
 	// 添加到缓存
-	modelWithDetails, err := s.modelRepo.GetByIDWithDetails(model.ID)
+	modelWithDetails, err := s.getByIDWithDetails(model.ID)
 	if err != nil {
 		return nil, fmt.Errorf("获取模型详情失败: %w", err)
 	}
@@ -380,6 +463,32 @@ func (s *ModelService) Create(userID, providerID uint64, modelID, displayName st
 	return model, nil
 }
 
+// validateLifecycle 校验模型的可用时间段和弃用重定向配置
+// id 为当前模型ID（创建时为 0），重定向目标必须是同一用户的其他模型
+func (s *ModelService) validateLifecycle(userID, id uint64, lifecycle *models.ModelLifecycle) error {
+	lifecycle.Availability = strings.TrimSpace(lifecycle.Availability)
+	lifecycle.RedirectTo = strings.TrimSpace(lifecycle.RedirectTo)
+
+	if _, err := models.ParseAvailability(lifecycle.Availability); err != nil {
+		return err
+	}
+
+	if lifecycle.RedirectTo == "" {
+		return nil
+	}
+	if !lifecycle.Deprecated {
+		return errors.New("只有已弃用的模型才能设置重定向")
+	}
+	target, ok := s.cache.GetModelByCacheKey(lifecycle.RedirectTo)
+	if !ok || target.Model.UserID != userID {
+		return fmt.Errorf("重定向目标模型不存在: %s", lifecycle.RedirectTo)
+	}
+	if target.Model.ID == id {
+		return errors.New("不能重定向到模型自身")
+	}
+	return nil
+}
+
 // GetAll 获取所有模型（从缓存）
 // providerID 为 0 时返回所有厂商
 func (s *ModelService) GetAll(providerID uint64) []*models.ModelWithDetails {
@@ -432,14 +541,17 @@ func (s *ModelService) toModelWithDetails(item *cache.ModelCacheItem) *models.Mo
 		ProviderDisplayName:  item.ProviderDisplayName,
 		ProviderBaseURL:     item.ProviderBaseURL,
 		ProviderAPIPrefix:   item.ProviderAPIPrefix,
+		ProviderType:        item.ProviderType,
+		ProviderAPIVersion:  item.ProviderAPIVersion,
 		Username:            item.Username,
 		ProviderKey:         item.ProviderKey,
+		Fallbacks:           item.Fallbacks,
 	}
 }
 
 // Update 更新模型
 func (s *ModelService) Update(id uint64, userID, providerID uint64, modelID, displayName string, isActive bool, contextLength int,
-	compressEnabled bool, compressTruncateLen, compressUserCount int, compressRoleTypes string) (*models.Model, error) {
+	compressEnabled bool, compressTruncateLen, compressUserCount int, compressRoleTypes string, embeddingsEnabled bool, pricing models.ModelPricing, lifecycle models.ModelLifecycle) (*models.Model, error) {
 	// 检查模型是否存在
 	existing, err := s.modelRepo.GetByID(id)
 	if err != nil {
@@ -460,9 +572,13 @@ func (s *ModelService) Update(id uint64, userID, providerID uint64, modelID, dis
 		}
 	}
 
+	if err := s.validateLifecycle(userID, id, &lifecycle); err != nil {
+		return nil, err
+	}
+
 	// 默认上下文长度
 	if contextLength == 0 {
-		contextLength = 128
+		contextLength = models.DefaultContextLength
 	}
 
 	// 设置压缩默认值
@@ -485,6 +601,9 @@ func (s *ModelService) Update(id uint64, userID, providerID uint64, modelID, dis
 		CompressTruncateLen: compressTruncateLen,
 		CompressUserCount:   compressUserCount,
 		CompressRoleTypes:   compressRoleTypes,
+		EmbeddingsEnabled:   embeddingsEnabled,
+		ModelPricing:        pricing,
+		ModelLifecycle:      lifecycle,
 	}
 
 	if err := s.modelRepo.Update(model); err != nil {
@@ -492,7 +611,7 @@ func (s *ModelService) Update(id uint64, userID, providerID uint64, modelID, dis
 	}
 
 	// 更新缓存
-	modelWithDetails, err := s.modelRepo.GetByIDWithDetails(id)
+	modelWithDetails, err := s.getByIDWithDetails(id)
 	if err != nil {
 		return nil, fmt.Errorf("获取模型详情失败: %w", err)
 	}
@@ -524,7 +643,7 @@ func (s *ModelService) Delete(id uint64) error {
 
 // RefreshCache 刷新缓存
 func (s *ModelService) RefreshCache() error {
-	models, err := s.modelRepo.GetAllWithDetails(0)
+	models, err := s.loadAllWithDetails()
 	if err != nil {
 		return fmt.Errorf("重新加载模型缓存失败: %w", err)
 	}
@@ -533,6 +652,44 @@ func (s *ModelService) RefreshCache() error {
 	return nil
 }
 
+// SetFallbacks 设置模型的备用目标，列表顺序即尝试顺序
+func (s *ModelService) SetFallbacks(id uint64, fallbacks []models.ModelFallback) ([]models.ModelFallbackWithProvider, error) {
+	existing, err := s.modelRepo.GetByID(id)
+	if err != nil {
+		return nil, fmt.Errorf("查询模型失败: %w", err)
+	}
+	if existing == nil {
+		return nil, ErrModelNotFound
+	}
+
+	for i := range fallbacks {
+		if fallbacks[i].ProviderID == 0 || fallbacks[i].TargetModelID == "" {
+			return nil, errors.New("备用目标的厂商ID和模型ID不能为空")
+		}
+		provider, err := s.providerRepo.GetByID(fallbacks[i].ProviderID)
+		if err != nil {
+			return nil, fmt.Errorf("查询厂商失败: %w", err)
+		}
+		if provider == nil {
+			return nil, ErrProviderNotFound
+		}
+		fallbacks[i].Priority = i + 1
+	}
+
+	if err := s.fallbackRepo.ReplaceByModelID(id, fallbacks); err != nil {
+		return nil, err
+	}
+
+	// 更新缓存
+	modelWithDetails, err := s.getByIDWithDetails(id)
+	if err != nil {
+		return nil, fmt.Errorf("获取模型详情失败: %w", err)
+	}
+	s.cache.UpdateModel(modelWithDetails)
+
+	return modelWithDetails.Fallbacks, nil
+}
+
 // GetCache 获取缓存实例
 func (s *ModelService) GetCache() *cache.MemoryCache {
 	return s.cache
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/model-system/api/internal/models"
+	"github.com/model-system/api/internal/repository"
+)
+
+// UsageService 用量记录服务
+type UsageService struct {
+	usageRepo *repository.UsageRepository
+}
+
+// NewUsageService 创建用量记录服务
+func NewUsageService() *UsageService {
+	return &UsageService{
+		usageRepo: repository.NewUsageRepository(),
+	}
+}
+
+// Record 异步写入用量记录，不阻塞代理请求
+func (s *UsageService) Record(record *models.UsageRecord) {
+	go func() {
+		if err := s.usageRepo.Create(record); err != nil {
+			log.Printf("[WARN] 写入用量记录失败: %v", err)
+		}
+	}()
+}
+
+// Aggregate 按维度聚合用量（day、model、api_key、provider）
+func (s *UsageService) Aggregate(q *models.UsageQuery, groupBy string) ([]models.UsageAggregate, error) {
+	if !repository.IsValidGroupBy(groupBy) {
+		return nil, fmt.Errorf("不支持的聚合维度: %s", groupBy)
+	}
+	return s.usageRepo.Aggregate(q, groupBy)
+}
+
+// Summary 汇总用量
+func (s *UsageService) Summary(q *models.UsageQuery) (*models.UsageSummary, error) {
+	return s.usageRepo.Summary(q)
+}
@@ -65,6 +65,27 @@ func main() {
 		log.Printf("模型缓存加载成功，共 %d 个模型", modelService.GetCache().GetModelCount())
 	}
 
+	// 加载厂商超时和重试配置到缓存
+	if count, err := service.NewProviderService().InitCache(); err != nil {
+		log.Printf("警告: 加载厂商配置缓存失败: %v", err)
+	} else {
+		log.Printf("厂商配置缓存加载成功，共 %d 个厂商", count)
+	}
+
+	// 加载厂商密钥到缓存
+	if count, err := service.NewProviderKeyService().InitCache(); err != nil {
+		log.Printf("警告: 加载厂商密钥缓存失败: %v", err)
+	} else {
+		log.Printf("厂商密钥缓存加载成功，共 %d 个密钥", count)
+	}
+
+	// 加载用量配额到缓存
+	if count, err := service.NewQuotaService().InitCache(); err != nil {
+		log.Printf("警告: 加载用量配额缓存失败: %v", err)
+	} else {
+		log.Printf("用量配额缓存加载成功，共 %d 条", count)
+	}
+
 	// 加载API密钥到缓存
 	log.Println("正在加载API密钥到缓存...")
 	apiKeysWithUsers, err := models.GetAllAPIKeysWithUsers()
@@ -4,12 +4,23 @@ import type {
   RegisterRequest,
   AuthResponse,
   APIKey,
+  APIKeyLimits,
   APIKeyPrompt,
   Provider,
   CreateProviderRequest,
+  ProviderKey,
+  ProviderKeyRequest,
+  ProviderHealth,
+  ProviderTestResult,
+  ImportModelsResult,
   Model,
   ModelWithDetails,
   CreateModelRequest,
+  UsageAggregate,
+  UsageSummary,
+  UsageQuery,
+  Quota,
+  CreateQuotaRequest,
   User
 } from '@/types'
 
@@ -58,7 +69,7 @@ export const apiKeyAPI = {
   },
 
   // 更新API密钥
-  async update(id: number, data: { key_name?: string; prompt?: string | null }): Promise<APIKey> {
+  async update(id: number, data: { key_name?: string; prompt?: string | null } & APIKeyLimits): Promise<APIKey> {
     const response = await request.put<any>(`/api-keys/${id}`, data)
     if (response && response.data) {
       return response.data
@@ -155,6 +166,65 @@ export const providerAPI = {
   // 删除厂商
   async delete(id: number): Promise<void> {
     await request.delete(`/providers/${id}`)
+  },
+
+  // 获取厂商熔断状态
+  async health(id: number): Promise<ProviderHealth> {
+    const response = await request.get<any>(`/providers/${id}/health`)
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('获取失败')
+  },
+
+  // 测试厂商连接，返回耗时和厂商的模型列表
+  async test(id: number): Promise<ProviderTestResult> {
+    const response = await request.post<any>(`/providers/${id}/test`)
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('测试失败')
+  },
+
+  // 从厂商模型列表批量导入模型
+  async importModels(id: number, modelIds: string[]): Promise<ImportModelsResult> {
+    const response = await request.post<any>(`/providers/${id}/import-models`, { model_ids: modelIds })
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('导入失败')
+  },
+
+  // 获取厂商密钥列表
+  async listKeys(id: number): Promise<ProviderKey[]> {
+    const response = await request.get<any>(`/providers/${id}/keys`)
+    if (response && response.data && Array.isArray(response.data)) {
+      return response.data
+    }
+    return []
+  },
+
+  // 添加厂商密钥
+  async createKey(id: number, data: ProviderKeyRequest): Promise<ProviderKey> {
+    const response = await request.post<any>(`/providers/${id}/keys`, data)
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('创建失败')
+  },
+
+  // 更新厂商密钥
+  async updateKey(id: number, keyId: number, data: Partial<ProviderKeyRequest>): Promise<ProviderKey> {
+    const response = await request.put<any>(`/providers/${id}/keys/${keyId}`, data)
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('更新失败')
+  },
+
+  // 删除厂商密钥
+  async deleteKey(id: number, keyId: number): Promise<void> {
+    await request.delete(`/providers/${id}/keys/${keyId}`)
   }
 }
 
@@ -220,3 +290,59 @@ export const modelAPI = {
     await request.post('/admin/models/refresh')
   }
 }
+
+// 用量统计相关 API
+export const usageAPI = {
+  // 按维度聚合用量
+  async list(query: UsageQuery = {}): Promise<UsageAggregate[]> {
+    const response = await request.get<any>('/usage', { params: query })
+    if (response && response.data && Array.isArray(response.data)) {
+      return response.data
+    }
+    return []
+  },
+
+  // 获取用量汇总
+  async summary(query: Omit<UsageQuery, 'group_by'> = {}): Promise<UsageSummary | null> {
+    const response = await request.get<any>('/usage/summary', { params: query })
+    if (response && response.data) {
+      return response.data
+    }
+    return null
+  }
+}
+
+// 用量配额相关 API
+export const quotaAPI = {
+  // 获取当前用户的配额列表（含各API密钥的配额）
+  async list(): Promise<Quota[]> {
+    const response = await request.get<any>('/quotas')
+    if (response && response.data && Array.isArray(response.data)) {
+      return response.data
+    }
+    return []
+  },
+
+  // 创建配额
+  async create(data: CreateQuotaRequest): Promise<Quota> {
+    const response = await request.post<any>('/quotas', data)
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('创建失败')
+  },
+
+  // 更新配额上限
+  async update(id: number, limitValue: number): Promise<Quota> {
+    const response = await request.put<any>(`/quotas/${id}`, { limit_value: limitValue })
+    if (response && response.data) {
+      return response.data
+    }
+    throw new Error('更新失败')
+  },
+
+  // 删除配额
+  async delete(id: number): Promise<void> {
+    await request.delete(`/quotas/${id}`)
+  }
+}
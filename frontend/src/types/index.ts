@@ -35,10 +35,45 @@ export interface APIKey {
   api_key: string
   prompt?: string | null
   prompts?: APIKeyPrompt[]
+  rpm_limit: number
+  tpm_limit: number
+  max_concurrent_streams: number
+  quotas?: Quota[]
   created_at: string
   updated_at: string
 }
 
+// API密钥限流配置（0 表示不限制）
+export interface APIKeyLimits {
+  rpm_limit?: number
+  tpm_limit?: number
+  max_concurrent_streams?: number
+}
+
+// 用量配额类型（api_key_id 为 0 表示作用于用户的所有密钥）
+export interface Quota {
+  id: number
+  user_id: number
+  api_key_id: number
+  period: 'daily' | 'monthly'
+  limit_type: 'tokens' | 'cost'
+  limit_value: number
+  used_value: number
+  remaining: number
+  period_start: string
+  reset_at: string
+  created_at: string
+  updated_at: string
+}
+
+// 创建用量配额请求
+export interface CreateQuotaRequest {
+  api_key_id?: number
+  period: 'daily' | 'monthly'
+  limit_type?: 'tokens' | 'cost'
+  limit_value: number
+}
+
 // API密钥提示词类型
 export interface APIKeyPrompt {
   id: number
@@ -50,6 +85,9 @@ export interface APIKeyPrompt {
 }
 
 // 厂商类型
+// 厂商接口协议类型
+export type ProviderType = 'openai' | 'anthropic' | 'gemini' | 'azure'
+
 export interface Provider {
   id: number
   name: string
@@ -57,6 +95,14 @@ export interface Provider {
   base_url: string
   api_prefix: string
   api_key: string
+  type: ProviderType
+  api_version: string
+  connect_timeout: number
+  first_byte_timeout: number
+  stream_idle_timeout: number
+  max_retries: number
+  retry_backoff_ms: number
+  retry_status_codes: string
   created_at: string
   updated_at: string
 }
@@ -67,6 +113,78 @@ export interface CreateProviderRequest {
   base_url: string
   api_prefix: string
   api_key: string
+  type: ProviderType
+  api_version: string
+  connect_timeout: number
+  first_byte_timeout: number
+  stream_idle_timeout: number
+  max_retries: number
+  retry_backoff_ms: number
+  retry_status_codes: string
+}
+
+// 厂商密钥（同一厂商多个密钥按权重轮询）
+export interface ProviderKey {
+  id: number
+  provider_id: number
+  name: string
+  api_key: string
+  weight: number
+  is_active: boolean
+  cooldown_seconds: number
+  cooling_down?: boolean
+  cooldown_until?: string
+  created_at: string
+  updated_at: string
+}
+
+// 熔断状态：closed 正常，open 熔断，half_open 探测中
+export type CircuitState = 'closed' | 'open' | 'half_open'
+
+export interface CircuitStatus {
+  state: CircuitState
+  consecutive_failures: number
+  opened_at?: string
+  next_probe_at?: string
+  last_error?: string
+  last_failure_at?: string
+  last_success_at?: string
+}
+
+// 厂商及其密钥的熔断状态
+export interface ProviderHealth extends CircuitStatus {
+  provider_id: number
+  keys: (CircuitStatus & { key_id: number })[]
+}
+
+// 厂商模型列表中的模型
+export interface UpstreamModel {
+  id: string
+  display_name: string
+  context_length?: number
+  imported: boolean
+}
+
+// 厂商连接测试结果
+export interface ProviderTestResult {
+  success: boolean
+  status_code?: number
+  latency_ms: number
+  error?: string
+  models: UpstreamModel[]
+}
+
+export interface ImportModelsResult {
+  created: Model[]
+  skipped: { model_id: string; reason: string }[]
+}
+
+export interface ProviderKeyRequest {
+  name: string
+  api_key: string
+  weight: number
+  is_active: boolean
+  cooldown_seconds: number
 }
 
 // 模型类型
@@ -82,6 +200,13 @@ export interface Model {
   compress_truncate_len?: number
   compress_user_count?: number
   compress_role_types?: string
+  embeddings_enabled?: boolean
+  input_price?: number
+  output_price?: number
+  cached_input_price?: number
+  availability?: string
+  deprecated?: boolean
+  redirect_to?: string
   created_at: string
   updated_at: string
 }
@@ -105,6 +230,58 @@ export interface CreateModelRequest {
   compress_truncate_len?: number
   compress_user_count?: number
   compress_role_types?: string
+  embeddings_enabled?: boolean
+  input_price?: number
+  output_price?: number
+  cached_input_price?: number
+  availability?: string
+  deprecated?: boolean
+  redirect_to?: string
+}
+
+// 用量聚合类型
+export interface UsageAggregate {
+  key: string
+  label: string
+  requests: number
+  failed_requests: number
+  prompt_tokens: number
+  completion_tokens: number
+  total_tokens: number
+  original_tokens: number
+  compressed_tokens: number
+  saved_tokens: number
+  cost: number
+  saved_cost: number
+  avg_latency_ms: number
+}
+
+// 用量汇总类型
+export interface UsageSummary {
+  start_time: string
+  end_time: string
+  requests: number
+  failed_requests: number
+  prompt_tokens: number
+  completion_tokens: number
+  total_tokens: number
+  original_tokens: number
+  compressed_tokens: number
+  saved_tokens: number
+  saved_percent: number
+  cost: number
+  saved_cost: number
+  avg_latency_ms: number
+}
+
+// 用量查询参数
+export interface UsageQuery {
+  group_by?: 'day' | 'model' | 'api_key' | 'provider'
+  start_date?: string
+  end_date?: string
+  api_key_id?: number
+  model_id?: number
+  provider_id?: number
 }
 
 // 通用响应类型